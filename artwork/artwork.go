@@ -0,0 +1,212 @@
+package artwork
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png" // YouTube serves some thumbnails as PNG
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxThumbnailBytes guards against unexpectedly large downloads
+const maxThumbnailBytes = 20 << 20
+
+// Options controls how thumbnails are turned into cover art
+type Options struct {
+	MaxSize         int
+	Quality         int
+	DetectLetterbox bool
+	Proxy           string
+}
+
+// Fetch downloads the first candidate URL that decodes as a JPEG or PNG image
+func Fetch(ctx context.Context, candidates []string, opts Options) (image.Image, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	if opts.Proxy != "" {
+		if proxyURL, err := url.Parse(opts.Proxy); err == nil {
+			client.Transport = &http.Transport{Proxy: http.ProxyURL(proxyURL)}
+		}
+	}
+
+	var lastErr error
+	for _, candidate := range candidates {
+		img, err := fetchImage(ctx, client, candidate)
+		if err != nil {
+			log.Printf("Thumbnail %s unusable: %v", candidate, err)
+			lastErr = err
+			continue
+		}
+		log.Printf("Using thumbnail %s (%dx%d)", candidate, img.Bounds().Dx(), img.Bounds().Dy())
+		return img, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no thumbnails available")
+	}
+	return nil, lastErr
+}
+
+func fetchImage(ctx context.Context, client *http.Client, imageURL string) (image.Image, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching thumbnail: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	img, _, err := image.Decode(io.LimitReader(resp.Body, maxThumbnailBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding thumbnail: %w", err)
+	}
+	return img, nil
+}
+
+// Cover turns a thumbnail into square JPEG cover art
+func Cover(img image.Image, opts Options) ([]byte, error) {
+	rgba := toRGBA(img)
+	if opts.DetectLetterbox {
+		rgba = cropLetterbox(rgba)
+	}
+	rgba = cropSquare(rgba)
+	if opts.MaxSize > 0 && rgba.Bounds().Dx() > opts.MaxSize {
+		rgba = resize(rgba, opts.MaxSize)
+	}
+
+	quality := opts.Quality
+	if quality <= 0 {
+		quality = jpeg.DefaultQuality
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, fmt.Errorf("error encoding cover art: %w", err)
+	}
+	log.Printf("Cover art: %dx%d, %d bytes", rgba.Bounds().Dx(), rgba.Bounds().Dy(), buf.Len())
+	return buf.Bytes(), nil
+}
+
+// toRGBA copies an image into an RGBA buffer with its origin at 0,0
+func toRGBA(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// cropSquare keeps the centered square of the image
+func cropSquare(img *image.RGBA) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == h {
+		return img
+	}
+	side := w
+	if h < side {
+		side = h
+	}
+	x0 := bounds.Min.X + (w-side)/2
+	y0 := bounds.Min.Y + (h-side)/2
+	return subImage(img, image.Rect(x0, y0, x0+side, y0+side))
+}
+
+// letterboxLuma is the brightness below which a pixel counts as part of a black bar
+const letterboxLuma = 24
+
+// cropLetterbox removes black bars around the picture, as found on 4:3 thumbnails of 16:9 videos
+func cropLetterbox(img *image.RGBA) *image.RGBA {
+	bounds := img.Bounds()
+	top, bottom := bounds.Min.Y, bounds.Max.Y
+	left, right := bounds.Min.X, bounds.Max.X
+
+	for top < bottom && darkLine(img, left, top, right, top+1) {
+		top++
+	}
+	for bottom > top && darkLine(img, left, bottom-1, right, bottom) {
+		bottom--
+	}
+	for left < right && darkLine(img, left, top, left+1, bottom) {
+		left++
+	}
+	for right > left && darkLine(img, right-1, top, right, bottom) {
+		right--
+	}
+
+	crop := image.Rect(left, top, right, bottom)
+	// Leave mostly dark pictures alone instead of cropping them to nothing
+	if crop.Dx() < bounds.Dx()/2 || crop.Dy() < bounds.Dy()/2 || crop.Eq(bounds) {
+		return img
+	}
+	log.Printf("Detected letterbox, cropping %v to %v", bounds, crop)
+	return subImage(img, crop)
+}
+
+// darkLine reports whether nearly every pixel of a one pixel wide row or column is black
+func darkLine(img *image.RGBA, x0, y0, x1, y1 int) bool {
+	total, dark := 0, 0
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			c := img.RGBAAt(x, y)
+			luma := (299*int(c.R) + 587*int(c.G) + 114*int(c.B)) / 1000
+			if luma < letterboxLuma {
+				dark++
+			}
+			total++
+		}
+	}
+	return total > 0 && dark*100 >= total*98
+}
+
+// resize scales a square image down to size x size by averaging the source pixels under each output pixel
+func resize(img *image.RGBA, size int) *image.RGBA {
+	src := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	scaleX := float64(src.Dx()) / float64(size)
+	scaleY := float64(src.Dy()) / float64(size)
+
+	for y := 0; y < size; y++ {
+		sy0 := src.Min.Y + int(float64(y)*scaleY)
+		sy1 := src.Min.Y + int(float64(y+1)*scaleY)
+		if sy1 <= sy0 {
+			sy1 = sy0 + 1
+		}
+		for x := 0; x < size; x++ {
+			sx0 := src.Min.X + int(float64(x)*scaleX)
+			sx1 := src.Min.X + int(float64(x+1)*scaleX)
+			if sx1 <= sx0 {
+				sx1 = sx0 + 1
+			}
+
+			var r, g, b, n int
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					c := img.RGBAAt(sx, sy)
+					r += int(c.R)
+					g += int(c.G)
+					b += int(c.B)
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = 0xFF
+		}
+	}
+	return dst
+}
+
+func subImage(img *image.RGBA, r image.Rectangle) *image.RGBA {
+	return img.SubImage(r).(*image.RGBA)
+}
@@ -0,0 +1,133 @@
+package artwork
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+var (
+	black = color.RGBA{0, 0, 0, 0xFF}
+	white = color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	red   = color.RGBA{0xFF, 0, 0, 0xFF}
+	blue  = color.RGBA{0, 0, 0xFF, 0xFF}
+)
+
+// testImage builds a w x h image filled with fill, with the picture rectangle painted in picture
+func testImage(w, h int, fill color.RGBA, picture image.Rectangle, pictureColor color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if image.Pt(x, y).In(picture) {
+				img.SetRGBA(x, y, pictureColor)
+			} else {
+				img.SetRGBA(x, y, fill)
+			}
+		}
+	}
+	return img
+}
+
+func TestCropSquare(t *testing.T) {
+	tests := []struct {
+		name string
+		img  *image.RGBA
+		want image.Rectangle
+	}{
+		{"landscape", testImage(8, 4, white, image.Rectangle{}, white), image.Rect(2, 0, 6, 4)},
+		{"portrait", testImage(4, 8, white, image.Rectangle{}, white), image.Rect(0, 2, 4, 6)},
+		{"odd margin", testImage(7, 4, white, image.Rectangle{}, white), image.Rect(1, 0, 5, 4)},
+		{"square", testImage(5, 5, white, image.Rectangle{}, white), image.Rect(0, 0, 5, 5)},
+		{"offset origin", subImage(testImage(16, 12, white, image.Rectangle{}, white), image.Rect(2, 2, 14, 8)), image.Rect(5, 2, 11, 8)},
+	}
+	for _, tt := range tests {
+		if got := cropSquare(tt.img).Bounds(); got != tt.want {
+			t.Errorf("%s: cropSquare = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCropLetterbox(t *testing.T) {
+	// A few stray bright pixels in a bar still count as black
+	noisy := testImage(100, 40, black, image.Rect(0, 5, 100, 35), red)
+	noisy.SetRGBA(50, 1, white)
+
+	tests := []struct {
+		name string
+		img  *image.RGBA
+		want image.Rectangle
+	}{
+		{"bars above and below", testImage(16, 12, black, image.Rect(0, 2, 16, 10), red), image.Rect(0, 2, 16, 10)},
+		{"bars on the sides", testImage(16, 12, black, image.Rect(3, 0, 13, 12), red), image.Rect(3, 0, 13, 12)},
+		{"boxed", testImage(16, 12, black, image.Rect(2, 1, 14, 11), red), image.Rect(2, 1, 14, 11)},
+		{"noisy bar", noisy, image.Rect(0, 5, 100, 35)},
+		{"no bars", testImage(16, 12, red, image.Rectangle{}, red), image.Rect(0, 0, 16, 12)},
+		{"black", testImage(16, 12, black, image.Rectangle{}, black), image.Rect(0, 0, 16, 12)},
+		{"mostly dark", testImage(16, 12, black, image.Rect(6, 4, 10, 8), red), image.Rect(0, 0, 16, 12)},
+	}
+	for _, tt := range tests {
+		if got := cropLetterbox(tt.img).Bounds(); got != tt.want {
+			t.Errorf("%s: cropLetterbox = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	quadrants := testImage(4, 4, red, image.Rect(2, 0, 4, 4), blue) // red left half, blue right half
+	checkered := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if (x+y)%2 == 0 {
+				checkered.SetRGBA(x, y, white)
+			} else {
+				checkered.SetRGBA(x, y, black)
+			}
+		}
+	}
+	offset := subImage(testImage(6, 6, white, image.Rect(0, 0, 6, 3), red), image.Rect(2, 2, 6, 6))
+
+	tests := []struct {
+		name string
+		img  *image.RGBA
+		size int
+		want []color.RGBA // row by row
+	}{
+		{"halves", quadrants, 2, []color.RGBA{red, blue, red, blue}},
+		{"averaged", checkered, 1, []color.RGBA{{0x7F, 0x7F, 0x7F, 0xFF}}},
+		{"offset origin", offset, 2, []color.RGBA{{0xFF, 0x7F, 0x7F, 0xFF}, {0xFF, 0x7F, 0x7F, 0xFF}, white, white}},
+		{"uneven scale", testImage(3, 3, red, image.Rectangle{}, red), 2, []color.RGBA{red, red, red, red}},
+	}
+	for _, tt := range tests {
+		got := resize(tt.img, tt.size)
+		if got.Bounds() != image.Rect(0, 0, tt.size, tt.size) {
+			t.Errorf("%s: resize bounds = %v", tt.name, got.Bounds())
+			continue
+		}
+		for i, want := range tt.want {
+			if c := got.RGBAAt(i%tt.size, i/tt.size); c != want {
+				t.Errorf("%s: pixel %d,%d = %v, want %v", tt.name, i%tt.size, i/tt.size, c, want)
+			}
+		}
+	}
+}
+
+func TestCover(t *testing.T) {
+	thumbnail := testImage(64, 48, black, image.Rect(0, 6, 64, 42), red)
+	data, err := Cover(thumbnail, Options{MaxSize: 16, DetectLetterbox: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 16, 16) {
+		t.Errorf("cover is %v, want 16x16", img.Bounds())
+	}
+	// The letterbox bars are cropped before the square, so no black is left at the edges
+	if r, g, b, _ := img.At(8, 0).RGBA(); r>>8 < 0xC0 || g>>8 > 0x40 || b>>8 > 0x40 {
+		t.Errorf("top edge of the cover is %v, want red", img.At(8, 0))
+	}
+}
@@ -0,0 +1,28 @@
+package config
+
+import "fmt"
+
+// ArtworkOptions controls the cover art made from video thumbnails
+type ArtworkOptions struct {
+	Embed           bool `json:"embed,omitempty"`
+	MaxSize         int  `json:"max_size,omitempty"`
+	Quality         int  `json:"quality,omitempty"`
+	DetectLetterbox bool `json:"detect_letterbox,omitempty"`
+	SaveCover       bool `json:"save_cover,omitempty"`
+}
+
+// Enabled reports whether cover art has to be fetched at all
+func (a ArtworkOptions) Enabled() bool {
+	return a.Embed || a.SaveCover
+}
+
+// Validate checks the cover size and JPEG quality
+func (a ArtworkOptions) Validate() error {
+	if a.MaxSize < 0 || (a.MaxSize > 0 && a.MaxSize < 64) {
+		return fmt.Errorf("artwork size must be at least 64 pixels, got %d", a.MaxSize)
+	}
+	if a.Quality < 1 || a.Quality > 100 {
+		return fmt.Errorf("artwork quality must be between 1 and 100, got %d", a.Quality)
+	}
+	return nil
+}
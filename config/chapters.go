@@ -0,0 +1,19 @@
+package config
+
+import "fmt"
+
+// ChapterOptions controls splitting chaptered videos such as full albums and DJ mixes into tracks
+type ChapterOptions struct {
+	Split        bool `json:"split,omitempty"`
+	M3U          bool `json:"m3u,omitempty"`
+	Cue          bool `json:"cue,omitempty"`
+	KeepOriginal bool `json:"keep_original,omitempty"`
+}
+
+// Validate checks that the playlist options are only used together with splitting
+func (c ChapterOptions) Validate() error {
+	if !c.Split && (c.M3U || c.Cue || c.KeepOriginal) {
+		return fmt.Errorf("--chapter-m3u, --chapter-cue and --keep-original require --split-chapters")
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// CSVDelimiters are the delimiters a song CSV is checked for when none is given, in order of preference
+var CSVDelimiters = []rune{',', ';', '\t', '|'}
+
+// AudioFormats are the formats yt-dlp can extract audio to, which the format column of a song CSV may name
+var AudioFormats = []string{"best", "aac", "alac", "flac", "m4a", "mp3", "opus", "vorbis", "wav"}
+
+// CSVOptions controls how song CSV files are read
+type CSVOptions struct {
+	Delimiter   string `json:"delimiter,omitempty"`    // empty to detect it from the first line
+	SkipInvalid bool   `json:"skip_invalid,omitempty"` // download the valid rows even if others are malformed
+}
+
+// Validate checks that the delimiter is a single character that can separate fields
+func (c CSVOptions) Validate() error {
+	if c.Delimiter == "" {
+		return nil
+	}
+	r := c.Comma()
+	if r == 0 || r == '"' || r == '\r' || r == '\n' || r == utf8.RuneError {
+		return fmt.Errorf("invalid CSV delimiter %q (expected a single character such as , ; | or tab)", c.Delimiter)
+	}
+	return nil
+}
+
+// Comma returns the configured delimiter, or 0 when it should be detected. "tab" and `\t` stand for a tab.
+func (c CSVOptions) Comma() rune {
+	switch strings.ToLower(c.Delimiter) {
+	case "":
+		return 0
+	case "tab", `\t`:
+		return '\t'
+	}
+	r, size := utf8.DecodeRuneInString(c.Delimiter)
+	if size != len(c.Delimiter) {
+		return 0
+	}
+	return r
+}
+
+// ValidAudioFormat reports whether format is one of AudioFormats
+func ValidAudioFormat(format string) bool {
+	for _, f := range AudioFormats {
+		if strings.EqualFold(f, format) {
+			return true
+		}
+	}
+	return false
+}
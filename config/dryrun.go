@@ -0,0 +1,34 @@
+package config
+
+import "fmt"
+
+// Formats of the plan printed by a dry run
+const (
+	PlanTable = "table"
+	PlanJSON  = "json"
+	PlanCSV   = "csv" // a match file, which lists the search candidates and can be edited and downloaded
+)
+
+// DryRunOptions controls dry runs, which search and rank the items of a batch and print what would be
+// downloaded instead of downloading it
+type DryRunOptions struct {
+	Enabled bool
+	Format  string
+	// File is where the plan is written instead of standard output
+	File string
+	// Candidates is how many of the ranked search results a match file lists per item
+	Candidates int
+}
+
+// Validate checks the plan format and the number of candidates
+func (d DryRunOptions) Validate() error {
+	switch d.Format {
+	case PlanTable, PlanJSON, PlanCSV:
+	default:
+		return fmt.Errorf("unknown plan format %q (expected %s, %s or %s)", d.Format, PlanTable, PlanJSON, PlanCSV)
+	}
+	if d.Candidates < 1 {
+		return fmt.Errorf("at least one candidate must be listed, got %d", d.Candidates)
+	}
+	return nil
+}
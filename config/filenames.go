@@ -0,0 +1,32 @@
+package config
+
+import "fmt"
+
+// Collision policies for downloads that resolve to a file name already in use
+const (
+	CollisionID      = "id"
+	CollisionCounter = "counter"
+)
+
+// DefaultFileNameBytes keeps names, suffixes and extensions below the 255 byte limit of common file systems
+const DefaultFileNameBytes = 200
+
+// FileNameOptions controls how titles are turned into file names
+type FileNameOptions struct {
+	ASCII     bool   `json:"ascii,omitempty"`
+	MaxBytes  int    `json:"max_bytes,omitempty"`
+	Collision string `json:"collision,omitempty"`
+}
+
+// Validate checks the length limit and collision policy
+func (f FileNameOptions) Validate() error {
+	if f.MaxBytes < 32 || f.MaxBytes > 240 {
+		return fmt.Errorf("file name length must be between 32 and 240 bytes, got %d", f.MaxBytes)
+	}
+	switch f.Collision {
+	case CollisionID, CollisionCounter:
+		return nil
+	default:
+		return fmt.Errorf("unknown collision policy %q (expected %s or %s)", f.Collision, CollisionID, CollisionCounter)
+	}
+}
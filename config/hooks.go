@@ -0,0 +1,31 @@
+package config
+
+import "fmt"
+
+// Hook failure policies
+const (
+	HookFailureIgnore = "ignore"
+	HookFailureWarn   = "warn"
+	HookFailureFail   = "fail"
+)
+
+// HookOptions configures the user commands run after each download and each batch
+type HookOptions struct {
+	PostDownload []string `json:"post_download,omitempty"`
+	PostBatch    []string `json:"post_batch,omitempty"`
+	Timeout      Duration `json:"timeout,omitempty"`
+	OnFailure    string   `json:"on_failure,omitempty"`
+}
+
+// Validate checks the timeout and failure policy
+func (h HookOptions) Validate() error {
+	if h.Timeout < 0 {
+		return fmt.Errorf("hook timeout cannot be negative")
+	}
+	switch h.OnFailure {
+	case HookFailureIgnore, HookFailureWarn, HookFailureFail:
+		return nil
+	default:
+		return fmt.Errorf("unknown hook failure policy %q (use ignore, warn or fail)", h.OnFailure)
+	}
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultMinFreeSpace is the free space below which a batch stops unless configured otherwise
+const DefaultMinFreeSpace = 500 << 20
+
+// LimitOptions guards against downloads that would fill the disk
+type LimitOptions struct {
+	MaxDuration  Duration `json:"max_duration,omitempty"`
+	MaxFileSize  ByteSize `json:"max_filesize,omitempty"`
+	BatchBudget  ByteSize `json:"batch_budget,omitempty"`
+	MinFreeSpace ByteSize `json:"min_free_space,omitempty"`
+}
+
+// Validate checks that the limits are not negative
+func (l LimitOptions) Validate() error {
+	if l.MaxDuration < 0 {
+		return fmt.Errorf("max duration cannot be negative")
+	}
+	if l.MaxFileSize < 0 || l.BatchBudget < 0 || l.MinFreeSpace < 0 {
+		return fmt.Errorf("size limits cannot be negative")
+	}
+	return nil
+}
+
+// ByteSize is a number of bytes written as 500K, 200M or 5G on the command line and in the config file
+type ByteSize int64
+
+var byteSizePattern = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)\s*([kmgt]?)(?:i?b)?$`)
+
+// ParseByteSize parses sizes with an optional binary K, M, G or T suffix
+func ParseByteSize(s string) (ByteSize, error) {
+	match := byteSizePattern.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 500K, 200M or 5G", s)
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	shift := strings.Index("kmgt", strings.ToLower(match[2])) + 1
+	if match[2] == "" {
+		shift = 0
+	}
+	return ByteSize(value * float64(int64(1)<<(10*shift))), nil
+}
+
+// String formats the size with the largest suffix that keeps it readable, e.g. 1.5G
+func (b ByteSize) String() string {
+	const units = "KMGT"
+	if b < 1024 && b > -1024 {
+		return strconv.FormatInt(int64(b), 10)
+	}
+	value := float64(b)
+	unit := -1
+	for math.Abs(value) >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return strconv.FormatFloat(math.Round(value*10)/10, 'f', -1, 64) + string(units[unit])
+}
+
+// Set implements pflag.Value
+func (b *ByteSize) Set(s string) error {
+	size, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+// Type implements pflag.Value
+func (b *ByteSize) Type() string {
+	return "size"
+}
+
+// UnmarshalJSON accepts sizes as strings such as "5G" or as plain byte counts
+func (b *ByteSize) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		*b = ByteSize(v)
+		return nil
+	case string:
+		return b.Set(v)
+	default:
+		return fmt.Errorf("invalid size %s", data)
+	}
+}
+
+// MarshalJSON writes the size as a string with a suffix
+func (b ByteSize) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.String())
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ByteSize
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "1024", want: 1024},
+		{in: "500K", want: 500 << 10},
+		{in: "500k", want: 500 << 10},
+		{in: "200M", want: 200 << 20},
+		{in: "200MB", want: 200 << 20},
+		{in: "200MiB", want: 200 << 20},
+		{in: " 5 G ", want: 5 << 30},
+		{in: "1.5G", want: 3 << 29},
+		{in: "2T", want: 2 << 40},
+		{in: "10B", want: 10},
+		{in: "", wantErr: true},
+		{in: "M", wantErr: true},
+		{in: "-5M", wantErr: true},
+		{in: "5X", wantErr: true},
+		{in: "5 megabytes", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseByteSize(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	tests := []struct {
+		in   ByteSize
+		want string
+	}{
+		{0, "0"},
+		{1023, "1023"},
+		{1024, "1K"},
+		{500 << 10, "500K"},
+		{3 << 29, "1.5G"},
+		{2 << 40, "2T"},
+		{5 << 50, "5120T"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("ByteSize(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestByteSizeJSON(t *testing.T) {
+	var limits LimitOptions
+	if err := json.Unmarshal([]byte(`{"max_filesize": "200M", "batch_budget": 1048576}`), &limits); err != nil {
+		t.Fatal(err)
+	}
+	if limits.MaxFileSize != 200<<20 || limits.BatchBudget != 1<<20 {
+		t.Errorf("limits = %+v", limits)
+	}
+	if err := json.Unmarshal([]byte(`{"max_filesize": true}`), &limits); err == nil {
+		t.Error("expected an error for a boolean size")
+	}
+
+	data, err := json.Marshal(LimitOptions{MinFreeSpace: DefaultMinFreeSpace})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"min_free_space":"500M"}` {
+		t.Errorf("json.Marshal = %s", data)
+	}
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// rateRegex matches yt-dlp rates such as 500K, 4.2M or 1048576
+var rateRegex = regexp.MustCompile(`^\d+(\.\d+)?[KMGkmg]?$`)
+
+// proxySchemes are the proxy URL schemes yt-dlp understands
+var proxySchemes = map[string]bool{
+	"http": true, "https": true, "socks4": true, "socks4a": true, "socks5": true, "socks5h": true,
+}
+
+// NetworkOptions holds the yt-dlp networking and authentication settings
+type NetworkOptions struct {
+	CookiesFile        string  `json:"cookies_file,omitempty"`
+	CookiesFromBrowser string  `json:"cookies_from_browser,omitempty"`
+	Proxy              string  `json:"proxy,omitempty"`
+	SourceAddress      string  `json:"source_address,omitempty"`
+	LimitRate          string  `json:"limit_rate,omitempty"`
+	SleepInterval      float64 `json:"sleep_interval,omitempty"`
+	MaxSleepInterval   float64 `json:"max_sleep_interval,omitempty"`
+	SleepRequests      float64 `json:"sleep_requests,omitempty"`
+	UserAgent          string  `json:"user_agent,omitempty"`
+
+	// TotalLimitRate and RateSchedule cap the bandwidth of all concurrent downloads together
+	TotalLimitRate ByteSize `json:"total_limit_rate,omitempty"`
+	RateSchedule   string   `json:"rate_schedule,omitempty"`
+}
+
+// BandwidthLimited reports whether a total bandwidth limit or schedule is configured
+func (n NetworkOptions) BandwidthLimited() bool {
+	return n.TotalLimitRate > 0 || n.RateSchedule != ""
+}
+
+// Validate checks the options before they are handed to yt-dlp
+func (n NetworkOptions) Validate() error {
+	if n.CookiesFile != "" {
+		if _, err := os.Stat(n.CookiesFile); err != nil {
+			return fmt.Errorf("cookies file not readable: %w", err)
+		}
+	}
+
+	if n.Proxy != "" {
+		proxyURL, err := url.Parse(n.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return fmt.Errorf("invalid proxy %q, expected a URL such as socks5://127.0.0.1:1080", redactProxy(n.Proxy))
+		}
+		if !proxySchemes[strings.ToLower(proxyURL.Scheme)] {
+			return fmt.Errorf("unsupported proxy scheme %q (use http, https, socks4, socks4a, socks5 or socks5h)", proxyURL.Scheme)
+		}
+	}
+
+	if n.SourceAddress != "" && net.ParseIP(n.SourceAddress) == nil {
+		return fmt.Errorf("invalid source address %q, expected an IP address", n.SourceAddress)
+	}
+
+	if n.LimitRate != "" && !rateRegex.MatchString(n.LimitRate) {
+		return fmt.Errorf("invalid rate limit %q, expected a value such as 500K or 4M", n.LimitRate)
+	}
+
+	if n.TotalLimitRate < 0 {
+		return fmt.Errorf("total rate limit cannot be negative")
+	}
+	if _, err := ParseRateSchedule(n.RateSchedule); err != nil {
+		return fmt.Errorf("invalid rate schedule: %w", err)
+	}
+
+	if n.SleepInterval < 0 || n.MaxSleepInterval < 0 || n.SleepRequests < 0 {
+		return fmt.Errorf("sleep intervals cannot be negative")
+	}
+	if n.MaxSleepInterval > 0 {
+		if n.SleepInterval == 0 {
+			return fmt.Errorf("max sleep interval requires a sleep interval")
+		}
+		if n.MaxSleepInterval < n.SleepInterval {
+			return fmt.Errorf("max sleep interval (%gs) is shorter than the sleep interval (%gs)", n.MaxSleepInterval, n.SleepInterval)
+		}
+	}
+
+	return nil
+}
+
+// String describes the options for logging with cookie locations and proxy credentials redacted
+func (n NetworkOptions) String() string {
+	var parts []string
+	if n.CookiesFile != "" {
+		parts = append(parts, "cookies=[redacted]")
+	}
+	if n.CookiesFromBrowser != "" {
+		parts = append(parts, "cookies-from-browser=[redacted]")
+	}
+	if n.Proxy != "" {
+		parts = append(parts, "proxy="+redactProxy(n.Proxy))
+	}
+	if n.SourceAddress != "" {
+		parts = append(parts, "source-address="+n.SourceAddress)
+	}
+	if n.LimitRate != "" {
+		parts = append(parts, "limit-rate="+n.LimitRate)
+	}
+	if n.TotalLimitRate > 0 {
+		parts = append(parts, "total-limit-rate="+n.TotalLimitRate.String())
+	}
+	if n.RateSchedule != "" {
+		parts = append(parts, "rate-schedule="+n.RateSchedule)
+	}
+	if n.SleepInterval > 0 {
+		parts = append(parts, fmt.Sprintf("sleep-interval=%gs", n.SleepInterval))
+	}
+	if n.MaxSleepInterval > 0 {
+		parts = append(parts, fmt.Sprintf("max-sleep-interval=%gs", n.MaxSleepInterval))
+	}
+	if n.SleepRequests > 0 {
+		parts = append(parts, fmt.Sprintf("sleep-requests=%gs", n.SleepRequests))
+	}
+	if n.UserAgent != "" {
+		parts = append(parts, fmt.Sprintf("user-agent=%q", n.UserAgent))
+	}
+	if len(parts) == 0 {
+		return "defaults"
+	}
+	return strings.Join(parts, " ")
+}
+
+// redactProxy hides the credentials of a proxy URL, the user name as well as the password
+func redactProxy(proxy string) string {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return "[redacted]"
+	}
+	if proxyURL.User != nil {
+		proxyURL.User = url.User("xxxxx")
+	}
+	return proxyURL.String()
+}
+
+// Redact hides the proxy credentials wherever they appear in text, such as a yt-dlp error about the proxy
+func (n NetworkOptions) Redact(text string) string {
+	proxyURL, err := url.Parse(n.Proxy)
+	if n.Proxy == "" || err != nil || proxyURL.User == nil {
+		return text
+	}
+	text = strings.ReplaceAll(text, n.Proxy, redactProxy(n.Proxy))
+	text = strings.ReplaceAll(text, proxyURL.User.String()+"@", "xxxxx@")
+	if password, ok := proxyURL.User.Password(); ok {
+		text = strings.ReplaceAll(text, proxyURL.User.Username()+":"+password+"@", "xxxxx@")
+	}
+	return text
+}
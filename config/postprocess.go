@@ -0,0 +1,59 @@
+package config
+
+import "fmt"
+
+// PostProcessOptions selects the ffmpeg processing applied to each download
+type PostProcessOptions struct {
+	FFmpegPath       string  `json:"ffmpeg_path,omitempty"`
+	TrimSilence      bool    `json:"trim_silence,omitempty"`
+	SilenceThreshold float64 `json:"silence_threshold,omitempty"`
+	SilenceDuration  float64 `json:"silence_duration,omitempty"`
+	Normalize        bool    `json:"normalize,omitempty"`
+	TargetLUFS       float64 `json:"target_lufs,omitempty"`
+	TruePeak         float64 `json:"true_peak,omitempty"`
+	LoudnessRange    float64 `json:"loudness_range,omitempty"`
+	ReplayGain       bool    `json:"replaygain,omitempty"`
+}
+
+// Enabled reports whether any post-processing step is selected
+func (p PostProcessOptions) Enabled() bool {
+	return p.TrimSilence || p.Normalize || p.ReplayGain
+}
+
+// Validate checks that the thresholds and loudness targets are in a sensible range
+func (p PostProcessOptions) Validate() error {
+	if p.SilenceThreshold > 0 || p.SilenceThreshold < -100 {
+		return fmt.Errorf("silence threshold must be between -100 and 0 dB, got %g", p.SilenceThreshold)
+	}
+	if p.SilenceDuration < 0 {
+		return fmt.Errorf("silence duration cannot be negative")
+	}
+	if p.TargetLUFS < -70 || p.TargetLUFS > -5 {
+		return fmt.Errorf("target loudness must be between -70 and -5 LUFS, got %g", p.TargetLUFS)
+	}
+	if p.TruePeak < -9 || p.TruePeak > 0 {
+		return fmt.Errorf("true peak must be between -9 and 0 dBTP, got %g", p.TruePeak)
+	}
+	if p.LoudnessRange < 1 || p.LoudnessRange > 50 {
+		return fmt.Errorf("loudness range must be between 1 and 50 LU, got %g", p.LoudnessRange)
+	}
+	return nil
+}
+
+// String describes the selected steps for logging
+func (p PostProcessOptions) String() string {
+	if !p.Enabled() {
+		return "disabled"
+	}
+	var steps string
+	if p.TrimSilence {
+		steps += fmt.Sprintf(" trim-silence(%gdB,%gs)", p.SilenceThreshold, p.SilenceDuration)
+	}
+	if p.Normalize {
+		steps += fmt.Sprintf(" normalize(%gLUFS,%gdBTP)", p.TargetLUFS, p.TruePeak)
+	}
+	if p.ReplayGain {
+		steps += " replaygain-tags"
+	}
+	return steps[1:]
+}
@@ -0,0 +1,311 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Profile is a named set of option overrides loaded from the config file
+type Profile struct {
+	Network      ProfileNetwork      `json:"network"`
+	SponsorBlock SponsorBlockOptions `json:"sponsorblock"`
+	PostProcess  ProfilePostProcess  `json:"postprocess"`
+	Hooks        ProfileHooks        `json:"hooks"`
+	Tags         ProfileTags         `json:"tags"`
+	Artwork      ProfileArtwork      `json:"artwork"`
+	Chapters     ProfileChapters     `json:"chapters"`
+	Limits       ProfileLimits       `json:"limits"`
+	FileNames    ProfileFileNames    `json:"filenames"`
+	Verify       ProfileVerify       `json:"verify"`
+	Search       ProfileSearch       `json:"search"`
+	CSV          ProfileCSV          `json:"csv"`
+	Report       ReportOptions       `json:"report"`
+}
+
+// The profile sections below shadow the boolean and numeric fields of the options they embed with pointers,
+// so that an explicit false or 0 in a profile overrides a non-zero default just like any other value
+
+// ProfileTags are the tag options of a profile. Enabled is a pointer because tagging is on by default,
+// so only an explicit "enabled": false can turn it off.
+type ProfileTags struct {
+	TagOptions
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// ProfileNetwork are the network options of a profile
+type ProfileNetwork struct {
+	NetworkOptions
+	SleepInterval    *float64  `json:"sleep_interval,omitempty"`
+	MaxSleepInterval *float64  `json:"max_sleep_interval,omitempty"`
+	SleepRequests    *float64  `json:"sleep_requests,omitempty"`
+	TotalLimitRate   *ByteSize `json:"total_limit_rate,omitempty"`
+}
+
+// ProfilePostProcess are the post-processing options of a profile
+type ProfilePostProcess struct {
+	PostProcessOptions
+	TrimSilence      *bool    `json:"trim_silence,omitempty"`
+	SilenceThreshold *float64 `json:"silence_threshold,omitempty"`
+	SilenceDuration  *float64 `json:"silence_duration,omitempty"`
+	Normalize        *bool    `json:"normalize,omitempty"`
+	TargetLUFS       *float64 `json:"target_lufs,omitempty"`
+	TruePeak         *float64 `json:"true_peak,omitempty"`
+	LoudnessRange    *float64 `json:"loudness_range,omitempty"`
+	ReplayGain       *bool    `json:"replaygain,omitempty"`
+}
+
+// ProfileHooks are the hook options of a profile
+type ProfileHooks struct {
+	HookOptions
+	Timeout *Duration `json:"timeout,omitempty"`
+}
+
+// ProfileArtwork are the artwork options of a profile
+type ProfileArtwork struct {
+	ArtworkOptions
+	Embed           *bool `json:"embed,omitempty"`
+	MaxSize         *int  `json:"max_size,omitempty"`
+	Quality         *int  `json:"quality,omitempty"`
+	DetectLetterbox *bool `json:"detect_letterbox,omitempty"`
+	SaveCover       *bool `json:"save_cover,omitempty"`
+}
+
+// ProfileChapters are the chapter options of a profile
+type ProfileChapters struct {
+	ChapterOptions
+	Split        *bool `json:"split,omitempty"`
+	M3U          *bool `json:"m3u,omitempty"`
+	Cue          *bool `json:"cue,omitempty"`
+	KeepOriginal *bool `json:"keep_original,omitempty"`
+}
+
+// ProfileLimits are the resource limits of a profile
+type ProfileLimits struct {
+	LimitOptions
+	MaxDuration  *Duration `json:"max_duration,omitempty"`
+	MaxFileSize  *ByteSize `json:"max_filesize,omitempty"`
+	BatchBudget  *ByteSize `json:"batch_budget,omitempty"`
+	MinFreeSpace *ByteSize `json:"min_free_space,omitempty"`
+}
+
+// ProfileFileNames are the file name options of a profile
+type ProfileFileNames struct {
+	FileNameOptions
+	ASCII    *bool `json:"ascii,omitempty"`
+	MaxBytes *int  `json:"max_bytes,omitempty"`
+}
+
+// ProfileVerify are the verification options of a profile
+type ProfileVerify struct {
+	VerifyOptions
+	Enabled    *bool     `json:"enabled,omitempty"`
+	Tolerance  *Duration `json:"tolerance,omitempty"`
+	MinBitrate *int      `json:"min_bitrate,omitempty"`
+	Retries    *int      `json:"retries,omitempty"`
+}
+
+// ProfileSearch are the search options of a profile
+type ProfileSearch struct {
+	SearchOptions
+	Results *int `json:"results,omitempty"`
+}
+
+// ProfileCSV are the CSV import options of a profile
+type ProfileCSV struct {
+	CSVOptions
+	SkipInvalid *bool `json:"skip_invalid,omitempty"`
+}
+
+// Duration is a time.Duration that is written as a string such as "30s" in the config file
+type Duration time.Duration
+
+// UnmarshalJSON accepts Go duration strings as well as plain seconds
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", v, err)
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration %s", b)
+	}
+	return nil
+}
+
+// MarshalJSON writes the duration as a Go duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// configFile is the on-disk layout of the ytaudio config file
+type configFile struct {
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// DefaultConfigPath returns the location of the config file holding profiles
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ytaudio", "config.json")
+}
+
+// LoadProfile reads the named profile from the config file at path
+func LoadProfile(path, name string) (*Profile, error) {
+	log.Printf("Loading profile %q from %s", name, path)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var file configFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", path, err)
+	}
+
+	profile, ok := file.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %q not found in %s", name, path)
+	}
+	return &profile, nil
+}
+
+// applyProfile copies profile values into the config unless the matching flag was set explicitly
+func applyProfile(cfg *Config, profile *Profile) {
+	n := profile.Network
+	overrideString(&cfg.Network.CookiesFile, n.CookiesFile, "cookies")
+	overrideString(&cfg.Network.CookiesFromBrowser, n.CookiesFromBrowser, "cookies-from-browser")
+	overrideString(&cfg.Network.Proxy, n.Proxy, "proxy")
+	overrideString(&cfg.Network.SourceAddress, n.SourceAddress, "source-address")
+	overrideString(&cfg.Network.LimitRate, n.LimitRate, "limit-rate")
+	overrideFloat(&cfg.Network.SleepInterval, n.SleepInterval, "sleep-interval")
+	overrideFloat(&cfg.Network.MaxSleepInterval, n.MaxSleepInterval, "max-sleep-interval")
+	overrideFloat(&cfg.Network.SleepRequests, n.SleepRequests, "sleep-requests")
+	overrideString(&cfg.Network.UserAgent, n.UserAgent, "user-agent")
+	overrideSize(&cfg.Network.TotalLimitRate, n.TotalLimitRate, "total-limit-rate")
+	overrideString(&cfg.Network.RateSchedule, n.RateSchedule, "rate-schedule")
+
+	s := profile.SponsorBlock
+	overrideStrings(&cfg.SponsorBlock.Remove, s.Remove, "sponsorblock-remove")
+	overrideString(&cfg.SponsorBlock.APIURL, s.APIURL, "sponsorblock-api")
+
+	p := profile.PostProcess
+	overrideString(&cfg.PostProcess.FFmpegPath, p.FFmpegPath, "ffmpeg")
+	overrideBool(&cfg.PostProcess.TrimSilence, p.TrimSilence, "trim-silence")
+	overrideFloat(&cfg.PostProcess.SilenceThreshold, p.SilenceThreshold, "silence-threshold")
+	overrideFloat(&cfg.PostProcess.SilenceDuration, p.SilenceDuration, "silence-duration")
+	overrideBool(&cfg.PostProcess.Normalize, p.Normalize, "normalize")
+	overrideFloat(&cfg.PostProcess.TargetLUFS, p.TargetLUFS, "target-lufs")
+	overrideFloat(&cfg.PostProcess.TruePeak, p.TruePeak, "true-peak")
+	overrideFloat(&cfg.PostProcess.LoudnessRange, p.LoudnessRange, "loudness-range")
+	overrideBool(&cfg.PostProcess.ReplayGain, p.ReplayGain, "replaygain")
+
+	h := profile.Hooks
+	overrideStrings(&cfg.Hooks.PostDownload, h.PostDownload, "hook")
+	overrideStrings(&cfg.Hooks.PostBatch, h.PostBatch, "batch-hook")
+	overrideDuration(&cfg.Hooks.Timeout, h.Timeout, "hook-timeout")
+	overrideString(&cfg.Hooks.OnFailure, h.OnFailure, "hook-failure")
+
+	t := profile.Tags
+	overrideBool(&cfg.Tags.Enabled, t.Enabled, "tags")
+	overrideString(&cfg.Tags.Album, t.Album, "album")
+	overrideString(&cfg.Tags.Genre, t.Genre, "genre")
+	overrideString(&cfg.Tags.Year, t.Year, "year")
+
+	a := profile.Artwork
+	overrideBool(&cfg.Artwork.Embed, a.Embed, "embed-artwork")
+	overrideInt(&cfg.Artwork.MaxSize, a.MaxSize, "artwork-size")
+	overrideInt(&cfg.Artwork.Quality, a.Quality, "artwork-quality")
+	overrideBool(&cfg.Artwork.DetectLetterbox, a.DetectLetterbox, "letterbox-detect")
+	overrideBool(&cfg.Artwork.SaveCover, a.SaveCover, "save-cover")
+
+	c := profile.Chapters
+	overrideBool(&cfg.Chapters.Split, c.Split, "split-chapters")
+	overrideBool(&cfg.Chapters.M3U, c.M3U, "chapter-m3u")
+	overrideBool(&cfg.Chapters.Cue, c.Cue, "chapter-cue")
+	overrideBool(&cfg.Chapters.KeepOriginal, c.KeepOriginal, "keep-original")
+
+	l := profile.Limits
+	overrideDuration(&cfg.Limits.MaxDuration, l.MaxDuration, "max-duration")
+	overrideSize(&cfg.Limits.MaxFileSize, l.MaxFileSize, "max-filesize")
+	overrideSize(&cfg.Limits.BatchBudget, l.BatchBudget, "batch-budget")
+	overrideSize(&cfg.Limits.MinFreeSpace, l.MinFreeSpace, "min-free-space")
+
+	f := profile.FileNames
+	overrideBool(&cfg.FileNames.ASCII, f.ASCII, "ascii-filenames")
+	overrideInt(&cfg.FileNames.MaxBytes, f.MaxBytes, "filename-max-bytes")
+	overrideString(&cfg.FileNames.Collision, f.Collision, "on-collision")
+
+	v := profile.Verify
+	overrideBool(&cfg.Verify.Enabled, v.Enabled, "verify")
+	overrideDuration(&cfg.Verify.Tolerance, v.Tolerance, "verify-tolerance")
+	overrideInt(&cfg.Verify.MinBitrate, v.MinBitrate, "verify-min-bitrate")
+	overrideInt(&cfg.Verify.Retries, v.Retries, "verify-retries")
+
+	q := profile.Search
+	overrideString(&cfg.Search.Backend, q.Backend, "search-backend")
+	overrideString(&cfg.Search.Rank, q.Rank, "search-rank")
+	overrideInt(&cfg.Search.Results, q.Results, "search-results")
+
+	overrideString(&cfg.CSV.Delimiter, profile.CSV.Delimiter, "csv-delimiter")
+	overrideBool(&cfg.CSV.SkipInvalid, profile.CSV.SkipInvalid, "csv-skip-invalid")
+
+	overrideStrings(&cfg.Report.Paths, profile.Report.Paths, "report")
+}
+
+func overrideString(dst *string, value, flag string) {
+	if value != "" && !pflag.CommandLine.Changed(flag) {
+		*dst = value
+	}
+}
+
+func overrideStrings(dst *[]string, value []string, flag string) {
+	if len(value) > 0 && !pflag.CommandLine.Changed(flag) {
+		*dst = value
+	}
+}
+
+func overrideBool(dst *bool, value *bool, flag string) {
+	if value != nil && !pflag.CommandLine.Changed(flag) {
+		*dst = *value
+	}
+}
+
+func overrideDuration(dst *Duration, value *Duration, flag string) {
+	if value != nil && !pflag.CommandLine.Changed(flag) {
+		*dst = *value
+	}
+}
+
+func overrideFloat(dst *float64, value *float64, flag string) {
+	if value != nil && !pflag.CommandLine.Changed(flag) {
+		*dst = *value
+	}
+}
+
+func overrideInt(dst *int, value *int, flag string) {
+	if value != nil && !pflag.CommandLine.Changed(flag) {
+		*dst = *value
+	}
+}
+
+func overrideSize(dst *ByteSize, value *ByteSize, flag string) {
+	if value != nil && !pflag.CommandLine.Changed(flag) {
+		*dst = *value
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApplyProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	content := `{"profiles": {"quiet": {
+		"network": {"sleep_interval": 0, "proxy": "socks5://127.0.0.1:1080"},
+		"postprocess": {"silence_threshold": 0, "target_lufs": -16, "normalize": true},
+		"tags": {"enabled": false, "genre": "House"},
+		"artwork": {"max_size": 0, "detect_letterbox": false},
+		"limits": {"batch_budget": "0", "max_duration": "1h"},
+		"verify": {"retries": 0},
+		"hooks": {"timeout": 0}
+	}}}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := LoadProfile(path, "quiet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{}
+	cfg.Network.SleepInterval = 2
+	cfg.Network.MaxSleepInterval = 5
+	cfg.PostProcess.SilenceThreshold = -50
+	cfg.PostProcess.TargetLUFS = -14
+	cfg.Tags.Enabled = true
+	cfg.Artwork.MaxSize = 1000
+	cfg.Artwork.Quality = 90
+	cfg.Artwork.DetectLetterbox = true
+	cfg.Limits.BatchBudget = 1 << 30
+	cfg.Verify.Retries = 2
+	cfg.Hooks.Timeout = Duration(time.Minute)
+	applyProfile(&cfg, profile)
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		// Explicit zero and false values override the defaults
+		{"sleep interval", cfg.Network.SleepInterval, 0.0},
+		{"silence threshold", cfg.PostProcess.SilenceThreshold, 0.0},
+		{"tags", cfg.Tags.Enabled, false},
+		{"artwork size", cfg.Artwork.MaxSize, 0},
+		{"letterbox", cfg.Artwork.DetectLetterbox, false},
+		{"batch budget", cfg.Limits.BatchBudget, ByteSize(0)},
+		{"verify retries", cfg.Verify.Retries, 0},
+		{"hook timeout", cfg.Hooks.Timeout, Duration(0)},
+		// Other values override as before
+		{"proxy", cfg.Network.Proxy, "socks5://127.0.0.1:1080"},
+		{"target", cfg.PostProcess.TargetLUFS, -16.0},
+		{"normalize", cfg.PostProcess.Normalize, true},
+		{"genre", cfg.Tags.Genre, "House"},
+		{"max duration", cfg.Limits.MaxDuration, Duration(time.Hour)},
+		// Values the profile leaves out are kept
+		{"max sleep interval", cfg.Network.MaxSleepInterval, 5.0},
+		{"artwork quality", cfg.Artwork.Quality, 90},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ReportBatchPlaceholder in a report path is replaced by the batch ID, so every batch gets its own report
+const ReportBatchPlaceholder = "{batch}"
+
+// ReportOptions controls the summary reports written after each batch
+type ReportOptions struct {
+	Paths []string `json:"paths,omitempty"`
+}
+
+// Validate checks that the format of every report can be told from its extension
+func (r ReportOptions) Validate() error {
+	for _, path := range r.Paths {
+		if ReportFormat(path) == "" {
+			return fmt.Errorf("unknown report format %q (expected .json, .md or .html)", filepath.Ext(path))
+		}
+	}
+	return nil
+}
+
+// ReportFormat returns json, markdown or html depending on the extension of path, or an empty string
+func ReportFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".md", ".markdown":
+		return "markdown"
+	case ".html", ".htm":
+		return "html"
+	default:
+		return ""
+	}
+}
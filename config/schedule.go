@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RateWindow is a daily time window with its own total bandwidth limit; zero means unlimited
+type RateWindow struct {
+	Start time.Duration // offset from midnight
+	End   time.Duration
+	Rate  ByteSize
+}
+
+// ParseRateSchedule parses schedules such as "09:00-18:00=2M,18:00-09:00=10M"; windows may wrap
+// past midnight and the first matching window wins
+func ParseRateSchedule(s string) ([]RateWindow, error) {
+	var windows []RateWindow
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		span, rate, ok := strings.Cut(entry, "=")
+		from, to, ok2 := strings.Cut(span, "-")
+		if !ok || !ok2 {
+			return nil, fmt.Errorf("invalid schedule entry %q, expected HH:MM-HH:MM=RATE", entry)
+		}
+
+		var w RateWindow
+		var err error
+		if w.Start, err = parseTimeOfDay(from); err != nil {
+			return nil, err
+		}
+		if w.End, err = parseTimeOfDay(to); err != nil {
+			return nil, err
+		}
+		if w.Start == w.End {
+			return nil, fmt.Errorf("schedule entry %q has an empty window", entry)
+		}
+		if w.Rate, err = ParseByteSize(rate); err != nil {
+			return nil, fmt.Errorf("schedule entry %q: %w", entry, err)
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// RateAt returns the limit of the first window containing t, or fallback outside all windows
+func RateAt(windows []RateWindow, t time.Time, fallback ByteSize) ByteSize {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	for _, w := range windows {
+		inside := offset >= w.Start && offset < w.End
+		if w.Start > w.End {
+			// Wraps past midnight
+			inside = offset >= w.Start || offset < w.End
+		}
+		if inside {
+			return w.Rate
+		}
+	}
+	return fallback
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRateSchedule(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []RateWindow
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: "09:00-18:00=2M", want: []RateWindow{{9 * time.Hour, 18 * time.Hour, 2 << 20}}},
+		{
+			in: " 09:00-18:00=2M , 18:00-09:00=10M,",
+			want: []RateWindow{
+				{9 * time.Hour, 18 * time.Hour, 2 << 20},
+				{18 * time.Hour, 9 * time.Hour, 10 << 20},
+			},
+		},
+		{in: "00:30-06:45=0", want: []RateWindow{{30 * time.Minute, 6*time.Hour + 45*time.Minute, 0}}},
+		{in: "09:00-18:00", wantErr: true},
+		{in: "09:00=2M", wantErr: true},
+		{in: "9-18=2M", wantErr: true},
+		{in: "09:00-24:00=2M", wantErr: true},
+		{in: "09:00-09:00=2M", wantErr: true},
+		{in: "09:00-18:00=fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRateSchedule(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRateSchedule(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRateSchedule(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRateAt(t *testing.T) {
+	windows, err := ParseRateSchedule("09:00-18:00=2M,22:00-06:00=10M,08:00-20:00=1M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		clock string
+		want  ByteSize
+	}{
+		{"08:59", 1 << 20}, // only the last window covers it
+		{"09:00", 2 << 20}, // the first matching window wins
+		{"17:59", 2 << 20},
+		{"18:00", 1 << 20},
+		{"21:00", 500},
+		{"22:00", 10 << 20},
+		{"00:00", 10 << 20},
+		{"05:59", 10 << 20},
+		{"06:00", 500},
+	}
+	for _, tt := range tests {
+		at, err := time.Parse("15:04", tt.clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := RateAt(windows, at, 500); got != tt.want {
+			t.Errorf("RateAt(%s) = %d, want %d", tt.clock, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import "fmt"
+
+// Search backends that turn song queries into videos
+const (
+	// SearchAPI uses the YouTube Data API and its daily quota
+	SearchAPI = "api"
+	// SearchYtDlp runs a ytsearch through yt-dlp, which needs no API key
+	SearchYtDlp = "yt-dlp"
+	// SearchFake makes up results without touching the network, for use with the fake download backend
+	SearchFake = "fake"
+)
+
+// Ranking strategies that pick a video from the search results
+const (
+	// RankFirst keeps YouTube's order and takes the top result
+	RankFirst = "first"
+	// RankTitle prefers results whose title matches the query and avoids live, cover and karaoke versions
+	RankTitle = "title"
+)
+
+// SearchOptions controls how queries are searched and which result is downloaded
+type SearchOptions struct {
+	Backend string `json:"backend,omitempty"`
+	Rank    string `json:"rank,omitempty"`
+	Results int    `json:"results,omitempty"`
+}
+
+// Validate checks the backend, the ranking strategy and the number of results
+func (s SearchOptions) Validate() error {
+	switch s.Backend {
+	case SearchAPI, SearchYtDlp, SearchFake:
+	default:
+		return fmt.Errorf("unknown search backend %q (expected %s, %s or %s)", s.Backend, SearchAPI, SearchYtDlp, SearchFake)
+	}
+	switch s.Rank {
+	case RankFirst, RankTitle:
+	default:
+		return fmt.Errorf("unknown ranking strategy %q (expected %s or %s)", s.Rank, RankFirst, RankTitle)
+	}
+	if s.Results < 1 || s.Results > 50 {
+		return fmt.Errorf("number of search results must be between 1 and 50, got %d", s.Results)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultSponsorBlockAPI is the public SponsorBlock server yt-dlp queries by default
+const DefaultSponsorBlockAPI = "https://sponsor.ajay.app"
+
+// sponsorBlockCategories are the segment categories that can be removed from downloads
+var sponsorBlockCategories = map[string]bool{
+	"sponsor": true, "intro": true, "outro": true, "selfpromo": true, "preview": true,
+	"filler": true, "interaction": true, "music_offtopic": true, "all": true,
+}
+
+// SponsorBlockOptions selects the SponsorBlock segments stripped from downloads
+type SponsorBlockOptions struct {
+	Remove []string `json:"remove,omitempty"`
+	APIURL string   `json:"api_url,omitempty"`
+}
+
+// Enabled reports whether any segments should be removed
+func (s SponsorBlockOptions) Enabled() bool {
+	return len(s.Remove) > 0
+}
+
+// Validate checks the categories and the API URL
+func (s SponsorBlockOptions) Validate() error {
+	for _, category := range s.Remove {
+		if !sponsorBlockCategories[category] {
+			return fmt.Errorf("unknown SponsorBlock category %q (use music_offtopic, sponsor, intro, outro, selfpromo, preview, filler, interaction or all)", category)
+		}
+	}
+	if s.APIURL != "" {
+		apiURL, err := url.Parse(s.APIURL)
+		if err != nil || apiURL.Host == "" || (apiURL.Scheme != "http" && apiURL.Scheme != "https") {
+			return fmt.Errorf("invalid SponsorBlock API URL %q", s.APIURL)
+		}
+	}
+	return nil
+}
+
+// Removes reports whether segments of the given category are stripped
+func (s SponsorBlockOptions) Removes(category string) bool {
+	for _, c := range s.Remove {
+		if c == category || c == "all" {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the options for logging
+func (s SponsorBlockOptions) String() string {
+	if !s.Enabled() {
+		return "disabled"
+	}
+	api := s.APIURL
+	if api == "" {
+		api = DefaultSponsorBlockAPI
+	}
+	return fmt.Sprintf("remove %s via %s", strings.Join(s.Remove, ","), api)
+}
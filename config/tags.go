@@ -0,0 +1,24 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// TagOptions controls the tags ytaudio writes into downloaded files
+type TagOptions struct {
+	Enabled bool   `json:"enabled,omitempty"`
+	Album   string `json:"album,omitempty"`
+	Genre   string `json:"genre,omitempty"`
+	Year    string `json:"year,omitempty"`
+}
+
+// Validate checks the default tag values
+func (t TagOptions) Validate() error {
+	if t.Year != "" {
+		if year, err := strconv.Atoi(t.Year); err != nil || year < 1000 || year > 9999 {
+			return fmt.Errorf("invalid year %q, expected four digits", t.Year)
+		}
+	}
+	return nil
+}
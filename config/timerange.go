@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeRange is the part of a video to download, in seconds; an End of zero means the end of the video
+type TimeRange struct {
+	Start float64 `json:"start,omitempty"`
+	End   float64 `json:"end,omitempty"`
+}
+
+// ParseTimeRange parses the start and end timestamps of a range, either of which may be empty
+func ParseTimeRange(start, end string) (TimeRange, error) {
+	var r TimeRange
+	var err error
+	if strings.TrimSpace(start) != "" {
+		if r.Start, err = ParseTimestamp(start); err != nil {
+			return TimeRange{}, fmt.Errorf("invalid start: %w", err)
+		}
+	}
+	if strings.TrimSpace(end) != "" {
+		if r.End, err = ParseTimestamp(end); err != nil {
+			return TimeRange{}, fmt.Errorf("invalid end: %w", err)
+		}
+	}
+	return r, r.Validate()
+}
+
+// ParseTimestamp accepts clock times such as 1:23:45 or 4:05, plain seconds such as 83.5 and
+// durations such as 1h2m3s, as used in YouTube t= parameters
+func ParseTimestamp(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty timestamp")
+	}
+
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		var seconds float64
+		for i, part := range parts {
+			value, err := strconv.ParseFloat(part, 64)
+			// Only the seconds may have a fraction, minutes and seconds stay below 60
+			if err != nil || value < 0 || (i < len(parts)-1 && value != math.Trunc(value)) || (i > 0 && value >= 60) {
+				return 0, fmt.Errorf("invalid timestamp %q", s)
+			}
+			seconds = seconds*60 + value
+		}
+		return seconds, nil
+	}
+
+	if value, err := strconv.ParseFloat(s, 64); err == nil {
+		if value < 0 {
+			return 0, fmt.Errorf("negative timestamp %q", s)
+		}
+		return value, nil
+	}
+	d, err := time.ParseDuration(strings.ToLower(s))
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid timestamp %q, expected e.g. 1:23:45, 83 or 1h23m45s", s)
+	}
+	return d.Seconds(), nil
+}
+
+// IsZero reports whether the range covers the whole video
+func (r TimeRange) IsZero() bool {
+	return r.Start == 0 && r.End == 0
+}
+
+// Validate checks that the range ends after it starts
+func (r TimeRange) Validate() error {
+	if r.Start < 0 || r.End < 0 {
+		return fmt.Errorf("range cannot be negative")
+	}
+	if r.End != 0 && r.End <= r.Start {
+		return fmt.Errorf("range end %s must be after its start %s", FormatClock(r.End), FormatClock(r.Start))
+	}
+	return nil
+}
+
+// Length returns the duration of the range within a video of the given total length
+func (r TimeRange) Length(total time.Duration) time.Duration {
+	end := r.End
+	if end == 0 || (total > 0 && end > total.Seconds()) {
+		end = total.Seconds()
+	}
+	if end <= r.Start {
+		return 0
+	}
+	return time.Duration((end - r.Start) * float64(time.Second))
+}
+
+// String formats the range as clock times, e.g. 1:23:45-1:30:00
+func (r TimeRange) String() string {
+	end := "end"
+	if r.End > 0 {
+		end = FormatClock(r.End)
+	}
+	return FormatClock(r.Start) + "-" + end
+}
+
+// Label formats the range for file names, which cannot contain colons on Windows, e.g. 1h23m45s-1h30m00s
+func (r TimeRange) Label() string {
+	end := "end"
+	if r.End > 0 {
+		end = formatLabel(r.End)
+	}
+	return formatLabel(r.Start) + "-" + end
+}
+
+// FormatClock formats seconds as [h:]mm:ss
+func FormatClock(seconds float64) string {
+	total := int(seconds)
+	h, m, s := total/3600, total/60%60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
+
+func formatLabel(seconds float64) string {
+	total := int(seconds)
+	h, m, s := total/3600, total/60%60, total%60
+	if h > 0 {
+		return fmt.Sprintf("%dh%02dm%02ds", h, m, s)
+	}
+	return fmt.Sprintf("%dm%02ds", m, s)
+}
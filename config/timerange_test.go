@@ -0,0 +1,90 @@
+package config
+
+import "testing"
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    float64
+		wantErr bool
+	}{
+		{in: "83", want: 83},
+		{in: " 83.5 ", want: 83.5},
+		{in: "0", want: 0},
+		{in: "4:05", want: 245},
+		{in: "1:23:45", want: 5025},
+		{in: "0:00:07.25", want: 7.25},
+		{in: "90:00", want: 5400},
+		{in: "1h2m3s", want: 3723},
+		{in: "1H2M3S", want: 3723},
+		{in: "45s", want: 45},
+		{in: "1.5m", want: 90},
+		{in: "", wantErr: true},
+		{in: "   ", wantErr: true},
+		{in: "-5", wantErr: true},
+		{in: "-1m", wantErr: true},
+		{in: "1:60", wantErr: true},
+		{in: "1:60:00", wantErr: true},
+		{in: "1.5:00", wantErr: true},
+		{in: "1:2:3:4", wantErr: true},
+		{in: "1:", wantErr: true},
+		{in: "1:-5", wantErr: true},
+		{in: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTimestamp(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTimestamp(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       TimeRange
+		wantErr    bool
+	}{
+		{start: "", end: "", want: TimeRange{}},
+		{start: "1:00", end: "", want: TimeRange{Start: 60}},
+		{start: "", end: "2m", want: TimeRange{End: 120}},
+		{start: "1:00", end: "1:30", want: TimeRange{Start: 60, End: 90}},
+		{start: "1:30", end: "1:00", wantErr: true},
+		{start: "1:00", end: "60", wantErr: true},
+		{start: "x", end: "", wantErr: true},
+		{start: "", end: "x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimeRange(tt.start, tt.end)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTimeRange(%q, %q) error = %v, wantErr %v", tt.start, tt.end, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("ParseTimeRange(%q, %q) = %+v, want %+v", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestTimeRangeFormat(t *testing.T) {
+	tests := []struct {
+		r            TimeRange
+		clock, label string
+	}{
+		{TimeRange{}, "0:00-end", "0m00s-end"},
+		{TimeRange{Start: 65, End: 125.9}, "1:05-2:05", "1m05s-2m05s"},
+		{TimeRange{Start: 5025, End: 5400}, "1:23:45-1:30:00", "1h23m45s-1h30m00s"},
+	}
+	for _, tt := range tests {
+		if got := tt.r.String(); got != tt.clock {
+			t.Errorf("%+v.String() = %q, want %q", tt.r, got, tt.clock)
+		}
+		if got := tt.r.Label(); got != tt.label {
+			t.Errorf("%+v.Label() = %q, want %q", tt.r, got, tt.label)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+
+	"github.com/ktappdev/ytaudio/exitcode"
+)
+
+// VerifyOptions controls the ffprobe check of finished downloads
+type VerifyOptions struct {
+	Enabled    bool     `json:"enabled,omitempty"`
+	Tolerance  Duration `json:"tolerance,omitempty"`
+	MinBitrate int      `json:"min_bitrate,omitempty"`
+	Retries    int      `json:"retries,omitempty"`
+}
+
+// Validate checks that the tolerance, bitrate and retry count are not negative
+func (v VerifyOptions) Validate() error {
+	if v.Tolerance < 0 {
+		return fmt.Errorf("verify tolerance cannot be negative")
+	}
+	if v.MinBitrate < 0 {
+		return fmt.Errorf("minimum bitrate cannot be negative")
+	}
+	if v.Retries < 0 {
+		return fmt.Errorf("verify retries cannot be negative")
+	}
+	return nil
+}
+
+// verifyFlags registers the verification flags shared by downloads and the verify command
+func verifyFlags(flags *pflag.FlagSet, v *VerifyOptions) {
+	flags.DurationVar((*time.Duration)(&v.Tolerance), "verify-tolerance", 3*time.Second, "Allowed difference between the expected and the decoded duration")
+	flags.IntVar(&v.MinBitrate, "verify-min-bitrate", 32, "Lowest average bitrate in kbps a verified file may have")
+}
+
+// VerifyCommand holds the arguments of "ytaudio verify DIR"
+type VerifyCommand struct {
+	Dir         string
+	Verify      VerifyOptions
+	PostProcess PostProcessOptions
+}
+
+// ParseVerifyFlags parses the arguments following "ytaudio verify"
+func ParseVerifyFlags(args []string) *VerifyCommand {
+	cmd := &VerifyCommand{Verify: VerifyOptions{Enabled: true}}
+	flags := pflag.NewFlagSet("verify", pflag.ExitOnError)
+	verifyFlags(flags, &cmd.Verify)
+	flags.StringVar(&cmd.PostProcess.FFmpegPath, "ffmpeg", "ffmpeg", "Path to the ffmpeg executable, ffprobe is looked up next to it")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: ytaudio verify [flags] DIR")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(exitcode.Usage)
+	}
+	cmd.Dir = flags.Arg(0)
+
+	if err := cmd.Verify.Validate(); err != nil {
+		exitcode.Fatalf(exitcode.Usage, "Invalid verify options: %v", err)
+	}
+	return cmd
+}
@@ -0,0 +1,122 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ktappdev/ytaudio/artwork"
+)
+
+// coverFileName is the folder image saved with --save-cover, only into the folders of albums split into chapters
+const coverFileName = "cover.jpg"
+
+// coverMu serializes the check-then-write of cover.jpg between workers
+var coverMu sync.Mutex
+
+// thumbnailInfo holds the thumbnail fields of the yt-dlp info JSON
+type thumbnailInfo struct {
+	ExtractorKey string `json:"extractor_key"`
+	Thumbnail    string `json:"thumbnail"`
+	Thumbnails   []struct {
+		URL        string `json:"url"`
+		Preference int    `json:"preference"`
+		Width      int    `json:"width"`
+		Height     int    `json:"height"`
+	} `json:"thumbnails"`
+}
+
+// thumbnailCandidates lists the thumbnail URLs of a download, best first
+func thumbnailCandidates(result *DownloadResult) []string {
+	var info thumbnailInfo
+	if len(result.Info) > 0 {
+		if err := json.Unmarshal(result.Info, &info); err != nil {
+			log.Printf("Error reading thumbnails from info JSON: %v", err)
+		}
+	}
+
+	thumbs := info.Thumbnails
+	sort.SliceStable(thumbs, func(i, j int) bool {
+		if thumbs[i].Preference != thumbs[j].Preference {
+			return thumbs[i].Preference > thumbs[j].Preference
+		}
+		return thumbs[i].Width*thumbs[i].Height > thumbs[j].Width*thumbs[j].Height
+	})
+
+	var candidates []string
+	seen := make(map[string]bool)
+	webp := 0
+	add := func(u string) {
+		if u == "" || seen[u] {
+			return
+		}
+		seen[u] = true
+		if isWebP(u) {
+			webp++
+			return
+		}
+		candidates = append(candidates, u)
+	}
+	for _, thumb := range thumbs {
+		add(thumb.URL)
+	}
+	add(info.Thumbnail)
+
+	if strings.EqualFold(info.ExtractorKey, "Youtube") && result.VideoID != "" {
+		add("https://i.ytimg.com/vi/" + result.VideoID + "/maxresdefault.jpg")
+		add("https://i.ytimg.com/vi/" + result.VideoID + "/hqdefault.jpg")
+	}
+
+	// WebP has no decoder in the standard library, YouTube always offers a JPEG as well
+	if webp > 0 {
+		log.Printf("Skipping %d WebP thumbnails of %s, only JPEG and PNG can be used as cover art", webp, result.FilePath)
+	}
+	return candidates
+}
+
+// isWebP reports whether a thumbnail URL points at a WebP image, by extension or format parameter
+func isWebP(thumbnailURL string) bool {
+	u, err := url.Parse(thumbnailURL)
+	if err != nil {
+		return strings.Contains(strings.ToLower(thumbnailURL), ".webp")
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), ".webp") || strings.EqualFold(u.Query().Get("format"), "webp")
+}
+
+// coverArt fetches the thumbnail of a download and turns it into square JPEG cover art
+func coverArt(ctx context.Context, result *DownloadResult, opts Options) ([]byte, error) {
+	artOpts := artwork.Options{
+		MaxSize:         opts.Artwork.MaxSize,
+		Quality:         opts.Artwork.Quality,
+		DetectLetterbox: opts.Artwork.DetectLetterbox,
+		Proxy:           opts.Network.Proxy,
+	}
+	img, err := artwork.Fetch(ctx, thumbnailCandidates(result), artOpts)
+	if err != nil {
+		return nil, err
+	}
+	return artwork.Cover(img, artOpts)
+}
+
+// saveCover writes cover.jpg into the folder of a split album unless it already has one
+func saveCover(dir string, cover []byte) error {
+	coverMu.Lock()
+	defer coverMu.Unlock()
+
+	path := filepath.Join(dir, coverFileName)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.WriteFile(path, cover, 0644); err != nil {
+		return fmt.Errorf("error saving %s: %w", path, err)
+	}
+	log.Printf("Saved cover art to %s", path)
+	return nil
+}
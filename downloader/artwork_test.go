@@ -0,0 +1,48 @@
+package downloader
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestThumbnailCandidates(t *testing.T) {
+	tests := []struct {
+		name string
+		info string
+		want []string
+	}{
+		{
+			name: "youtube",
+			info: `{"extractor_key": "Youtube", "thumbnail": "https://i.ytimg.com/vi_webp/abc/maxresdefault.webp", "thumbnails": [
+				{"url": "https://i.ytimg.com/vi/abc/default.jpg", "preference": -10, "width": 120, "height": 90},
+				{"url": "https://i.ytimg.com/vi_webp/abc/maxresdefault.webp", "preference": 0},
+				{"url": "https://i.ytimg.com/vi/abc/sddefault.jpg", "preference": -5, "width": 640, "height": 480},
+				{"url": "https://i.ytimg.com/vi/abc/hq720.jpg?sqp=-oaymwE&rs=AOn", "preference": -5, "width": 1280, "height": 720},
+				{"url": "https://i.ytimg.com/vi/abc/hqdefault.jpg", "preference": -7}
+			]}`,
+			want: []string{
+				"https://i.ytimg.com/vi/abc/hq720.jpg?sqp=-oaymwE&rs=AOn",
+				"https://i.ytimg.com/vi/abc/sddefault.jpg",
+				"https://i.ytimg.com/vi/abc/hqdefault.jpg",
+				"https://i.ytimg.com/vi/abc/default.jpg",
+				"https://i.ytimg.com/vi/abc/maxresdefault.jpg",
+			},
+		},
+		{
+			name: "webp by format",
+			info: `{"extractor_key": "Soundcloud", "thumbnails": [{"url": "https://i1.sndcdn.com/artworks-t500x500?format=webp"}, {"url": "https://i1.sndcdn.com/artworks-t500x500.png"}]}`,
+			want: []string{"https://i1.sndcdn.com/artworks-t500x500.png"},
+		},
+		{
+			name: "only webp",
+			info: `{"extractor_key": "Generic", "thumbnail": "https://example.com/cover.WEBP"}`,
+		},
+		{name: "no info", info: ``},
+	}
+	for _, tt := range tests {
+		result := &DownloadResult{VideoID: "abc", Info: []byte(tt.info)}
+		if got := thumbnailCandidates(result); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: thumbnailCandidates =\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+}
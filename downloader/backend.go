@@ -0,0 +1,130 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/filename"
+	"github.com/ktappdev/ytaudio/postprocess"
+	"github.com/ktappdev/ytaudio/tagger"
+)
+
+const (
+	// BackendYtDlp downloads with the yt-dlp executable
+	BackendYtDlp = "yt-dlp"
+	// BackendFake writes synthetic audio files without touching the network
+	BackendFake = "fake"
+)
+
+// Downloader fetches the audio for a single target, which is either a video ID or a URL
+type Downloader interface {
+	Download(ctx context.Context, target string, opts Options) (*DownloadResult, error)
+}
+
+// Options controls where and how a single item is downloaded and processed
+type Options struct {
+	OutputDir      string
+	OutputTemplate string
+	AudioFormat    string
+	AudioQuality   string
+	Network        config.NetworkOptions
+	SponsorBlock   config.SponsorBlockOptions
+	PostProcess    config.PostProcessOptions
+	Hooks          config.HookOptions
+	Tags           config.TagOptions
+	Artwork        config.ArtworkOptions
+	Chapters       config.ChapterOptions
+	Range          config.TimeRange
+	Limits         config.LimitOptions
+	Verify         config.VerifyOptions
+	Guard          *Guard // shared by every item of a batch
+	FileNames      config.FileNameOptions
+	Names          *filename.Registry // shared by every item of a batch
+	BatchID        string
+}
+
+// Item is a single unit of work: what to download and the input that asked for it
+type Item struct {
+	Target   string           `json:"target,omitempty"`
+	Query    string           `json:"query,omitempty"`
+	Metadata tagger.Metadata  `json:"metadata"`
+	Range    config.TimeRange `json:"range"`
+
+	// Per-item overrides, set by the columns of a song CSV
+	Format     string   `json:"format,omitempty"`      // audio format instead of the batch's
+	OutputName string   `json:"output_name,omitempty"` // file name instead of the video title
+	SearchHint string   `json:"search_hint,omitempty"` // words added to the search instead of the batch's suffix
+	Exclude    []string `json:"exclude,omitempty"`     // search results whose title contains one of these are passed over
+
+	// SearchSuffix is appended to the query, after a space, instead of the batch's suffix. Failures files
+	// keep the suffix a query was searched with, so that retrying it searches the same way.
+	SearchSuffix string `json:"search_suffix,omitempty"`
+}
+
+// New creates the download backend selected in the configuration
+func New(ctx context.Context, cfg *config.Config) (Downloader, error) {
+	if cfg.DryRun.Enabled {
+		// Batches only resolve their items in a dry run, so neither yt-dlp nor ffmpeg is needed
+		return dryRun{}, nil
+	}
+	if cfg.PostProcess.Enabled() || cfg.Chapters.Split || cfg.Verify.Enabled {
+		if err := postprocess.CheckFFmpeg(ctx, cfg.PostProcess); err != nil {
+			return nil, err
+		}
+	}
+
+	switch cfg.Backend {
+	case BackendYtDlp, "":
+		ytdlp := NewYtDlp(cfg.YtDlpPath, cfg.YtDlpArgs)
+		if err := ytdlp.CheckVersion(ctx); err != nil {
+			return nil, err
+		}
+		if cfg.Network.BandwidthLimited() {
+			if err := ytdlp.EnableBandwidthLimit(ctx, cfg.Network); err != nil {
+				return nil, err
+			}
+		}
+		return ytdlp, nil
+	case BackendFake:
+		log.Println("Using fake download backend, no audio will be fetched")
+		return NewFake(), nil
+	default:
+		return nil, fmt.Errorf("unknown download backend %q (expected %s or %s)", cfg.Backend, BackendYtDlp, BackendFake)
+	}
+}
+
+// OptionsFromConfig returns the download options for a run
+func OptionsFromConfig(cfg *config.Config) Options {
+	outputDir := getDownloadPath()
+	return Options{
+		OutputDir:      outputDir,
+		OutputTemplate: "%(id)s.%(ext)s", // renamed after the title once the download finished
+		AudioFormat:    cfg.AudioFormat,
+		AudioQuality:   "0",
+		Network:        cfg.Network,
+		SponsorBlock:   cfg.SponsorBlock,
+		PostProcess:    cfg.PostProcess,
+		Hooks:          cfg.Hooks,
+		Tags:           cfg.Tags,
+		Artwork:        cfg.Artwork,
+		Chapters:       cfg.Chapters,
+		Range:          cfg.Range,
+		Limits:         cfg.Limits,
+		Verify:         cfg.Verify,
+		Guard:          NewGuard(outputDir, cfg.Limits),
+		FileNames:      cfg.FileNames,
+		Names:          filename.NewRegistry(cfg.FileNames),
+		BatchID:        newBatchID(),
+	}
+}
+
+// videoURL turns a video ID into a watch URL and leaves full URLs untouched
+func videoURL(target string) string {
+	if strings.Contains(target, "://") {
+		return target
+	}
+	return fmt.Sprintf("https://www.youtube.com/watch?v=%s", target)
+}
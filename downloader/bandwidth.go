@@ -0,0 +1,70 @@
+package downloader
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/throttle"
+)
+
+// EnableBandwidthLimit makes all downloads of y share the total rate limit and schedule. Downloads
+// are routed through a local proxy pacing every response; with a SOCKS proxy, which cannot be chained,
+// each yt-dlp process gets an even share of the rate when it starts instead. yt-dlp cannot change its
+// --limit-rate while running, so that share is fixed: schedule changes and the shares of finished
+// downloads only reach the downloads started after them.
+func (y *YtDlp) EnableBandwidthLimit(ctx context.Context, n config.NetworkOptions) error {
+	schedule, err := config.ParseRateSchedule(n.RateSchedule)
+	if err != nil {
+		return err
+	}
+	rateAt := func(t time.Time) int64 {
+		return int64(config.RateAt(schedule, t, n.TotalLimitRate))
+	}
+
+	y.limiter = throttle.NewLimiter(rateAt(time.Now()))
+	if len(schedule) > 0 {
+		go y.limiter.Follow(ctx, rateAt)
+	}
+
+	if strings.HasPrefix(strings.ToLower(n.Proxy), "socks") {
+		log.Println("SOCKS proxies cannot be chained, splitting the total rate limit between downloads as they start; " +
+			"running downloads keep their share until they finish, even when the rate schedule changes")
+		return nil
+	}
+
+	proxy, err := throttle.NewProxy(y.limiter, n.Proxy, n.SourceAddress)
+	if err != nil {
+		return err
+	}
+	go proxy.Serve(ctx)
+	y.proxyURL = proxy.URL()
+	log.Printf("Sharing the total bandwidth limit through the proxy at %s", proxy.Addr())
+	return nil
+}
+
+// limitNetwork routes a download through the bandwidth limiter and returns the function releasing its share
+func (y *YtDlp) limitNetwork(n config.NetworkOptions) (config.NetworkOptions, func()) {
+	if y.limiter == nil {
+		return n, func() {}
+	}
+	if y.proxyURL != "" {
+		// The proxy connects from the source address, yt-dlp only reaches it over loopback
+		n.Proxy = y.proxyURL
+		n.SourceAddress = ""
+		return n, func() {}
+	}
+
+	share := y.limiter.Acquire()
+	if share > 0 {
+		// Keep a stricter per-download limit when one was given
+		if current, err := config.ParseByteSize(n.LimitRate); n.LimitRate == "" || err != nil || int64(current) > share {
+			n.LimitRate = strconv.FormatInt(share, 10)
+		}
+		log.Printf("Download rate limited to %s of the total", config.ByteSize(share))
+	}
+	return n, y.limiter.Release
+}
@@ -0,0 +1,384 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/engine"
+	"github.com/ktappdev/ytaudio/youtube"
+)
+
+// Stages every batch item goes through
+const (
+	StageResolve     = "resolve"
+	StageDownload    = "download"
+	StagePostProcess = "postprocess"
+)
+
+// ErrFailFast is the cause of the cancellation of the items a batch skipped after its first failure
+var ErrFailFast = errors.New("batch stopped after the first failure")
+
+// BatchError reports a batch in which items failed or that a limit stopped early. Skipped counts the items
+// of Total that were skipped, Stopped those of them left because --batch-budget or --min-free-space stopped the batch.
+type BatchError struct {
+	Failed  int
+	Skipped int
+	Stopped int
+	Total   int
+	Errs    []error
+}
+
+func (e *BatchError) Error() string {
+	if e.Failed == 0 {
+		return fmt.Sprintf("batch stopped early, %d of %d items left", e.Stopped, e.Total)
+	}
+	if e.Skipped > 0 {
+		return fmt.Sprintf("%d of %d items failed, %d skipped", e.Failed, e.Total, e.Skipped)
+	}
+	return fmt.Sprintf("%d of %d items failed", e.Failed, e.Total)
+}
+
+// Task is a batch item moving through the job engine
+type Task struct {
+	Input      Item // the item as submitted
+	Item       Item // the item being worked on, with the target found by the search
+	Match      *youtube.Candidate
+	Candidates []youtube.Candidate // the ranked search results Match was picked from, best first
+	Result     *DownloadResult
+
+	staged *stagedDownload
+	entry  *JournalEntry
+}
+
+// Workers is the number of parallel workers per stage
+type Workers struct {
+	Resolve     int
+	Download    int
+	PostProcess int
+}
+
+// Batch controls how a list of items is resolved and downloaded
+type Batch struct {
+	APIKey string
+
+	// SearchSuffix is appended to queries when searching, e.g. " audio" to prefer audio uploads
+	SearchSuffix string
+	Search       config.SearchOptions
+	Searcher     Searcher // the YouTube Data API with APIKey when nil
+
+	// FailuresFile is where failed items are listed; by default failed-<batch ID>.csv in the output directory
+	FailuresFile string
+
+	// FailFast stops the batch at the first failed item; items still running are cancelled
+	FailFast bool
+
+	// NoSearch skips the items that have no target instead of searching for them
+	NoSearch bool
+
+	// Reports are the paths the batch report is written to, in the format their extension names
+	Reports []string
+
+	// DryRun resolves the items and prints the plan instead of downloading them
+	DryRun config.DryRunOptions
+
+	Workers Workers
+
+	// Resume is the ID of a journaled batch to continue, Args the command line recorded in new journals
+	Resume string
+	Args   []string
+
+	// OnEvent is called for every change of a task, after the batch's own logging
+	OnEvent func(engine.Event[*Task])
+}
+
+// BatchFromConfig returns the batch settings for a run; stages without their own worker count use -c
+func BatchFromConfig(cfg *config.Config) Batch {
+	workers := Workers{Resolve: cfg.ResolveWorkers, Download: cfg.ConcurrentDownloads, PostProcess: cfg.PostProcessWorkers}
+	if workers.Resolve <= 0 {
+		workers.Resolve = workers.Download
+	}
+	if workers.PostProcess <= 0 {
+		workers.PostProcess = workers.Download
+	}
+	return Batch{
+		APIKey:       cfg.APIKey,
+		Search:       cfg.Search,
+		Searcher:     NewSearcher(cfg),
+		FailuresFile: cfg.FailuresFile,
+		Reports:      cfg.Report.Paths,
+		DryRun:       cfg.DryRun,
+		FailFast:     cfg.FailFast,
+		NoSearch:     cfg.NoSearch,
+		Workers:      workers,
+		Resume:       cfg.Resume,
+		Args:         cfg.Args,
+	}
+}
+
+// RunBatch searches, downloads and post-processes items with the job engine, runs the batch hooks and returns
+// the jobs it ran in input order. Items that already have a target skip the search. Progress is kept in a journal,
+// so items an earlier run of the same input finished are skipped and its search results reused.
+// When items fail or a limit stops the batch the error is a *BatchError, unless a batch hook failed or ctx was cancelled.
+func RunBatch(ctx context.Context, dl Downloader, items []Item, opts Options, batch Batch) ([]*engine.Job[*Task], error) {
+	if batch.DryRun.Enabled {
+		return nil, batch.plan(ctx, items, opts)
+	}
+
+	tasks := make([]*Task, len(items))
+	for i, item := range items {
+		tasks[i] = &Task{Input: item, Item: item}
+	}
+
+	journal, err := openJournal(opts.OutputDir, opts.BatchID, batch.Resume, items, batch.Args)
+	if err != nil {
+		if batch.Resume != "" {
+			return nil, err
+		}
+		log.Printf("Running batch without a journal: %v", err)
+	} else {
+		opts.BatchID = journal.BatchID
+		tasks = journal.remaining()
+		log.Printf("Batch %s: %d of %d items left to download", journal.BatchID, len(tasks), len(journal.Items))
+	}
+
+	log.Printf("Running %d items with %d search, %d download and %d post-processing workers",
+		len(tasks), batch.Workers.Resolve, batch.Workers.Download, batch.Workers.PostProcess)
+	return batch.run(ctx, dl, opts, journal, func(ctx context.Context, e *engine.Engine[*Task]) []*engine.Job[*Task] {
+		return e.Run(ctx, tasks)
+	})
+}
+
+// StreamBatch is RunBatch for items that arrive over time, such as lines piped into ytaudio: each item starts
+// as soon as it is received and the batch ends once items is closed. Streamed batches are not journaled,
+// since their input cannot be read a second time; failed items still end up in the failures file.
+func StreamBatch(ctx context.Context, dl Downloader, items <-chan Item, opts Options, batch Batch) ([]*engine.Job[*Task], error) {
+	if batch.DryRun.Enabled {
+		// A plan is printed as a whole, so the stream is read to its end first
+		var all []Item
+		for item := range items {
+			all = append(all, item)
+		}
+		return nil, batch.plan(ctx, all, opts)
+	}
+
+	log.Printf("Batch %s: streaming items with %d search, %d download and %d post-processing workers",
+		opts.BatchID, batch.Workers.Resolve, batch.Workers.Download, batch.Workers.PostProcess)
+	return batch.run(ctx, dl, opts, nil, func(ctx context.Context, e *engine.Engine[*Task]) []*engine.Job[*Task] {
+		tasks := make(chan *Task)
+		go func() {
+			defer close(tasks)
+			for item := range items {
+				select {
+				case tasks <- &Task{Input: item, Item: item}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return e.RunStream(ctx, tasks)
+	})
+}
+
+// run builds the engine of a batch, lets start feed it the tasks, then records and reports the outcome
+func (b Batch) run(ctx context.Context, dl Downloader, opts Options, journal *Journal,
+	start func(context.Context, *engine.Engine[*Task]) []*engine.Job[*Task]) ([]*engine.Job[*Task], error) {
+	e := engine.New(
+		engine.Stage[*Task]{Name: StageResolve, Workers: b.Workers.Resolve, Run: func(ctx context.Context, job *engine.Job[*Task]) error {
+			return b.resolve(ctx, job.Value)
+		}},
+		engine.Stage[*Task]{Name: StageDownload, Workers: b.Workers.Download, Run: func(ctx context.Context, job *engine.Job[*Task]) error {
+			staged, err := stageDownload(ctx, dl, job.Value.Item, opts)
+			job.Value.staged = staged
+			return err
+		}},
+		engine.Stage[*Task]{Name: StagePostProcess, Workers: b.Workers.PostProcess, Run: func(ctx context.Context, job *engine.Job[*Task]) error {
+			result, err := job.Value.staged.finish(ctx, opts)
+			job.Value.Result = result
+			return err
+		}},
+	)
+
+	// Failing fast cancels only this batch, with a cause that tells it apart from an interrupt
+	runCtx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+
+	var finished int
+	e.OnEvent = func(event engine.Event[*Task]) {
+		task := event.Job.Value
+		switch event.Type {
+		case engine.JobDone:
+			finished++
+			log.Printf("[%d/%d] Finished %s in %v", finished, event.Total, task.Item.describe(), event.Job.Elapsed())
+		case engine.JobFailed:
+			finished++
+			if skip := skipOf(event.Job.Err); skip != nil {
+				log.Printf("[%d/%d] Skipped %s: %s", finished, event.Total, task.Item.describe(), skip.Reason)
+				break
+			}
+			log.Printf("[%d/%d] Failed %s during %s: %v", finished, event.Total, task.Item.describe(), event.Stage, event.Job.Err)
+		}
+		if journal != nil {
+			journal.record(event, runCtx.Err() != nil)
+		}
+		if b.FailFast && event.Type == engine.JobFailed && skipOf(event.Job.Err) == nil && runCtx.Err() == nil {
+			log.Printf("Stopping batch after the first failure")
+			stop(ErrFailFast)
+		}
+		if b.OnEvent != nil {
+			b.OnEvent(event)
+		}
+	}
+	// Jobs stay in memory until the batch ends, which for a stream can take days. The yt-dlp info JSON is by far
+	// the largest part of a result, and once a job has left the engine it has served tagging and the item hooks.
+	e.Finish = func(job *engine.Job[*Task]) {
+		if job.Value.staged != nil {
+			job.Value.staged.close(opts)
+			job.Value.staged = nil
+		}
+		if job.Value.Result != nil {
+			job.Value.Result.Info = nil
+		}
+	}
+
+	if journal != nil {
+		journal.autosave(runCtx)
+	}
+	started := time.Now()
+	jobs := start(runCtx, e)
+
+	downloads, errs := Outcome(jobs)
+	skipped := len(jobs) - len(downloads) - len(errs)
+	log.Printf("Completed %d items with %d errors (%d corrupted), %d skipped", len(jobs), len(errs), countCorrupted(errs), skipped)
+	if journal != nil {
+		journal.finish()
+	}
+	if len(errs) > 0 || b.FailuresFile != "" {
+		path := b.FailuresFile
+		if path == "" {
+			path = filepath.Join(opts.OutputDir, "failed-"+opts.BatchID+".csv")
+		}
+		if err := WriteFailures(path, Failures(jobs, b.SearchSuffix)); err != nil {
+			log.Printf("Error writing failures file: %v", err)
+		} else if len(errs) > 0 {
+			log.Printf("Listed %d failed items in %s, retry them with: ytaudio --retry-failed %s", len(errs), path, path)
+		}
+	}
+	writeReports(b.Reports, opts.BatchID, started, jobs)
+	if err := RunBatchHooks(ctx, opts, downloads); err != nil {
+		return jobs, err
+	}
+	if ctx.Err() != nil {
+		return jobs, ctx.Err()
+	}
+	var stopped int
+	for _, job := range jobs {
+		if skip := skipOf(job.Err); skip != nil && skip.Stopped {
+			stopped++
+		}
+	}
+	if len(errs) > 0 || stopped > 0 {
+		return jobs, &BatchError{Failed: len(errs), Skipped: skipped, Stopped: stopped, Total: len(jobs), Errs: errs}
+	}
+	return jobs, nil
+}
+
+// Outcome splits finished jobs into the downloads that succeeded and the errors of the ones that failed;
+// skipped jobs are in neither
+func Outcome(jobs []*engine.Job[*Task]) ([]*DownloadResult, []error) {
+	var results []*DownloadResult
+	var errs []error
+	for _, job := range jobs {
+		if skipOf(job.Err) != nil {
+			continue
+		}
+		if job.Err != nil {
+			errs = append(errs, job.Err)
+			continue
+		}
+		results = append(results, job.Value.Result)
+	}
+	return results, errs
+}
+
+// resolve finds the video for an item that only has a query, taking the best ranked search result.
+// Queries that are URLs are downloaded as they are.
+func (b Batch) resolve(ctx context.Context, task *Task) error {
+	item := &task.Item
+	if item.Target != "" {
+		return nil
+	}
+	if strings.Contains(item.Query, "://") {
+		item.Target, item.Query = item.Query, ""
+		return nil
+	}
+	if b.NoSearch {
+		return &SkipError{Target: item.describe(), Reason: "no video ID chosen and searching is turned off"}
+	}
+
+	searcher, results := b.Searcher, b.Search.Results
+	if searcher == nil {
+		searcher = apiSearcher{apiKey: b.APIKey}
+	}
+	if results == 0 {
+		results = 5
+	}
+	// A search hint replaces the batch's suffix and counts for ranking, "live" can ask for live versions
+	query, suffix := item.Query, b.SearchSuffix
+	if item.SearchSuffix != "" {
+		suffix = " " + item.SearchSuffix
+	}
+	if item.SearchHint != "" {
+		query = item.Query + " " + item.SearchHint
+		suffix = ""
+	}
+	videos, err := searcher.Search(ctx, query+suffix, results)
+	if err != nil {
+		return fmt.Errorf("search failed for '%s': %w", item.Query, err)
+	}
+	if len(item.Exclude) > 0 {
+		videos = excludeVideos(videos, item.Exclude)
+	}
+	if len(videos) == 0 {
+		return fmt.Errorf("%w for '%s'", ErrNoResults, item.Query)
+	}
+
+	candidates := youtube.Rank(query, videos, b.Search.Rank)
+	task.Match, task.Candidates = &candidates[0], candidates
+	log.Printf("Found %d videos for '%s', downloading %s (score %.2f)", len(videos), item.Query, task.Match.Title, task.Match.Score)
+	item.Target = task.Match.ID
+	return nil
+}
+
+// excludeVideos drops the videos whose title contains one of the excluded words, ignoring case
+func excludeVideos(videos []youtube.Video, exclude []string) []youtube.Video {
+	var kept []youtube.Video
+	for _, video := range videos {
+		title := strings.ToLower(video.Title)
+		excluded := false
+		for _, word := range exclude {
+			if strings.Contains(title, strings.ToLower(word)) {
+				log.Printf("Passing over '%s', its title contains '%s'", video.Title, word)
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, video)
+		}
+	}
+	return kept
+}
+
+// describe names an item in log messages
+func (i Item) describe() string {
+	if i.Query != "" {
+		return "'" + i.Query + "'"
+	}
+	return i.Target
+}
@@ -0,0 +1,361 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/ytaudio/filename"
+	"github.com/ktappdev/ytaudio/postprocess"
+	"github.com/ktappdev/ytaudio/tagger"
+)
+
+// Chapter is a titled part of a video, in seconds, that becomes its own track when splitting
+type Chapter struct {
+	Index int     `json:"index"`
+	Title string  `json:"title"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// chapterInfo holds the chapter data of the yt-dlp info JSON
+type chapterInfo struct {
+	Description string `json:"description"`
+	Chapters    []struct {
+		StartTime float64 `json:"start_time"`
+		EndTime   float64 `json:"end_time"`
+		Title     string  `json:"title"`
+	} `json:"chapters"`
+}
+
+// chapterTimestamp matches a timestamp such as 3:25 or 1:02:03 standing on its own in a description line
+var chapterTimestamp = regexp.MustCompile(`(?:^|[\s\[(])((?:\d{1,2}:)?\d{1,2}:\d{2})(?:$|[\s\])])`)
+
+// chapterNumbering matches list numbering such as "1." or "02)" left in front of a chapter title
+var chapterNumbering = regexp.MustCompile(`^\d{1,3}[.)]\s+`)
+
+// chaptersFromInfo returns the chapters of a video, falling back to timestamps in its description
+func chaptersFromInfo(infoJSON []byte, duration time.Duration) []Chapter {
+	var info chapterInfo
+	if len(infoJSON) > 0 {
+		if err := json.Unmarshal(infoJSON, &info); err != nil {
+			log.Printf("Error reading chapters from info JSON: %v", err)
+			return nil
+		}
+	}
+
+	var chapters []Chapter
+	for i, c := range info.Chapters {
+		chapters = append(chapters, Chapter{Index: i + 1, Title: strings.TrimSpace(c.Title), Start: c.StartTime, End: c.EndTime})
+	}
+	if len(chapters) == 0 {
+		chapters = parseDescriptionChapters(info.Description, duration.Seconds())
+		if len(chapters) > 0 {
+			log.Printf("Found %d chapters in the video description", len(chapters))
+		}
+	}
+
+	for i := range chapters {
+		if chapters[i].Title == "" {
+			chapters[i].Title = fmt.Sprintf("Track %d", chapters[i].Index)
+		}
+	}
+	return chapters
+}
+
+// parseDescriptionChapters reads chapter lists such as "0:00 Intro" or "1. Title [03:25]" from a description,
+// following the YouTube rules: at least two timestamps, the first at 0:00, all in increasing order
+func parseDescriptionChapters(description string, duration float64) []Chapter {
+	var chapters []Chapter
+	for _, line := range strings.Split(description, "\n") {
+		match := chapterTimestamp.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+		start := parseTimestamp(line[match[2]:match[3]])
+		if len(chapters) > 0 && start <= chapters[len(chapters)-1].Start {
+			// Timestamps that go backwards end the chapter list
+			break
+		}
+		if duration > 0 && start >= duration {
+			break
+		}
+
+		// The title is the rest of the line, minus brackets that only held the timestamp
+		title := strings.NewReplacer("()", "", "[]", "").Replace(line[:match[2]] + line[match[3]:])
+		title = strings.Join(strings.Fields(title), " ")
+		title = chapterNumbering.ReplaceAllString(title, "")
+		title = strings.Trim(title, " \t-–—|:•")
+
+		chapters = append(chapters, Chapter{Index: len(chapters) + 1, Title: title, Start: start})
+	}
+
+	if len(chapters) < 2 || chapters[0].Start != 0 {
+		return nil
+	}
+	for i := range chapters {
+		if i+1 < len(chapters) {
+			chapters[i].End = chapters[i+1].Start
+		} else {
+			chapters[i].End = duration
+		}
+	}
+	return chapters
+}
+
+// parseTimestamp converts [h:]mm:ss into seconds
+func parseTimestamp(s string) float64 {
+	var seconds float64
+	for _, part := range strings.Split(s, ":") {
+		value, _ := strconv.Atoi(part)
+		seconds = seconds*60 + float64(value)
+	}
+	return seconds
+}
+
+// splitChapters cuts a downloaded video into one tagged track per chapter inside a folder named after the video.
+// The folder is built in the staging directory and moved into the output directory once every track is done.
+func splitChapters(ctx context.Context, item Item, result *DownloadResult, chapters []Chapter, opts Options) error {
+	parent := resolveMetadata(item, result, opts)
+	album := parent.Album
+	if album == "" {
+		album = result.Title
+	}
+	// An output name given for the item names the folder, the album tag stays as it is
+	folder := album
+	if item.OutputName != "" {
+		folder = item.OutputName
+	}
+
+	dir := filepath.Join(filepath.Dir(result.FilePath), filename.Clean(folder, opts.FileNames))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating track folder: %w", err)
+	}
+	log.Printf("Splitting %s into %d chapters in %s", result.FilePath, len(chapters), dir)
+
+	// The cover is fetched once and shared by every track
+	var cover []byte
+	if opts.Artwork.Enabled() {
+		var err error
+		if cover, err = coverArt(ctx, result, opts); err != nil {
+			log.Printf("Skipping cover art for %s: %v", result.FilePath, err)
+		}
+	}
+
+	width := len(strconv.Itoa(len(chapters)))
+	if width < 2 {
+		width = 2
+	}
+	ext := filepath.Ext(result.FilePath)
+
+	for i := range chapters {
+		chapter := chapters[i]
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		path := filepath.Join(dir, filename.Clean(fmt.Sprintf("%0*d - %s", width, chapter.Index, chapter.Title), opts.FileNames)+ext)
+		if err := postprocess.Cut(ctx, result.FilePath, path, chapter.Start, chapter.End, opts.PostProcess); err != nil {
+			return fmt.Errorf("error cutting chapter %d of %s: %w", chapter.Index, result.FilePath, err)
+		}
+
+		end := chapter.End
+		if end <= chapter.Start {
+			end = result.Duration.Seconds()
+		}
+		track := &DownloadResult{
+			VideoID:  result.VideoID,
+			URL:      result.URL,
+			Query:    result.Query,
+			FilePath: path,
+			Title:    chapter.Title,
+			Uploader: result.Uploader,
+			Duration: time.Duration((end - chapter.Start) * float64(time.Second)),
+			Codec:    result.Codec,
+			Elapsed:  result.Elapsed,
+			Chapter:  &chapter,
+		}
+		if err := verifyTrack(ctx, item, result, track, opts); err != nil {
+			return err
+		}
+
+		// DJ mixes name chapters "Artist - Title", albums only the title
+		artist, title := tagger.ParseQuery(chapter.Title)
+		trackItem := Item{
+			Target: item.Target,
+			Query:  item.Query,
+			Metadata: tagger.Metadata{
+				Artist:  artist,
+				Title:   title,
+				Album:   album,
+				Track:   chapter.Index,
+				Cover:   cover,
+				Year:    parent.Year,
+				Genre:   parent.Genre,
+				Comment: parent.Comment,
+			}.Merge(tagger.Metadata{Artist: parent.Artist}),
+		}
+		if err := processDownload(ctx, trackItem, track, opts); err != nil {
+			return err
+		}
+		result.Tracks = append(result.Tracks, track)
+	}
+
+	if opts.Chapters.M3U {
+		path, err := writeChapterM3U(dir, filename.Clean(folder, opts.FileNames), result.Tracks)
+		if err != nil {
+			log.Printf("Error writing M3U playlist: %v", err)
+		} else {
+			result.Sidecars = append(result.Sidecars, path)
+		}
+	}
+
+	// A CUE sheet describes the unsplit file, so it is kept whenever one is written
+	if opts.Chapters.KeepOriginal || opts.Chapters.Cue {
+		moved := filepath.Join(dir, filepath.Base(result.FilePath))
+		if err := os.Rename(result.FilePath, moved); err != nil {
+			return fmt.Errorf("error moving %s into the track folder: %w", result.FilePath, err)
+		}
+		result.FilePath = moved
+	} else {
+		if err := os.Remove(result.FilePath); err != nil {
+			log.Printf("Error removing unsplit file %s: %v", result.FilePath, err)
+		}
+		result.FilePath = dir
+		result.FileSize = 0
+		for _, track := range result.Tracks {
+			result.FileSize += track.FileSize
+		}
+	}
+
+	if opts.Chapters.Cue {
+		path, err := writeChapterCue(result.FilePath, parent.Artist, album, result.Tracks)
+		if err != nil {
+			log.Printf("Error writing CUE sheet: %v", err)
+		} else {
+			result.Sidecars = append(result.Sidecars, path)
+		}
+	}
+
+	if err := commitFolder(dir, result, opts, folder); err != nil {
+		return err
+	}
+	for _, track := range result.Tracks {
+		if err := runItemHooks(ctx, track, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitFolder moves a finished track folder into the output directory and updates every path that pointed into it.
+// Sidecars written next to the unsplit file are moved into the folder first.
+func commitFolder(dir string, result *DownloadResult, opts Options, name string) error {
+	for i, sidecar := range result.Sidecars {
+		if filepath.Dir(sidecar) == filepath.Dir(dir) {
+			moved := filepath.Join(dir, filepath.Base(sidecar))
+			if err := os.Rename(sidecar, moved); err != nil {
+				return fmt.Errorf("error moving %s into the track folder: %w", sidecar, err)
+			}
+			result.Sidecars[i] = moved
+		}
+	}
+
+	final := opts.Names.ReserveDir(opts.OutputDir, name, result.VideoID)
+	if err := os.Rename(dir, final); err != nil {
+		opts.Names.Release(final)
+		return fmt.Errorf("error moving %s to %s: %w", dir, final, err)
+	}
+	log.Printf("Saved tracks in %s", final)
+
+	moved := func(path string) string {
+		if rel, err := filepath.Rel(dir, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.Join(final, rel)
+		}
+		return path
+	}
+	result.FilePath = moved(result.FilePath)
+	for i := range result.Sidecars {
+		result.Sidecars[i] = moved(result.Sidecars[i])
+	}
+	for _, track := range result.Tracks {
+		track.FilePath = moved(track.FilePath)
+		for i := range track.Sidecars {
+			track.Sidecars[i] = moved(track.Sidecars[i])
+		}
+	}
+	return nil
+}
+
+// writeChapterM3U writes an extended M3U playlist of the tracks with paths relative to the folder
+func writeChapterM3U(dir, name string, tracks []*DownloadResult) (string, error) {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	for _, track := range tracks {
+		fmt.Fprintf(&b, "#EXTINF:%d,%s\n", int(track.Duration.Seconds()+0.5), trackDisplayName(track))
+		b.WriteString(filepath.Base(track.FilePath) + "\n")
+	}
+
+	path := filepath.Join(dir, name+".m3u")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", err
+	}
+	log.Printf("Wrote M3U playlist %s", path)
+	return path, nil
+}
+
+// writeChapterCue writes a CUE sheet next to the unsplit file with one index per chapter
+func writeChapterCue(audioPath, performer, album string, tracks []*DownloadResult) (string, error) {
+	fileType := "WAVE"
+	if strings.EqualFold(filepath.Ext(audioPath), ".mp3") {
+		fileType = "MP3"
+	}
+
+	var b strings.Builder
+	if performer != "" {
+		fmt.Fprintf(&b, "PERFORMER %s\n", cueQuote(performer))
+	}
+	fmt.Fprintf(&b, "TITLE %s\n", cueQuote(album))
+	fmt.Fprintf(&b, "FILE %s %s\n", cueQuote(filepath.Base(audioPath)), fileType)
+	for _, track := range tracks {
+		fmt.Fprintf(&b, "  TRACK %02d AUDIO\n", track.Chapter.Index)
+		title, artist := track.Chapter.Title, ""
+		if track.Tags != nil {
+			title, artist = track.Tags.Title, track.Tags.Artist
+		}
+		fmt.Fprintf(&b, "    TITLE %s\n", cueQuote(title))
+		if artist != "" {
+			fmt.Fprintf(&b, "    PERFORMER %s\n", cueQuote(artist))
+		}
+		// CUE positions are minutes, seconds and frames of 1/75 second
+		frames := int(track.Chapter.Start*75 + 0.5)
+		fmt.Fprintf(&b, "    INDEX 01 %02d:%02d:%02d\n", frames/(60*75), frames/75%60, frames%75)
+	}
+
+	path := sidecarPath(audioPath, "cue")
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", err
+	}
+	log.Printf("Wrote CUE sheet %s", path)
+	return path, nil
+}
+
+// trackDisplayName returns "Artist - Title" for a track, or its chapter title when it was not tagged
+func trackDisplayName(track *DownloadResult) string {
+	if track.Tags != nil && track.Tags.Artist != "" {
+		return track.Tags.Artist + " - " + track.Tags.Title
+	}
+	return track.Title
+}
+
+// cueQuote quotes a CUE sheet value, which cannot contain double quotes
+func cueQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "'") + `"`
+}
@@ -0,0 +1,115 @@
+package downloader
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+	}{
+		{"0:00", 0},
+		{"3:25", 205},
+		{"03:25", 205},
+		{"59:59", 3599},
+		{"1:02:03", 3723},
+		{"01:00:00", 3600},
+		{"10:00:00", 36000},
+	}
+	for _, tt := range tests {
+		if got := parseTimestamp(tt.s); got != tt.want {
+			t.Errorf("parseTimestamp(%q) = %g, want %g", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParseDescriptionChapters(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+		duration    float64
+		want        []Chapter
+	}{
+		{
+			name: "m:ss",
+			description: `Full album, out now!
+Tracklist:
+0:00 Intro
+3:25 - Second Song
+12:01 | Third Song
+
+Follow us on https://example.com`,
+			duration: 900,
+			want:     []Chapter{{1, "Intro", 0, 205}, {2, "Second Song", 205, 721}, {3, "Third Song", 721, 900}},
+		},
+		{
+			name:        "h:mm:ss mixed with m:ss",
+			description: "00:00 Artist - Opener\n59:30 Artist - Middle\n1:02:03 Artist - Closer\n",
+			duration:    4000,
+			want:        []Chapter{{1, "Artist - Opener", 0, 3570}, {2, "Artist - Middle", 3570, 3723}, {3, "Artist - Closer", 3723, 4000}},
+		},
+		{
+			name:        "numbered titles in brackets",
+			description: "1. First [0:00]\n2) Second (4:10)\n03. 1999 [8:20]",
+			duration:    600,
+			want:        []Chapter{{1, "First", 0, 250}, {2, "Second", 250, 500}, {3, "1999", 500, 600}},
+		},
+		{
+			name:        "out of order ends the list",
+			description: "0:00 One\n2:00 Two\n1:00 Back again\n3:00 Three",
+			duration:    600,
+			want:        []Chapter{{1, "One", 0, 120}, {2, "Two", 120, 600}},
+		},
+		{
+			name:        "duplicate ends the list",
+			description: "0:00 One\n2:00 Two\n2:00 Two again\n3:00 Three",
+			duration:    600,
+			want:        []Chapter{{1, "One", 0, 120}, {2, "Two", 120, 600}},
+		},
+		{
+			name:        "past the duration",
+			description: "0:00 One\n2:00 Two\n9:00 Bonus from the vinyl\n10:00 Hidden",
+			duration:    300,
+			want:        []Chapter{{1, "One", 0, 120}, {2, "Two", 120, 300}},
+		},
+		{
+			name:        "unknown duration",
+			description: "0:00 One\n2:00 Two",
+			want:        []Chapter{{1, "One", 0, 120}, {2, "Two", 120, 0}},
+		},
+		{name: "not starting at zero", description: "0:30 One\n2:00 Two", duration: 300},
+		{name: "single timestamp", description: "0:00 Full song", duration: 300},
+		{name: "only the first past the duration", description: "0:00 One\n6:00 Two", duration: 300},
+		{name: "timestamps inside words", description: "0:00abc\nat10:00pm", duration: 3000},
+		{name: "no timestamps", description: "Official video\nLyrics below", duration: 300},
+	}
+	for _, tt := range tests {
+		if got := parseDescriptionChapters(tt.description, tt.duration); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseDescriptionChapters =\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestChaptersFromInfo(t *testing.T) {
+	info := `{"description": "0:00 Ignored\n1:00 Also ignored", "chapters": [
+		{"start_time": 0, "end_time": 61.5, "title": " Intro "},
+		{"start_time": 61.5, "end_time": 180, "title": ""}
+	]}`
+	want := []Chapter{{1, "Intro", 0, 61.5}, {2, "Track 2", 61.5, 180}}
+	if got := chaptersFromInfo([]byte(info), 3*time.Minute); !reflect.DeepEqual(got, want) {
+		t.Errorf("chaptersFromInfo = %+v, want %+v", got, want)
+	}
+
+	// Without chapters in the info JSON the description is read
+	info = `{"description": "0:00 One\n1:00 Two"}`
+	want = []Chapter{{1, "One", 0, 60}, {2, "Two", 60, 180}}
+	if got := chaptersFromInfo([]byte(info), 3*time.Minute); !reflect.DeepEqual(got, want) {
+		t.Errorf("chaptersFromInfo = %+v, want %+v", got, want)
+	}
+	if got := chaptersFromInfo([]byte("{"), time.Minute); got != nil {
+		t.Errorf("chaptersFromInfo of invalid JSON = %+v", got)
+	}
+}
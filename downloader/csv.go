@@ -0,0 +1,273 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/postprocess"
+	"github.com/ktappdev/ytaudio/tagger"
+)
+
+// csvColumns maps the header names a song CSV may use onto the fields they fill
+var csvColumns = map[string]string{
+	"artist": "artist", "artists": "artist", "performer": "artist",
+	"title": "title", "song": "title",
+	"album": "album",
+	"track": "track", "track_number": "track", "tracknumber": "track",
+	"year": "year", "date": "year", "release_date": "year",
+	"url": "url", "video_id": "url", "target": "url", "link": "url",
+	"query": "query", "search": "query",
+	"start": "start", "end": "end", "format": "format",
+	"output_name": "output_name", "filename": "output_name", "file_name": "output_name",
+	"search_hint": "search_hint", "hint": "search_hint",
+	"exclude": "exclude",
+
+	// Column names of Exportify's Spotify playlist exports
+	"track_name": "title", "artist_name(s)": "artist", "album_name": "album", "album_release_date": "year",
+}
+
+var (
+	videoIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	yearPattern    = regexp.MustCompile(`^\d{4}(-\d{1,2}(-\d{1,2})?)?$`)
+)
+
+// parseSongCSV reads the songs of a CSV file. A header row naming known columns decides what each column holds;
+// without one, rows are read as Artist,Song[,Start,End] and single values as search queries.
+func parseSongCSV(data []byte, opts config.CSVOptions) ([]Item, []rowError, error) {
+	comma := opts.Comma()
+	if comma == 0 {
+		comma = detectDelimiter(data)
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+
+	var songs []Item
+	var invalid []rowError
+	var columns map[string]int
+	first := true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				invalid = append(invalid, rowError{pos: fmt.Sprintf("line %d", parseErr.StartLine), err: parseErr.Err})
+				continue
+			}
+			return nil, nil, fmt.Errorf("error reading CSV file: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if blankRecord(record) {
+			continue
+		}
+
+		if first {
+			first = false
+			if columns = csvHeader(record); columns != nil {
+				continue
+			}
+		}
+		layout := columns
+		if layout == nil {
+			layout = positionalColumns(len(record))
+		}
+
+		item, err := csvItem(record, layout)
+		if err != nil {
+			invalid = append(invalid, rowError{pos: fmt.Sprintf("line %d", line), err: err})
+			continue
+		}
+		songs = append(songs, item)
+	}
+	return songs, invalid, nil
+}
+
+// detectDelimiter picks the candidate delimiter that occurs most often in the first line, a comma if none does
+func detectDelimiter(data []byte) rune {
+	firstLine, _, _ := bytes.Cut(data, []byte("\n"))
+	comma, most := ',', 0
+	for _, candidate := range config.CSVDelimiters {
+		if n := bytes.Count(firstLine, []byte(string(candidate))); n > most {
+			comma, most = candidate, n
+		}
+	}
+	if comma != ',' {
+		log.Printf("Detected %q as the CSV delimiter", comma)
+	}
+	return comma
+}
+
+// csvHeader maps the fields of a header row onto their columns, or returns nil when the row names no known column.
+// The first column naming a field wins, unknown columns are ignored with a warning, except those of match files.
+func csvHeader(record []string) map[string]int {
+	columns := make(map[string]int)
+	var unknown []string
+	for col, name := range record {
+		name = normalizeColumn(name)
+		field, ok := csvColumns[name]
+		if !ok {
+			if name != "" && !reviewColumn(name) {
+				unknown = append(unknown, record[col])
+			}
+			continue
+		}
+		if _, seen := columns[field]; !seen {
+			columns[field] = col
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	log.Println("Reading columns by header row")
+	if len(unknown) > 0 {
+		log.Printf("Ignoring unknown CSV columns: %s", strings.Join(unknown, ", "))
+	}
+	return columns
+}
+
+// normalizeColumn turns a column name such as "Output Name" into the form csvColumns uses
+func normalizeColumn(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+}
+
+// positionalColumns is the layout of a row in a file without a header
+func positionalColumns(fields int) map[string]int {
+	if fields == 1 {
+		return map[string]int{"query": 0}
+	}
+	return map[string]int{"artist": 0, "title": 1, "start": 2, "end": 3}
+}
+
+// csvItem turns a row into an item, collecting every problem with it into one error
+func csvItem(record []string, columns map[string]int) (Item, error) {
+	field := func(name string) string {
+		col, ok := columns[name]
+		if !ok {
+			return ""
+		}
+		return csvField(record, col)
+	}
+
+	var problems []string
+	item := Item{
+		Query:      field("query"),
+		SearchHint: field("search_hint"),
+		Exclude:    splitList(field("exclude")),
+		Metadata: tagger.Metadata{
+			Artist: field("artist"),
+			Title:  field("title"),
+			Album:  field("album"),
+		},
+	}
+
+	if value := field("track"); value != "" {
+		// "3/12" is how some exports write the track of a 12 track album
+		number, _, _ := strings.Cut(value, "/")
+		if track, err := strconv.Atoi(strings.TrimSpace(number)); err == nil && track > 0 {
+			item.Metadata.Track = track
+		} else {
+			problems = append(problems, fmt.Sprintf("invalid track number %q", value))
+		}
+	}
+	if value := field("year"); value != "" {
+		if yearPattern.MatchString(value) {
+			item.Metadata.Year = value[:4]
+		} else {
+			problems = append(problems, fmt.Sprintf("invalid year %q (expected YYYY or YYYY-MM-DD)", value))
+		}
+	}
+	if timeRange, err := config.ParseTimeRange(field("start"), field("end")); err == nil {
+		item.Range = timeRange
+	} else {
+		problems = append(problems, err.Error())
+	}
+	if value := field("url"); value != "" {
+		if target, err := csvTarget(value); err == nil {
+			item.Target = target
+		} else {
+			problems = append(problems, err.Error())
+		}
+	}
+	if value := field("format"); value != "" {
+		if config.ValidAudioFormat(value) {
+			item.Format = strings.ToLower(value)
+		} else {
+			problems = append(problems, fmt.Sprintf("unknown format %q (expected one of %s)", value, strings.Join(config.AudioFormats, ", ")))
+		}
+	}
+	if value := field("output_name"); value != "" {
+		if postprocess.IsAudioFile(value) {
+			value = strings.TrimSuffix(value, filepath.Ext(value))
+		}
+		if strings.ContainsAny(value, `/\`) {
+			problems = append(problems, fmt.Sprintf("output name %q must not contain a path separator", value))
+		}
+		item.OutputName = value
+	}
+
+	if item.Query == "" {
+		item.Query = songQuery(item.Metadata.Artist, item.Metadata.Title)
+	}
+	if item.Query == "" && item.Target == "" {
+		problems = append(problems, "no title, query or URL")
+	}
+
+	if len(problems) > 0 {
+		return item, errors.New(strings.Join(problems, "; "))
+	}
+	return item, nil
+}
+
+// csvTarget checks that a url column holds a video URL or a bare video ID
+func csvTarget(value string) (string, error) {
+	if videoIDPattern.MatchString(value) {
+		return value, nil
+	}
+	if u, err := url.Parse(value); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return value, nil
+	}
+	return "", fmt.Errorf("invalid video URL or ID %q", value)
+}
+
+// splitList splits a cell listing several values, separated by commas or semicolons
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// blankRecord reports whether every field of a row is empty
+func blankRecord(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// csvField returns the trimmed value of a column, or an empty string when the row is shorter
+func csvField(record []string, col int) string {
+	if col < 0 || col >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[col])
+}
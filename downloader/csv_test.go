@@ -0,0 +1,134 @@
+package downloader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/tagger"
+)
+
+func TestParseSongCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		opts    config.CSVOptions
+		want    []Item
+		invalid []string // positions of the malformed rows
+	}{
+		{
+			name: "positional",
+			data: "Daft Punk,One More Time\nMuse,Uprising,1:00,2:30\n\nRadiohead - Karma Police\n",
+			want: []Item{
+				{Query: "Daft Punk - One More Time", Metadata: tagger.Metadata{Artist: "Daft Punk", Title: "One More Time"}},
+				{Query: "Muse - Uprising", Metadata: tagger.Metadata{Artist: "Muse", Title: "Uprising"}, Range: config.TimeRange{Start: 60, End: 150}},
+				{Query: "Radiohead - Karma Police"},
+			},
+		},
+		{
+			name: "header",
+			data: "Title,Artist,Album,Track,Year,Video ID,Format,Output Name,Search Hint,Exclude,Notes\n" +
+				"One More Time,Daft Punk,Discovery,1/14,2001-03-12,FGBhQbmPwH8,MP3,one-more-time.mp3,live,remix; cover,favourite\n",
+			want: []Item{{
+				Target:     "FGBhQbmPwH8",
+				Query:      "Daft Punk - One More Time",
+				Metadata:   tagger.Metadata{Artist: "Daft Punk", Title: "One More Time", Album: "Discovery", Track: 1, Year: "2001"},
+				Format:     "mp3",
+				OutputName: "one-more-time",
+				SearchHint: "live",
+				Exclude:    []string{"remix", "cover"},
+			}},
+		},
+		{
+			name: "exportify",
+			data: "Track URI,Track Name,Artist Name(s),Album Name,Album Release Date\n" +
+				"spotify:track:x,Uprising,Muse,The Resistance,2009-09-14\n",
+			want: []Item{{Query: "Muse - Uprising", Metadata: tagger.Metadata{Artist: "Muse", Title: "Uprising", Album: "The Resistance", Year: "2009"}}},
+		},
+		{
+			name: "detected delimiter",
+			data: "artist;title;url\nAC/DC;Thunderstruck, live;https://youtu.be/v2AC41dglnM\n",
+			want: []Item{{
+				Target:   "https://youtu.be/v2AC41dglnM",
+				Query:    "AC/DC - Thunderstruck, live",
+				Metadata: tagger.Metadata{Artist: "AC/DC", Title: "Thunderstruck, live"},
+			}},
+		},
+		{
+			name: "tab delimiter",
+			data: "query\tstart\nlofi beats\t1h\n",
+			opts: config.CSVOptions{Delimiter: "tab"},
+			want: []Item{{Query: "lofi beats", Range: config.TimeRange{Start: 3600}}},
+		},
+		{
+			name: "invalid rows",
+			data: "artist,title,track,year,url,format,start,end,output_name\n" +
+				"Muse,Uprising,,,,,,,\n" +
+				"Muse,Uprising,first,,,,,,\n" +
+				"Muse,Uprising,,99,,,,,\n" +
+				"Muse,Uprising,,,not a url,,,,\n" +
+				"Muse,Uprising,,,,wma,,,\n" +
+				"Muse,Uprising,,,,,2:00,1:00,\n" +
+				"Muse,Uprising,,,,,,,a/b\n" +
+				",,,,,,,,\n" +
+				",,1,,,,,,\n" +
+				"Muse,\"Unterminated\n",
+			want:    []Item{{Query: "Muse - Uprising", Metadata: tagger.Metadata{Artist: "Muse", Title: "Uprising"}}},
+			invalid: []string{"line 3", "line 4", "line 5", "line 6", "line 7", "line 8", "line 10", "line 11"},
+		},
+	}
+	for _, tt := range tests {
+		got, invalid, err := parseSongCSV([]byte(tt.data), tt.opts)
+		if err != nil {
+			t.Errorf("%s: parseSongCSV error = %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseSongCSV =\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+		var positions []string
+		for _, row := range invalid {
+			positions = append(positions, row.pos)
+		}
+		if strings.Join(positions, ",") != strings.Join(tt.invalid, ",") {
+			t.Errorf("%s: invalid rows %v, want %v", tt.name, invalid, tt.invalid)
+		}
+	}
+}
+
+func TestDetectDelimiter(t *testing.T) {
+	tests := []struct {
+		data string
+		want rune
+	}{
+		{"artist,title\n", ','},
+		{"artist;title;album\nA,B;C;D\n", ';'},
+		{"artist\ttitle\n", '\t'},
+		{"artist|title|album\n", '|'},
+		{"a,b;c\n", ','},
+		{"lofi beats\n", ','},
+		{"", ','},
+	}
+	for _, tt := range tests {
+		if got := detectDelimiter([]byte(tt.data)); got != tt.want {
+			t.Errorf("detectDelimiter(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestCSVHeader(t *testing.T) {
+	tests := []struct {
+		record []string
+		want   map[string]int
+	}{
+		{[]string{"Daft Punk", "One More Time"}, nil},
+		{[]string{"Artist", "Song", "Song"}, map[string]int{"artist": 0, "title": 1}},
+		{[]string{" Output-Name ", "link", "candidate_1"}, map[string]int{"output_name": 0, "url": 1}},
+	}
+	for _, tt := range tests {
+		if got := csvHeader(tt.record); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("csvHeader(%q) = %v, want %v", tt.record, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package downloader
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// freeSpace is not implemented on this platform, so free space checks are skipped
+func freeSpace(dir string) (int64, error) {
+	return 0, fmt.Errorf("free space checks are not supported on %s", runtime.GOOS)
+}
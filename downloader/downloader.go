@@ -2,293 +2,361 @@ package downloader
 
 import (
 	"bufio"
-	"encoding/csv"
+	"context"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
-	"sync"
-	"time"
 
 	"github.com/ktappdev/ytaudio/config"
-	"github.com/ktappdev/ytaudio/youtube"
+	"github.com/ktappdev/ytaudio/postprocess"
 )
 
-// ProcessFile reads queries from a file and processes each one
-func ProcessFile(cfg *config.Config) error {
+// ProcessFile reads queries or URLs from a file, one per line, and downloads them concurrently.
+// A path of "-" streams them from standard input instead, see ProcessStream.
+func ProcessFile(ctx context.Context, cfg *config.Config) ([]*DownloadResult, error) {
+	if cfg.FilePath == "-" {
+		return ProcessStream(ctx, cfg, os.Stdin)
+	}
+
 	log.Printf("Reading file: %s", cfg.FilePath)
-	content, err := os.ReadFile(cfg.FilePath)
+	file, err := os.Open(cfg.FilePath)
 	if err != nil {
-		return fmt.Errorf("error reading file: %w", err)
+		return nil, fmt.Errorf("error reading file: %w", err)
 	}
+	defer file.Close()
 
-	queries := strings.Split(string(content), "\n")
-	log.Printf("Found %d queries in file", len(queries))
+	var items []Item
+	err = scanQueries(file, func(query string) bool {
+		items = append(items, Item{Query: query})
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading file: %w", err)
+	}
+	log.Printf("Found %d queries in file", len(items))
 
-	for i, query := range queries {
-		query = strings.TrimSpace(query)
-		if query == "" {
-			log.Printf("Skipping empty query at line %d", i+1)
-			continue
-		}
-		log.Printf("Processing query %d: %s", i+1, query)
-		videos, err := youtube.SearchVideos(query, cfg.APIKey)
-		if err != nil {
-			log.Printf("Error searching for '%s': %v", query, err)
-			continue
-		}
-		if len(videos) > 0 {
-			log.Printf("Found %d videos for query '%s', downloading first result", len(videos), query)
-			if err := DownloadAudio(videos[0].ID); err != nil {
-				log.Printf("Error processing '%s': %v", query, err)
-			}
-		} else {
-			log.Printf("No videos found for query: %s", query)
-		}
+	dl, err := New(ctx, cfg)
+	if err != nil {
+		return nil, err
 	}
+	opts := OptionsFromConfig(cfg)
 
-	return nil
+	jobs, err := RunBatch(ctx, dl, items, opts, BatchFromConfig(cfg))
+	downloads, _ := Outcome(jobs)
+	return downloads, err
 }
 
-// checkYtDlpInstalled verifies that yt-dlp is available on the system
-func checkYtDlpInstalled() error {
-	cmd := exec.Command("yt-dlp", "--version")
-	err := cmd.Run()
+// ProcessStream downloads the queries or URLs read from r, one per line. Each line is searched as soon as
+// it arrives, so ytaudio can sit at the end of a pipe, and the input is never held in memory as a whole.
+func ProcessStream(ctx context.Context, cfg *config.Config, r io.Reader) ([]*DownloadResult, error) {
+	log.Println("Reading queries from standard input")
+	dl, err := New(ctx, cfg)
 	if err != nil {
-		return fmt.Errorf("yt-dlp not found. Please install it with: brew install yt-dlp")
+		return nil, err
 	}
-	return nil
-}
+	opts := OptionsFromConfig(cfg)
 
-// DownloadAudio downloads audio using yt-dlp (much more reliable than the Go library)
-func DownloadAudio(videoID string) error {
-	log.Printf("Initializing yt-dlp download for video ID: %s", videoID)
+	items := make(chan Item)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(items)
+		readErr <- scanQueries(r, func(query string) bool {
+			select {
+			case items <- Item{Query: query}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
 
-	// Check if yt-dlp is installed
-	if err := checkYtDlpInstalled(); err != nil {
-		return err
+	jobs, err := StreamBatch(ctx, dl, items, opts, BatchFromConfig(cfg))
+	downloads, _ := Outcome(jobs)
+	// After a cancellation the reader may still be waiting for a line that never comes
+	select {
+	case scanErr := <-readErr:
+		if scanErr != nil && err == nil {
+			err = fmt.Errorf("error reading standard input: %w", scanErr)
+		}
+	default:
 	}
+	return downloads, err
+}
 
-	// Construct YouTube URL from video ID
-	videoURL := fmt.Sprintf("https://www.youtube.com/watch?v=%s", videoID)
-	downloadPath := getDownloadPath()
-
-	log.Printf("Downloading from: %s", videoURL)
-	log.Printf("Download path: %s", downloadPath)
+// scanQueries calls add with every non-empty line of r until add returns false
+func scanQueries(r io.Reader, add func(query string) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		query := strings.TrimSpace(scanner.Text())
+		if query == "" {
+			log.Printf("Skipping empty query at line %d", line)
+			continue
+		}
+		if !add(query) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
 
-	// yt-dlp command with options for audio-only download (more efficient)
-	cmd := exec.Command("yt-dlp",
-		"-f", "bestaudio", // Download only audio stream (more efficient)
-		"--extract-audio", // Extract audio only
-		"--audio-format", "mp3", // Convert to MP3
-		"--audio-quality", "0", // Best quality
-		"--output", filepath.Join(downloadPath, "%(title)s.%(ext)s"), // Output template
-		"--no-playlist", // Don't download playlists
-		"--embed-metadata", // Embed metadata
-		"--add-metadata", // Add metadata
-		videoURL,
-	)
-
-	// Create a pipe to capture output for progress monitoring
-	stdout, err := cmd.StdoutPipe()
+// RetryFailed downloads the items of a failures file again. Queries are searched anew, so a different
+// search backend or ranking strategy can pick another video than the one that failed.
+func RetryFailed(ctx context.Context, cfg *config.Config) ([]*DownloadResult, error) {
+	items, err := ReadFailures(cfg.RetryFailed)
 	if err != nil {
-		return fmt.Errorf("error creating stdout pipe: %w", err)
+		return nil, err
 	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("error creating stderr pipe: %w", err)
+	if len(items) == 0 {
+		log.Printf("No failed items in %s", cfg.RetryFailed)
+		return nil, nil
 	}
+	log.Printf("Retrying %d failed items from %s", len(items), cfg.RetryFailed)
 
-	// Start the command
-	log.Println("Starting yt-dlp download...")
-	startTime := time.Now()
-	if startErr := cmd.Start(); startErr != nil {
-		return fmt.Errorf("error starting yt-dlp: %w", err)
+	dl, err := New(ctx, cfg)
+	if err != nil {
+		return nil, err
 	}
+	opts := OptionsFromConfig(cfg)
 
-	// Monitor progress from stderr (yt-dlp outputs progress to stderr)
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		progressRegex := regexp.MustCompile(`\[(\d+\.\d+)%\]`)
-
-		for scanner.Scan() {
-			line := scanner.Text()
-			log.Printf("yt-dlp: %s", line)
-
-			// Extract progress percentage
-			if matches := progressRegex.FindStringSubmatch(line); len(matches) > 1 {
-				if progress, parseErr := strconv.ParseFloat(matches[1], 64); parseErr == nil {
-					fmt.Printf("\rProgress: %.1f%%", progress)
-				}
-			}
-		}
-	}()
-
-	// Also capture stdout
-	go func() {
-		scanner := bufio.NewScanner(stdout)
-		for scanner.Scan() {
-			log.Printf("yt-dlp stdout: %s", scanner.Text())
-		}
-	}()
+	// Queries are searched with the suffix recorded in the failures file, batch options do not add another
+	jobs, err := RunBatch(ctx, dl, items, opts, BatchFromConfig(cfg))
+	downloads, _ := Outcome(jobs)
+	return downloads, err
+}
 
-	// Wait for the command to complete
-	err = cmd.Wait()
+// DownloadAudio downloads a single item through the given backend and runs the post-download steps.
+// Everything happens in a staging directory, the output directory only ever sees finished files.
+func DownloadAudio(ctx context.Context, dl Downloader, item Item, opts Options) (*DownloadResult, error) {
+	staged, err := stageDownload(ctx, dl, item, opts)
 	if err != nil {
-		return fmt.Errorf("yt-dlp download failed: %w", err)
+		return nil, err
 	}
+	defer staged.close(opts)
+	return staged.finish(ctx, opts)
+}
 
-	duration := time.Since(startTime)
-	log.Printf("Download completed successfully in %v", duration)
-	fmt.Printf("\nDownload completed in %v\n", duration)
-	fmt.Printf("Files saved to: %s\n", downloadPath)
-
-	return nil
+// itemOptions applies the overrides of an item, its time range and audio format, to the batch options
+func itemOptions(item Item, opts Options) Options {
+	opts.Range = itemRange(item, opts)
+	if item.Format != "" {
+		opts.AudioFormat = item.Format
+	}
+	return opts
 }
 
-// DownloadSongList downloads multiple songs from a comma-separated list or CSV file with concurrency
-func DownloadSongList(cfg *config.Config) error {
-	log.Printf("Parsing song list with %d concurrent downloads", cfg.ConcurrentDownloads)
+// stagedDownload is a download waiting in its staging directory to be processed and moved into place
+type stagedDownload struct {
+	item   Item
+	dir    string
+	result *DownloadResult
+}
 
-	var cleanSongs []string
-	var err error
+// stageDownload downloads an item into a new staging directory and checks it against the limits
+func stageDownload(ctx context.Context, dl Downloader, item Item, opts Options) (*stagedDownload, error) {
+	log.Printf("Initializing download for: %s", item.Target)
 
-	if cfg.SongCSVFile != "" {
-		// Read songs from CSV file
-		cleanSongs, err = readSongsFromCSV(cfg.SongCSVFile)
-		if err != nil {
-			return fmt.Errorf("error reading CSV file: %w", err)
-		}
-	} else {
-		// Split the comma-separated list and clean up each song
-		songs := strings.Split(cfg.SongList, ",")
-		for _, song := range songs {
-			song = strings.TrimSpace(song)
-			if song != "" {
-				cleanSongs = append(cleanSongs, song)
-			}
-		}
+	if err := opts.Guard.Admit(item.Target); err != nil {
+		return nil, err
 	}
 
-	if len(cleanSongs) == 0 {
-		return fmt.Errorf("no valid songs found in the list")
+	opts = itemOptions(item, opts)
+	if !opts.Range.IsZero() {
+		log.Printf("Downloading %s of %s", opts.Range, item.Target)
 	}
 
-	log.Printf("Found %d songs to download", len(cleanSongs))
-
-	// Create channels for job distribution
-	jobs := make(chan string, len(cleanSongs))
-	results := make(chan error, len(cleanSongs))
-
-	// Start worker goroutines
-	var wg sync.WaitGroup
-	for w := 1; w <= cfg.ConcurrentDownloads; w++ {
-		wg.Add(1)
-		go songWorker(jobs, results, &wg, cfg.APIKey)
+	dir, err := newStagingDir(opts.OutputDir)
+	if err != nil {
+		return nil, err
 	}
+	stagedOpts := opts
+	stagedOpts.OutputDir = dir
 
-	// Send jobs
-	for _, song := range cleanSongs {
-		jobs <- song
+	result, err := fetch(ctx, dl, item, stagedOpts)
+	if err == nil {
+		result.Query = item.Query
+		err = enforceLimits(item.Target, result, opts)
+	}
+	if err != nil {
+		removeStagingDir(dir)
+		return nil, err
 	}
-	close(jobs)
-
-	// Wait for all workers to finish
-	wg.Wait()
-	close(results)
 
-	// Collect and report results
-	var errors []error
-	for err := range results {
+	if opts.SponsorBlock.Enabled() {
+		sidecar, err := writeSponsorBlockSidecar(result, opts.SponsorBlock)
 		if err != nil {
-			log.Printf("Error downloading song: %v", err)
-			errors = append(errors, err)
+			log.Printf("Error recording SponsorBlock segments: %v", err)
+		} else {
+			result.Sidecars = append(result.Sidecars, sidecar)
 		}
 	}
+	return &stagedDownload{item: item, dir: dir, result: result}, nil
+}
 
-	log.Printf("Completed downloading %d songs with %d errors", len(cleanSongs), len(errors))
+// finish post-processes and tags the download, moves it into the output directory and runs the hooks
+func (s *stagedDownload) finish(ctx context.Context, opts Options) (*DownloadResult, error) {
+	item, result := s.item, s.result
+
+	// Chaptered videos are cut first so trimming and normalization apply to each track on its own,
+	// clips are left alone since the chapters describe the whole video
+	if opts.Chapters.Split && result.Range == nil {
+		if chapters := chaptersFromInfo(result.Info, result.Duration); len(chapters) > 1 {
+			if err := splitChapters(ctx, item, result, chapters, opts); err != nil {
+				return nil, err
+			}
+			log.Printf("Download completed successfully in %v", result.Elapsed)
+			fmt.Printf("\nDownload completed in %v\n", result.Elapsed)
+			fmt.Printf("Split into %d tracks in: %s\n", len(result.Tracks), filepath.Dir(result.Tracks[0].FilePath))
+			return result, nil
+		}
+		log.Printf("No chapters found for %s, keeping a single file", result.VideoID)
+	}
 
-	if len(errors) > 0 {
-		return fmt.Errorf("encountered %d errors during download", len(errors))
+	if err := processDownload(ctx, item, result, opts); err != nil {
+		return nil, err
+	}
+	if err := commitFile(result, item.OutputName, opts); err != nil {
+		return nil, err
+	}
+	if err := runItemHooks(ctx, result, opts); err != nil {
+		return nil, err
 	}
 
-	return nil
+	log.Printf("Download completed successfully in %v", result.Elapsed)
+	fmt.Printf("\nDownload completed in %v\n", result.Elapsed)
+	fmt.Printf("File saved to: %s\n", result.FilePath)
+
+	return result, nil
 }
 
-// songWorker processes individual songs from the job queue
-func songWorker(jobs <-chan string, results chan<- error, wg *sync.WaitGroup, apiKey string) {
-	defer wg.Done()
-	for song := range jobs {
-		log.Printf("Processing song: %s", song)
+// close counts the download against the batch budget and removes whatever is left in the staging directory
+func (s *stagedDownload) close(opts Options) {
+	opts.Guard.Record(s.result.diskUsage())
+	removeStagingDir(s.dir)
+}
 
-		// Search for the song
-		videos, err := youtube.SearchVideos(song+" audio", apiKey)
+// processDownload post-processes and tags a file while it is still in the staging directory
+func processDownload(ctx context.Context, item Item, result *DownloadResult, opts Options) error {
+	if opts.PostProcess.Enabled() {
+		report, err := postprocess.Process(ctx, result.FilePath, opts.PostProcess)
 		if err != nil {
-			log.Printf("Error searching for '%s': %v", song, err)
-			results <- fmt.Errorf("search failed for '%s': %w", song, err)
-			continue
+			return fmt.Errorf("post-processing failed for %s: %w", result.FilePath, err)
 		}
-
-		if len(videos) == 0 {
-			log.Printf("No videos found for song: %s", song)
-			results <- fmt.Errorf("no videos found for '%s'", song)
-			continue
+		result.PostProcess = report
+		if err := result.refreshFileInfo(); err != nil {
+			return err
 		}
+	}
 
-		// Download the first result
-		log.Printf("Downloading first result for '%s': %s", song, videos[0].Title)
-		err = DownloadAudio(videos[0].ID)
-		if err != nil {
-			log.Printf("Error downloading '%s': %v", song, err)
-			results <- fmt.Errorf("download failed for '%s': %w", song, err)
-		} else {
-			log.Printf("Successfully downloaded: %s", song)
-			results <- nil
+	if opts.Tags.Enabled || opts.Artwork.Enabled() {
+		if err := writeTags(ctx, item, result, opts); err != nil {
+			return fmt.Errorf("tagging failed for %s: %w", result.FilePath, err)
 		}
 	}
+	return nil
 }
 
-// readSongsFromCSV reads songs from a CSV file with Artist,Song format
-func readSongsFromCSV(filePath string) ([]string, error) {
-	log.Printf("Reading songs from CSV file: %s", filePath)
+// commitFile moves a finished download from the staging directory into the output directory under its title,
+// or under name when the item asked for one, picking a name no other worker uses; sidecars named after the file follow it
+func commitFile(result *DownloadResult, name string, opts Options) error {
+	if err := verifyStaged(result); err != nil {
+		return err
+	}
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("error opening CSV file: %w", err)
+	title := name
+	if title == "" {
+		title = result.Title
+	}
+	if result.Range != nil && name == "" {
+		// Clips of the same video carry their range so they do not collide
+		title += " [" + result.Range.Label() + "]"
 	}
-	defer file.Close()
 
-	reader := csv.NewReader(file)
-	records, err := reader.ReadAll()
+	staged := result.FilePath
+	path, err := opts.Names.Place(staged, opts.OutputDir, title, result.VideoID)
 	if err != nil {
-		return nil, fmt.Errorf("error reading CSV file: %w", err)
+		return err
 	}
+	result.FilePath = path
 
-	var songs []string
-	for i, record := range records {
-		// Skip header row if it exists
-		if i == 0 && len(record) >= 2 && (strings.ToLower(record[0]) == "artist" || strings.ToLower(record[1]) == "song") {
-			log.Println("Skipping header row")
+	stagedBase := strings.TrimSuffix(staged, filepath.Ext(staged))
+	finalBase := strings.TrimSuffix(path, filepath.Ext(path))
+	for i, sidecar := range result.Sidecars {
+		if !strings.HasPrefix(sidecar, stagedBase+".") {
 			continue
 		}
+		moved := finalBase + strings.TrimPrefix(sidecar, stagedBase)
+		if err := os.Rename(sidecar, moved); err != nil {
+			log.Printf("Error moving %s: %v", sidecar, err)
+			continue
+		}
+		result.Sidecars[i] = moved
+	}
+	return nil
+}
+
+// verifyStaged checks that a staged download is a non-empty file before it is moved into place
+func verifyStaged(result *DownloadResult) error {
+	if err := result.refreshFileInfo(); err != nil {
+		return err
+	}
+	if result.FileSize == 0 {
+		return fmt.Errorf("download of %s produced an empty file", result.VideoID)
+	}
+	return nil
+}
+
+// songFilePath returns the song file given with --import or --csv-file, or an empty string for a song list
+func songFilePath(cfg *config.Config) string {
+	if cfg.ImportFile != "" {
+		return cfg.ImportFile
+	}
+	return cfg.SongCSVFile
+}
+
+// DownloadSongList downloads multiple songs from a comma-separated list, CSV file or playlist export with concurrency
+func DownloadSongList(ctx context.Context, cfg *config.Config) ([]*DownloadResult, error) {
+	log.Printf("Parsing song list with %d concurrent downloads", cfg.ConcurrentDownloads)
 
-		if len(record) >= 2 {
-			artist := strings.TrimSpace(record[0])
-			song := strings.TrimSpace(record[1])
-			if artist != "" && song != "" {
-				songQuery := fmt.Sprintf("%s - %s", artist, song)
-				songs = append(songs, songQuery)
-				log.Printf("Added song: %s", songQuery)
+	var cleanSongs []Item
+	var err error
+
+	if path := songFilePath(cfg); path != "" {
+		cleanSongs, err = readSongFile(path, cfg.CSV)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Split the comma-separated list and clean up each song
+		songs := strings.Split(cfg.SongList, ",")
+		for _, song := range songs {
+			song = strings.TrimSpace(song)
+			if song != "" {
+				cleanSongs = append(cleanSongs, Item{Query: song})
 			}
 		}
 	}
 
-	log.Printf("Successfully read %d songs from CSV file", len(songs))
-	return songs, nil
+	if len(cleanSongs) == 0 {
+		return nil, fmt.Errorf("no valid songs found in the list")
+	}
+
+	log.Printf("Found %d songs to download", len(cleanSongs))
+
+	dl, err := New(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	opts := OptionsFromConfig(cfg)
+
+	batch := BatchFromConfig(cfg)
+	batch.SearchSuffix = " audio"
+	jobs, err := RunBatch(ctx, dl, cleanSongs, opts, batch)
+	downloads, _ := Outcome(jobs)
+	return downloads, err
 }
 
 // getDownloadPath returns the path to save downloaded files
@@ -308,14 +376,3 @@ func getDownloadPath() string {
 
 	return downloadPath
 }
-
-// sanitizeFileName removes or replaces characters that are invalid in file names
-func sanitizeFileName(fileName string) string {
-	log.Printf("Sanitizing file name: %s", fileName)
-	invalid := []string{"/", "\\", ":", "*", "?", "\"", "<", ">", "|"}
-	for _, char := range invalid {
-		fileName = strings.ReplaceAll(fileName, char, "_")
-	}
-	log.Printf("Sanitized file name: %s", fileName)
-	return fileName
-}
\ No newline at end of file
@@ -0,0 +1,230 @@
+package downloader
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/engine"
+	"github.com/ktappdev/ytaudio/tagger"
+	"github.com/ktappdev/ytaudio/youtube"
+)
+
+// Error classes of failed items, coarser than the messages so failures can be grouped and filtered
+const (
+	ClassCancelled   = "cancelled"
+	ClassSkipped     = "skipped"
+	ClassCorrupted   = "corrupted"
+	ClassNotFound    = "not_found"
+	ClassQuota       = "quota"
+	ClassSearch      = "search"
+	ClassDownload    = "download"
+	ClassPostProcess = "postprocess"
+)
+
+// Failure is an item a batch could not download, as listed in the failures file
+type Failure struct {
+	Item    Item   `json:"item"`
+	VideoID string `json:"video_id,omitempty"` // the video that was tried, if the search got that far
+	Stage   string `json:"stage"`
+	Class   string `json:"class"`
+	Error   string `json:"error"`
+}
+
+// failureColumns is the header of the CSV failures file. It starts with the columns of a song CSV,
+// so failed songs can also be passed to --csv-file.
+var failureColumns = []string{"artist", "title", "album", "track", "year", "query", "target", "start", "end",
+	"format", "output_name", "search_hint", "exclude", "search_suffix", "video_id", "stage", "class", "error"}
+
+// Failures lists the failed jobs of a batch with the input they were submitted with; skipped jobs are left out.
+// Queries without a suffix of their own are recorded with searchSuffix, the suffix of the batch.
+func Failures(jobs []*engine.Job[*Task], searchSuffix string) []Failure {
+	var failures []Failure
+	for _, job := range jobs {
+		if job.Err == nil || skipOf(job.Err) != nil {
+			continue
+		}
+		failure := Failure{
+			Item:  job.Value.Input,
+			Stage: job.Stage,
+			Class: ErrorClass(job.Err, job.Stage),
+			Error: job.Err.Error(),
+		}
+		if job.Value.Item.Target != job.Value.Input.Target {
+			failure.VideoID = job.Value.Item.Target
+		}
+		if failure.Item.Query != "" && failure.Item.SearchSuffix == "" {
+			failure.Item.SearchSuffix = strings.TrimSpace(searchSuffix)
+		}
+		failures = append(failures, failure)
+	}
+	return failures
+}
+
+// ErrorClass sorts the error of an item that failed in the given stage into one of the Class constants
+func ErrorClass(err error, stage string) string {
+	var skip *SkipError
+	var corrupt *CorruptError
+	var apiErr *youtube.APIError
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrFailFast):
+		return ClassCancelled
+	case errors.As(err, &skip):
+		return ClassSkipped
+	case errors.As(err, &corrupt):
+		return ClassCorrupted
+	case errors.Is(err, ErrNoResults):
+		return ClassNotFound
+	case errors.As(err, &apiErr) && apiErr.QuotaExceeded():
+		return ClassQuota
+	}
+	switch stage {
+	case StageResolve:
+		return ClassSearch
+	case StagePostProcess:
+		return ClassPostProcess
+	default:
+		return ClassDownload
+	}
+}
+
+// WriteFailures writes failed items to path, as JSON when it ends in .json and as CSV otherwise
+func WriteFailures(path string, failures []Failure) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating failures file directory: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if failures == nil {
+			failures = []Failure{}
+		}
+		data, err := json.MarshalIndent(failures, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding failures: %w", err)
+		}
+		return os.WriteFile(path, data, 0644)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating failures file: %w", err)
+	}
+	writer := csv.NewWriter(file)
+	writer.Write(failureColumns)
+	for _, f := range failures {
+		item := f.Item
+		var track string
+		if item.Metadata.Track > 0 {
+			track = strconv.Itoa(item.Metadata.Track)
+		}
+		writer.Write([]string{
+			item.Metadata.Artist, item.Metadata.Title, item.Metadata.Album, track, item.Metadata.Year,
+			item.Query, item.Target, formatRangeBound(item.Range.Start), formatRangeBound(item.Range.End),
+			item.Format, item.OutputName, item.SearchHint, strings.Join(item.Exclude, ", "), item.SearchSuffix,
+			f.VideoID, f.Stage, f.Class, f.Error,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing failures file: %w", err)
+	}
+	return file.Close()
+}
+
+// ReadFailures reads the items of a failures file written by WriteFailures
+func ReadFailures(path string) ([]Item, error) {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading failures file: %w", err)
+		}
+		var failures []Failure
+		if err := json.Unmarshal(data, &failures); err != nil {
+			return nil, fmt.Errorf("error parsing failures file %s: %w", path, err)
+		}
+		items := make([]Item, len(failures))
+		for i, f := range failures {
+			items[i] = f.Item
+		}
+		return items, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading failures file: %w", err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing failures file %s: %w", path, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	field := func(record []string, name string) string {
+		col, ok := columns[name]
+		if !ok {
+			return ""
+		}
+		return csvField(record, col)
+	}
+
+	var items []Item
+	for i, record := range records[1:] {
+		line := i + 2
+		timeRange, err := config.ParseTimeRange(field(record, "start"), field(record, "end"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d of %s: %w", line, path, err)
+		}
+		var track int
+		if value := field(record, "track"); value != "" {
+			if track, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("line %d of %s: invalid track number %q", line, path, value)
+			}
+		}
+		item := Item{
+			Query:        field(record, "query"),
+			Target:       field(record, "target"),
+			Range:        timeRange,
+			Format:       field(record, "format"),
+			OutputName:   field(record, "output_name"),
+			SearchHint:   field(record, "search_hint"),
+			Exclude:      splitList(field(record, "exclude")),
+			SearchSuffix: field(record, "search_suffix"),
+			Metadata: tagger.Metadata{
+				Artist: field(record, "artist"),
+				Title:  field(record, "title"),
+				Album:  field(record, "album"),
+				Track:  track,
+				Year:   field(record, "year"),
+			},
+		}
+		if item.Query == "" && item.Target == "" {
+			return nil, fmt.Errorf("line %d of %s has neither a query nor a target", line, path)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// formatRangeBound writes a range bound in seconds, leaving unset bounds empty
+func formatRangeBound(seconds float64) string {
+	if seconds == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
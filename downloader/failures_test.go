@@ -0,0 +1,94 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/tagger"
+)
+
+func TestFailuresRoundTrip(t *testing.T) {
+	failures := []Failure{
+		{
+			Item: Item{
+				Query:      "Daft Punk - One More Time",
+				Metadata:   tagger.Metadata{Artist: "Daft Punk", Title: "One More Time", Album: "Discovery", Track: 1, Year: "2001"},
+				Range:      config.TimeRange{Start: 12.5, End: 90},
+				Format:     "flac",
+				OutputName: "one, more \"time\"",
+				SearchHint: "live",
+				Exclude:    []string{"remix", "cover"},
+
+				SearchSuffix: "audio",
+			},
+			VideoID: "FGBhQbmPwH8",
+			Stage:   StageDownload,
+			Class:   ClassDownload,
+			Error:   "HTTP Error 403:\nForbidden",
+		},
+		{
+			Item:  Item{Target: "https://youtu.be/L93-7vRfxNs"},
+			Stage: StagePostProcess,
+			Class: ClassPostProcess,
+			Error: "ffmpeg exited",
+		},
+	}
+	want := []Item{failures[0].Item, failures[1].Item}
+
+	for _, name := range []string{"failed.csv", "failed.json", "nested/dir/failed.CSV"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := WriteFailures(path, failures); err != nil {
+			t.Fatalf("WriteFailures(%s): %v", name, err)
+		}
+		items, err := ReadFailures(path)
+		if err != nil {
+			t.Fatalf("ReadFailures(%s): %v", name, err)
+		}
+		if !reflect.DeepEqual(items, want) {
+			t.Errorf("%s round trip =\n%+v\nwant\n%+v", name, items, want)
+		}
+
+		// A failures file is also a song CSV
+		if filepath.Ext(path) != ".json" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			songs, invalid, err := parseSongCSV(data, config.CSVOptions{})
+			if err != nil || len(invalid) > 0 || len(songs) != 2 || !reflect.DeepEqual(songs[0].Metadata, want[0].Metadata) || songs[1].Target != want[1].Target {
+				t.Errorf("%s read as a song CSV = %+v, %v, %v", name, songs, invalid, err)
+			}
+		}
+	}
+
+	for _, name := range []string{"empty.csv", "empty.json"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := WriteFailures(path, nil); err != nil {
+			t.Fatal(err)
+		}
+		if items, err := ReadFailures(path); err != nil || len(items) != 0 {
+			t.Errorf("ReadFailures(%s) = %v, %v, want no items", name, items, err)
+		}
+	}
+}
+
+func TestReadFailuresInvalid(t *testing.T) {
+	tests := map[string]string{
+		"no target":  "artist,title,query,target\nMuse,Uprising,,\n",
+		"bad track":  "query,track\nUprising,six\n",
+		"bad range":  "query,start,end\nUprising,90,30\n",
+		"bad quotes": "query\n\"Uprising\n",
+	}
+	for name, data := range tests {
+		path := filepath.Join(t.TempDir(), "failed.csv")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadFailures(path); err == nil {
+			t.Errorf("%s: ReadFailures accepted %q", name, data)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Frame layout of the synthetic MP3 stream: MPEG-1 Layer III, 128 kbps, 44.1 kHz, joint stereo
+const (
+	fakeFrameSize    = 417
+	fakeFrameSamples = 1152
+	fakeSampleRate   = 44100
+)
+
+// Fake is an in-process backend that writes short silent audio files instead of downloading
+type Fake struct {
+	// Duration of every synthetic track; zero picks a stable length per target
+	Duration time.Duration
+	// Delay simulates download time
+	Delay time.Duration
+	// Failures maps targets to the error their download should return
+	Failures map[string]error
+
+	mu        sync.Mutex
+	downloads []string
+}
+
+// NewFake creates a fake backend with default settings
+func NewFake() *Fake {
+	return &Fake{Failures: make(map[string]error)}
+}
+
+// Downloads returns the targets the fake has been asked to download, in order
+func (f *Fake) Downloads() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.downloads...)
+}
+
+// Download writes a silent audio file for the target and reports it like yt-dlp would
+func (f *Fake) Download(ctx context.Context, target string, opts Options) (*DownloadResult, error) {
+	f.mu.Lock()
+	f.downloads = append(f.downloads, target)
+	f.mu.Unlock()
+
+	log.Printf("Fake download for: %s", target)
+	startTime := time.Now()
+
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-ctx.Done():
+			return nil, fmt.Errorf("fake download cancelled: %w", ctx.Err())
+		}
+	}
+	if err, ok := f.Failures[target]; ok {
+		return nil, err
+	}
+
+	id := fakeVideoID(target)
+	title := "Fake track " + id
+	duration := f.Duration
+	if duration == 0 {
+		// Between 30 seconds and 5 minutes, stable for a given target
+		duration = time.Duration(30+fnvHash(target)%270) * time.Second
+	}
+
+	info := map[string]interface{}{
+		"id":          id,
+		"title":       title,
+		"uploader":    "Fake Uploader",
+		"duration":    duration.Seconds(),
+		"webpage_url": videoURL(id),
+		"ext":         "mp3", // whatever the format, the fake can only write MP3
+		"acodec":      "mp3",
+	}
+	if !opts.Range.IsZero() {
+		// Report the section like yt-dlp does for --download-sections
+		info["section_start"] = opts.Range.Start
+		info["section_end"] = opts.Range.Start + opts.Range.Length(duration).Seconds()
+		duration = opts.Range.Length(duration)
+	}
+
+	fileName := expandFakeTemplate(opts.OutputTemplate, map[string]string{
+		"id":    id,
+		"title": title,
+		"ext":   "mp3",
+	})
+	filePath := filepath.Join(opts.OutputDir, fileName)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, fmt.Errorf("error creating output directory: %w", err)
+	}
+	if err := writeSilentMP3(filePath, duration); err != nil {
+		return nil, fmt.Errorf("error writing fake audio: %w", err)
+	}
+
+	info["filepath"] = filePath
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding fake info JSON: %w", err)
+	}
+
+	return newDownloadResult(id, infoJSON, time.Since(startTime))
+}
+
+// writeSilentMP3 writes a stream of silent MPEG audio frames lasting roughly the given duration
+func writeSilentMP3(path string, duration time.Duration) error {
+	frames := int(duration.Seconds() * fakeSampleRate / fakeFrameSamples)
+	if frames < 1 {
+		frames = 1
+	}
+
+	frame := make([]byte, fakeFrameSize)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x44})
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < frames; i++ {
+		if _, err := file.Write(frame); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// fakeVideoID derives an 11 character, YouTube-like ID from a target
+func fakeVideoID(target string) string {
+	if !strings.Contains(target, "://") && len(target) == 11 {
+		return target
+	}
+	return fmt.Sprintf("fake%07x", fnvHash(target)&0xFFFFFFF)
+}
+
+// expandFakeTemplate fills the %(field)s placeholders of a yt-dlp output template
+func expandFakeTemplate(template string, fields map[string]string) string {
+	for key, value := range fields {
+		template = strings.ReplaceAll(template, "%("+key+")s", value)
+	}
+	return template
+}
+
+func fnvHash(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
@@ -0,0 +1,74 @@
+package downloader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ktappdev/ytaudio/hooks"
+)
+
+// newBatchID returns an identifier for a run, sortable by start time
+func newBatchID() string {
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return time.Now().Format("20060102-150405")
+	}
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// runItemHooks runs the post-download hooks for a result and adopts any replacement file they report
+func runItemHooks(ctx context.Context, result *DownloadResult, opts Options) error {
+	runner := hooks.NewRunner(opts.Hooks)
+	if !runner.HasItemHooks() {
+		return nil
+	}
+
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error encoding hook payload: %w", err)
+	}
+
+	newPath, err := runner.RunItem(ctx, hooks.Env{
+		File:    result.FilePath,
+		VideoID: result.VideoID,
+		Title:   result.Title,
+		Query:   result.Query,
+		BatchID: opts.BatchID,
+	}, payload)
+	if err != nil {
+		return err
+	}
+
+	if newPath != result.FilePath {
+		result.FilePath = newPath
+		return result.refreshFileInfo()
+	}
+	return nil
+}
+
+// RunBatchHooks runs the post-batch hooks with every result of the batch as a JSON array on stdin
+func RunBatchHooks(ctx context.Context, opts Options, results []*DownloadResult) error {
+	runner := hooks.NewRunner(opts.Hooks)
+	if !runner.HasBatchHooks() {
+		return nil
+	}
+
+	if results == nil {
+		results = []*DownloadResult{}
+	}
+	payload, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("error encoding batch hook payload: %w", err)
+	}
+
+	log.Printf("Running batch hooks for batch %s (%d results)", opts.BatchID, len(results))
+	return runner.RunBatch(ctx, hooks.Env{
+		BatchID: opts.BatchID,
+		Count:   len(results),
+	}, payload)
+}
@@ -0,0 +1,358 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/exitcode"
+	"github.com/ktappdev/ytaudio/tagger"
+)
+
+// songFormat reads one kind of song list into items
+type songFormat struct {
+	name  string
+	exts  []string
+	sniff func(head []byte) bool // recognizes the format by its first bytes, nil for the fallback
+	parse func(data []byte, opts config.CSVOptions) ([]Item, []rowError, error)
+}
+
+// songFormats are the song lists ytaudio can import, CSV last as it is also the fallback
+var songFormats = []songFormat{
+	{name: "M3U", exts: []string{".m3u", ".m3u8"}, sniff: func(head []byte) bool {
+		return bytes.HasPrefix(head, []byte("#EXTM3U"))
+	}, parse: parseM3U},
+	{name: "XSPF", exts: []string{".xspf"}, sniff: func(head []byte) bool {
+		return bytes.HasPrefix(head, []byte("<")) && bytes.Contains(head, []byte("xspf.org"))
+	}, parse: parseXSPF},
+	{name: "JSON", exts: []string{".json"}, sniff: func(head []byte) bool {
+		return bytes.HasPrefix(head, []byte("[")) || bytes.HasPrefix(head, []byte("{"))
+	}, parse: parseSongJSON},
+	{name: "CSV", exts: []string{".csv", ".tsv", ".txt"}, parse: parseSongCSV},
+}
+
+// rowError is a malformed entry of a song list; pos says where it is, such as "line 3" or "entry 2"
+type rowError struct {
+	pos string
+	err error
+}
+
+// readSongFile reads the songs of a CSV file or a playlist export, telling the format by its extension and
+// then by its content. Every entry is checked first, and malformed entries stop the batch before anything
+// is downloaded unless they are to be skipped.
+func readSongFile(path string, opts config.CSVOptions) ([]Item, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading song file: %w", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	format := detectSongFormat(path, data)
+	log.Printf("Reading songs from %s file: %s", format.name, path)
+	songs, invalid, err := format.parse(data, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	if len(invalid) > 0 {
+		for _, row := range invalid {
+			log.Printf("%s %s: %v", path, row.pos, row.err)
+		}
+		if !opts.SkipInvalid {
+			return nil, exitcode.Wrap(exitcode.Usage, fmt.Errorf("%d malformed entries in %s, nothing was downloaded (fix them or pass --csv-skip-invalid)", len(invalid), path))
+		}
+		log.Printf("Skipping %d malformed entries", len(invalid))
+	}
+	log.Printf("Successfully read %d songs from %s", len(songs), path)
+	return songs, nil
+}
+
+// detectSongFormat picks the format named by the extension of path, then the one whose content data looks like
+func detectSongFormat(path string, data []byte) songFormat {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, format := range songFormats {
+		for _, e := range format.exts {
+			if e == ext {
+				return format
+			}
+		}
+	}
+	head := bytes.TrimSpace(data[:min(len(data), 512)])
+	for _, format := range songFormats {
+		if format.sniff != nil && format.sniff(head) {
+			return format
+		}
+	}
+	return songFormats[len(songFormats)-1]
+}
+
+// parseM3U reads an M3U or M3U8 playlist. Artist and title come from the #EXTINF line before each entry,
+// or from the file name when there is none; YouTube links are downloaded as they are, anything else is searched.
+func parseM3U(data []byte, _ config.CSVOptions) ([]Item, []rowError, error) {
+	var songs []Item
+	var invalid []rowError
+	var info, artist, album string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+		case strings.HasPrefix(text, "#EXTINF:"):
+			info = extinfTitle(strings.TrimPrefix(text, "#EXTINF:"))
+		case strings.HasPrefix(text, "#EXTART:"):
+			artist = strings.TrimSpace(strings.TrimPrefix(text, "#EXTART:"))
+		case strings.HasPrefix(text, "#EXTALB:"):
+			// The album applies to every entry that follows
+			album = strings.TrimSpace(strings.TrimPrefix(text, "#EXTALB:"))
+		case strings.HasPrefix(text, "#"):
+		default:
+			item, err := locationItem(text, info, artist, album, "")
+			if err != nil {
+				invalid = append(invalid, rowError{pos: fmt.Sprintf("line %d", line), err: err})
+			} else {
+				songs = append(songs, item)
+			}
+			info, artist = "", ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	return songs, invalid, nil
+}
+
+// extinfTitle returns the display title of an #EXTINF line, the part after the duration and any attributes
+func extinfTitle(info string) string {
+	quoted := false
+	for i, r := range info {
+		switch r {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				return strings.TrimSpace(info[i+1:])
+			}
+		}
+	}
+	return ""
+}
+
+// xspfPlaylist is the part of an XSPF playlist ytaudio reads
+type xspfPlaylist struct {
+	Tracks []struct {
+		Location []string `xml:"location"`
+		Title    string   `xml:"title"`
+		Creator  string   `xml:"creator"`
+		Album    string   `xml:"album"`
+		TrackNum string   `xml:"trackNum"`
+	} `xml:"trackList>track"`
+}
+
+// parseXSPF reads the track elements of an XSPF playlist
+func parseXSPF(data []byte, _ config.CSVOptions) ([]Item, []rowError, error) {
+	var playlist xspfPlaylist
+	if err := xml.Unmarshal(data, &playlist); err != nil {
+		return nil, nil, fmt.Errorf("error parsing XSPF playlist: %w", err)
+	}
+
+	var songs []Item
+	var invalid []rowError
+	for i, track := range playlist.Tracks {
+		var location string
+		if len(track.Location) > 0 {
+			location = strings.TrimSpace(track.Location[0])
+		}
+		item, err := locationItem(location, strings.TrimSpace(track.Title), strings.TrimSpace(track.Creator), strings.TrimSpace(track.Album), strings.TrimSpace(track.TrackNum))
+		if err != nil {
+			invalid = append(invalid, rowError{pos: fmt.Sprintf("track %d", i+1), err: err})
+			continue
+		}
+		songs = append(songs, item)
+	}
+	return songs, invalid, nil
+}
+
+// trackNumberPrefix matches the track number in file names such as "01 - Title.mp3" or "3. Title.flac"
+var trackNumberPrefix = regexp.MustCompile(`^\d{1,3}\s*[-._)]\s*`)
+
+// locationItem builds an item for a playlist entry. Without a known artist, display is read as "Artist - Title";
+// without a display title the file name of the location is used. Only YouTube locations are downloaded directly.
+func locationItem(location, display, artist, album, track string) (Item, error) {
+	fields := map[string]string{"album": album, "track": track}
+	if isYouTubeURL(location) {
+		fields["url"] = location
+	} else if display == "" && location != "" {
+		display = titleFromLocation(location)
+	}
+
+	fields["artist"], fields["title"] = artist, display
+	if artist == "" {
+		fields["artist"], fields["title"] = tagger.ParseQuery(display)
+	}
+	return fieldItem(fields)
+}
+
+// titleFromLocation turns a file path or URL such as file:///music/01%20-%20Artist%20-%20Title.mp3 into "Artist - Title"
+func titleFromLocation(location string) string {
+	name := location
+	if u, err := url.Parse(location); err == nil && u.Scheme != "" && len(u.Scheme) > 1 {
+		name = u.Path
+	}
+	name = path.Base(filepath.ToSlash(name))
+	if name == "/" || name == "." {
+		// Locations without a file name, such as https://example.com/
+		return ""
+	}
+	name = strings.TrimSuffix(name, path.Ext(name))
+	return strings.TrimSpace(trackNumberPrefix.ReplaceAllString(name, ""))
+}
+
+// isYouTubeURL reports whether location is a link to youtube.com or youtu.be
+func isYouTubeURL(location string) bool {
+	u, err := url.Parse(location)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	return host == "youtu.be" || host == "youtube.com" || strings.HasSuffix(host, ".youtube.com")
+}
+
+// jsonColumns are names JSON exports use for fields, on top of the CSV column names
+var jsonColumns = map[string]string{"name": "title", "creator": "artist"}
+
+// parseSongJSON reads a JSON array of songs, or an object holding one under tracks, items or songs. A song is
+// a query string or an object with the fields of a CSV row; Spotify style {"track": {...}} wrappers, artist
+// arrays and album objects are understood as well.
+func parseSongJSON(data []byte, _ config.CSVOptions) ([]Item, []rowError, error) {
+	var root interface{}
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, nil, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	entries, ok := jsonEntries(root)
+	if !ok {
+		return nil, nil, fmt.Errorf("expected an array of songs, or an object with a tracks, items or songs array")
+	}
+
+	var songs []Item
+	var invalid []rowError
+	for i, entry := range entries {
+		item, err := jsonItem(entry)
+		if err != nil {
+			invalid = append(invalid, rowError{pos: fmt.Sprintf("entry %d", i+1), err: err})
+			continue
+		}
+		songs = append(songs, item)
+	}
+	return songs, invalid, nil
+}
+
+// jsonEntries finds the array of songs in a JSON document
+func jsonEntries(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case map[string]interface{}:
+		for _, key := range []string{"tracks", "items", "songs"} {
+			if entries, ok := v[key]; ok {
+				return jsonEntries(entries)
+			}
+		}
+	}
+	return nil, false
+}
+
+// jsonItem builds an item from one entry of a JSON song list
+func jsonItem(entry interface{}) (Item, error) {
+	switch v := entry.(type) {
+	case string:
+		return fieldItem(map[string]string{"query": v})
+	case map[string]interface{}:
+		if track, ok := v["track"].(map[string]interface{}); ok {
+			v = track
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		// Sorted so the same file always picks the same key when several name one field
+		sort.Strings(keys)
+
+		fields := make(map[string]string)
+		for _, key := range keys {
+			name := normalizeColumn(key)
+			field, ok := jsonColumns[name]
+			if !ok {
+				field, ok = csvColumns[name]
+			}
+			if _, seen := fields[field]; !ok || seen {
+				continue
+			}
+			if text := jsonText(v[key]); text != "" {
+				fields[field] = text
+			}
+		}
+		if album, ok := v["album"].(map[string]interface{}); ok && fields["year"] == "" {
+			if date := jsonText(album["release_date"]); date != "" {
+				fields["year"] = date
+			}
+		}
+		return fieldItem(fields)
+	default:
+		return Item{}, fmt.Errorf("expected a string or an object, got %s", strings.TrimSpace(fmt.Sprint(entry)))
+	}
+}
+
+// jsonText flattens a JSON value into a cell: lists are joined, objects stand for their name
+func jsonText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		var parts []string
+		for _, element := range v {
+			if text := jsonText(element); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		return strings.Join(parts, ", ")
+	case map[string]interface{}:
+		return jsonText(v["name"])
+	default:
+		return ""
+	}
+}
+
+// fieldItem builds an item from named fields with the same checks as a CSV row
+func fieldItem(fields map[string]string) (Item, error) {
+	record := make([]string, 0, len(fields))
+	columns := make(map[string]int, len(fields))
+	for field, value := range fields {
+		columns[field] = len(record)
+		record = append(record, value)
+	}
+	return csvItem(record, columns)
+}
+
+// songQuery is the search query for a song, "Artist - Title" or the title alone
+func songQuery(artist, title string) string {
+	if artist != "" && title != "" {
+		return fmt.Sprintf("%s - %s", artist, title)
+	}
+	return title
+}
@@ -0,0 +1,208 @@
+package downloader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/tagger"
+)
+
+func TestDetectSongFormat(t *testing.T) {
+	tests := []struct {
+		path, data, want string
+	}{
+		{"songs.csv", "artist,title\n", "CSV"},
+		{"songs.tsv", "artist\ttitle\n", "CSV"},
+		{"songs.txt", "[not json]", "CSV"},
+		{"list.m3u8", "Song.mp3\n", "M3U"},
+		{"list.M3U", "", "M3U"},
+		{"list.xspf", "<playlist/>", "XSPF"},
+		{"songs.json", "artist,title", "JSON"},
+		{"export", "#EXTM3U\n#EXTINF:1,Song\nsong.mp3\n", "M3U"},
+		{"export", `<?xml version="1.0"?><playlist xmlns="http://xspf.org/ns/0/">`, "XSPF"},
+		{"export", "  \n[{\"title\": \"Song\"}]", "JSON"},
+		{"export", `{"tracks": []}`, "JSON"},
+		{"export", "<html></html>", "CSV"},
+		{"export", "Daft Punk,One More Time\n", "CSV"},
+		{"export", "", "CSV"},
+	}
+	for _, tt := range tests {
+		if got := detectSongFormat(tt.path, []byte(tt.data)).name; got != tt.want {
+			t.Errorf("detectSongFormat(%q, %q) = %s, want %s", tt.path, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestParseM3U(t *testing.T) {
+	data := `#EXTM3U
+#EXTALB:Discovery
+#EXTINF:320,Daft Punk - One More Time
+/music/Daft Punk/01 One More Time.mp3
+
+#EXTINF:-1 tvg-name="a, b",Aerodynamic
+#EXTART:Daft Punk
+https://www.youtube.com/watch?v=L93-7vRfxNs
+file:///music/03%20-%20Daft%20Punk%20-%20Digital%20Love.flac
+#EXTINF:10,
+https://example.com/
+`
+	got, invalid, err := parseM3U([]byte(data), config.CSVOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	album := "Discovery"
+	want := []Item{
+		{Query: "Daft Punk - One More Time", Metadata: tagger.Metadata{Artist: "Daft Punk", Title: "One More Time", Album: album}},
+		{Target: "https://www.youtube.com/watch?v=L93-7vRfxNs", Query: "Daft Punk - Aerodynamic", Metadata: tagger.Metadata{Artist: "Daft Punk", Title: "Aerodynamic", Album: album}},
+		{Query: "Daft Punk - Digital Love", Metadata: tagger.Metadata{Artist: "Daft Punk", Title: "Digital Love", Album: album}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseM3U =\n%+v\nwant\n%+v", got, want)
+	}
+	// A location that is neither a YouTube link nor has a usable name
+	if len(invalid) != 1 || invalid[0].pos != "line 11" {
+		t.Errorf("invalid entries = %v, want line 11", invalid)
+	}
+}
+
+func TestExtinfTitle(t *testing.T) {
+	tests := []struct {
+		info, want string
+	}{
+		{"123,Artist - Title", "Artist - Title"},
+		{`-1 tvg-name="a, b" group="x",Title, with comma`, "Title, with comma"},
+		{"123", ""},
+		{"123,", ""},
+	}
+	for _, tt := range tests {
+		if got := extinfTitle(tt.info); got != tt.want {
+			t.Errorf("extinfTitle(%q) = %q, want %q", tt.info, got, tt.want)
+		}
+	}
+}
+
+func TestParseXSPF(t *testing.T) {
+	data := `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <trackList>
+    <track>
+      <location>https://youtu.be/FGBhQbmPwH8</location>
+      <title>One More Time</title>
+      <creator>Daft Punk</creator>
+      <album>Discovery</album>
+      <trackNum>1</trackNum>
+    </track>
+    <track>
+      <location>file:///music/Muse%20-%20Uprising.mp3</location>
+    </track>
+    <track>
+      <title>Karma Police</title>
+      <trackNum>six</trackNum>
+    </track>
+    <track/>
+  </trackList>
+</playlist>`
+	got, invalid, err := parseXSPF([]byte(data), config.CSVOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Item{
+		{Target: "https://youtu.be/FGBhQbmPwH8", Query: "Daft Punk - One More Time", Metadata: tagger.Metadata{Artist: "Daft Punk", Title: "One More Time", Album: "Discovery", Track: 1}},
+		{Query: "Muse - Uprising", Metadata: tagger.Metadata{Artist: "Muse", Title: "Uprising"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseXSPF =\n%+v\nwant\n%+v", got, want)
+	}
+	var positions []string
+	for _, row := range invalid {
+		positions = append(positions, row.pos)
+	}
+	if strings.Join(positions, ",") != "track 3,track 4" {
+		t.Errorf("invalid tracks = %v, want track 3 and 4", invalid)
+	}
+
+	if _, _, err := parseXSPF([]byte("<playlist><trackList>"), config.CSVOptions{}); err == nil {
+		t.Error("expected an error for a truncated playlist")
+	}
+}
+
+func TestParseSongJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []Item
+		invalid []string
+		wantErr bool
+	}{
+		{
+			name: "queries",
+			data: `["Daft Punk - One More Time", "lofi beats"]`,
+			want: []Item{{Query: "Daft Punk - One More Time"}, {Query: "lofi beats"}},
+		},
+		{
+			name: "objects",
+			data: `{"songs": [{"name": "Uprising", "creator": "Muse", "track": 1, "year": 2009, "video_id": "w8KQmps-Sog", "unknown": true}]}`,
+			want: []Item{{
+				Target:   "w8KQmps-Sog",
+				Query:    "Muse - Uprising",
+				Metadata: tagger.Metadata{Artist: "Muse", Title: "Uprising", Track: 1, Year: "2009"},
+			}},
+		},
+		{
+			name: "spotify",
+			data: `{"items": [{"added_at": "2024-01-01", "track": {"name": "Get Lucky",
+				"artists": [{"name": "Daft Punk"}, {"name": "Pharrell Williams"}],
+				"album": {"name": "Random Access Memories", "release_date": "2013-05-17"}}}]}`,
+			want: []Item{{
+				Query:    "Daft Punk, Pharrell Williams - Get Lucky",
+				Metadata: tagger.Metadata{Artist: "Daft Punk, Pharrell Williams", Title: "Get Lucky", Album: "Random Access Memories", Year: "2013"},
+			}},
+		},
+		{
+			name:    "invalid entries",
+			data:    `{"tracks": ["ok", 5, {"artist": "Muse"}, {"title": "x", "format": "wma"}]}`,
+			want:    []Item{{Query: "ok"}},
+			invalid: []string{"entry 2", "entry 3", "entry 4"},
+		},
+		{name: "no songs", data: `{"playlist": "mine"}`, wantErr: true},
+		{name: "not json", data: `[{"title": }]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, invalid, err := parseSongJSON([]byte(tt.data), config.CSVOptions{})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: parseSongJSON error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseSongJSON =\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+		var positions []string
+		for _, row := range invalid {
+			positions = append(positions, row.pos)
+		}
+		if strings.Join(positions, ",") != strings.Join(tt.invalid, ",") {
+			t.Errorf("%s: invalid entries %v, want %v", tt.name, invalid, tt.invalid)
+		}
+	}
+}
+
+func TestTitleFromLocation(t *testing.T) {
+	tests := []struct {
+		location, want string
+	}{
+		{"/music/01 - Artist - Title.mp3", "Artist - Title"},
+		{"/music/3. Title.flac", "Title"},
+		{"file:///music/02_Artist%20-%20Title.m4a", "Artist - Title"},
+		{"/music/99 Problems.mp3", "99 Problems"},
+		{"https://example.com/", ""},
+		{"https://example.com/songs/Title.mp3?x=1", "Title"},
+		{"1999.mp3", "1999"},
+	}
+	for _, tt := range tests {
+		if got := titleFromLocation(tt.location); got != tt.want {
+			t.Errorf("titleFromLocation(%q) = %q, want %q", tt.location, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ktappdev/ytaudio/engine"
+)
+
+// journalDirName is the hidden folder in the output directory holding one journal per batch
+const journalDirName = ".ytaudio-journal"
+
+// journalFlushInterval is how often the changes of a running batch are written to its journal
+const journalFlushInterval = 2 * time.Second
+
+// ItemState is how far an item of a journaled batch got
+type ItemState string
+
+const (
+	ItemPending    ItemState = "pending"
+	ItemResolved   ItemState = "resolved"
+	ItemDownloaded ItemState = "downloaded"
+	ItemSkipped    ItemState = "skipped"
+	ItemFailed     ItemState = "failed"
+)
+
+// JournalEntry records the progress of one item of a batch
+type JournalEntry struct {
+	Item       Item      `json:"item"`
+	State      ItemState `json:"state"`
+	VideoID    string    `json:"video_id,omitempty"` // resolved search result, reused when the batch continues
+	OutputPath string    `json:"output_path,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Journal is the on-disk record of a batch that lets an interrupted run continue where it stopped
+type Journal struct {
+	BatchID   string          `json:"batch_id"`
+	InputHash string          `json:"input_hash"`
+	Args      []string        `json:"args,omitempty"`     // command line of the run, replayed by "ytaudio resume"
+	Redacted  []string        `json:"redacted,omitempty"` // secret flags left out of Args, which resume asks for again
+	Started   time.Time       `json:"started"`
+	Updated   time.Time       `json:"updated"`
+	Complete  bool            `json:"complete"`
+	Items     []*JournalEntry `json:"items"`
+
+	path string
+
+	mu     sync.Mutex // guards the entries and dirty while the batch runs
+	dirty  bool
+	saveMu sync.Mutex // keeps two saves from writing the file at once
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// LoadJournal reads the journal of a batch from the default output directory
+func LoadJournal(batchID string) (*Journal, error) {
+	return readJournal(journalPath(getDownloadPath(), batchID))
+}
+
+// openJournal returns the journal to record a batch in. A batch to resume is loaded by its ID, otherwise the
+// newest unfinished journal of the same input is continued, and a new journal is started when there is none.
+func openJournal(outputDir, batchID, resume string, items []Item, args []string) (*Journal, error) {
+	hash, err := inputHash(items)
+	if err != nil {
+		return nil, err
+	}
+
+	if resume != "" {
+		journal, err := readJournal(journalPath(outputDir, resume))
+		if err != nil {
+			return nil, err
+		}
+		if journal.InputHash != hash {
+			log.Printf("Input of batch %s changed since it was started, continuing with the %d items in its journal", resume, len(journal.Items))
+		}
+		return journal, nil
+	}
+
+	journal, err := findJournal(outputDir, hash)
+	if err != nil {
+		return nil, err
+	}
+	if journal != nil {
+		log.Printf("Continuing unfinished batch %s from %s", journal.BatchID, journal.Started.Format(time.RFC1123))
+		return journal, nil
+	}
+
+	args, redacted := redactArgs(args)
+	journal = &Journal{
+		BatchID:   batchID,
+		InputHash: hash,
+		Args:      args,
+		Redacted:  redacted,
+		Started:   time.Now(),
+		path:      journalPath(outputDir, batchID),
+	}
+	for _, item := range items {
+		journal.Items = append(journal.Items, &JournalEntry{Item: item, State: ItemPending})
+	}
+	return journal, journal.save()
+}
+
+// findJournal returns the most recently started unfinished journal of an input, or nil
+func findJournal(outputDir, hash string) (*Journal, error) {
+	paths, err := filepath.Glob(filepath.Join(outputDir, journalDirName, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var found *Journal
+	for _, path := range paths {
+		journal, err := readJournal(path)
+		if err != nil {
+			log.Printf("Skipping journal: %v", err)
+			continue
+		}
+		if journal.Complete || journal.InputHash != hash {
+			continue
+		}
+		if found == nil || journal.Started.After(found.Started) {
+			found = journal
+		}
+	}
+	return found, nil
+}
+
+func readJournal(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no journal for batch %s", strings.TrimSuffix(filepath.Base(path), ".json"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading journal: %w", err)
+	}
+	var journal Journal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return nil, fmt.Errorf("error parsing journal %s: %w", path, err)
+	}
+	journal.path = path
+	return &journal, nil
+}
+
+// secretFlags are the flags whose values give access to accounts, which a journal does not record. --proxy is
+// only left out when its URL holds a user name or password. The API key comes from the environment, so it never
+// shows up in the command line.
+var secretFlags = []string{"cookies", "cookies-from-browser", "proxy"}
+
+// redactArgs removes the secret flags and their values from a command line and returns the names of the removed
+// flags, so that "ytaudio resume" can ask for them again
+func redactArgs(args []string) (kept, redacted []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			kept = append(kept, args[i:]...)
+			break
+		}
+		name, value, inline := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !strings.HasPrefix(arg, "--") || !slices.Contains(secretFlags, name) {
+			kept = append(kept, arg)
+			continue
+		}
+		next := !inline && i+1 < len(args)
+		if next {
+			value = args[i+1]
+		}
+		if name == "proxy" && !proxyHasUser(value) {
+			kept = append(kept, arg)
+			continue
+		}
+		if next {
+			i++
+		}
+		if !slices.Contains(redacted, name) {
+			redacted = append(redacted, name)
+		}
+	}
+	return kept, redacted
+}
+
+// proxyHasUser reports whether a proxy URL carries credentials. URLs that do not parse are treated as if they did.
+func proxyHasUser(proxy string) bool {
+	u, err := url.Parse(proxy)
+	return err != nil || u.User != nil
+}
+
+// MissingSecrets returns the flags left out of the recorded command line that args does not give again
+func (j *Journal) MissingSecrets(args []string) []string {
+	var missing []string
+	for _, name := range j.Redacted {
+		given := slices.ContainsFunc(args, func(arg string) bool {
+			return arg == "--"+name || strings.HasPrefix(arg, "--"+name+"=")
+		})
+		if !given {
+			missing = append(missing, "--"+name)
+		}
+	}
+	return missing
+}
+
+func journalPath(outputDir, batchID string) string {
+	return filepath.Join(outputDir, journalDirName, batchID+".json")
+}
+
+// inputHash identifies a batch input by the items it produced, so the same CSV, song list or playlist
+// maps to the same journal however it is passed in
+func inputHash(items []Item) (string, error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return "", fmt.Errorf("error hashing batch input: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// save writes the journal to a temporary file and moves it over the old one, so a crash never leaves half a journal
+func (j *Journal) save() error {
+	j.saveMu.Lock()
+	defer j.saveMu.Unlock()
+
+	j.mu.Lock()
+	j.Updated = time.Now()
+	j.dirty = false
+	data, err := json.MarshalIndent(j, "", "  ")
+	j.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error encoding journal: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return fmt.Errorf("error creating journal directory: %w", err)
+	}
+	tmp := j.path + ".tmp"
+	// The journal records the command line, which can still name private paths and hosts
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("error writing journal: %w", err)
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return fmt.Errorf("error writing journal: %w", err)
+	}
+	return nil
+}
+
+// remaining returns the tasks still to run. Items downloaded by an earlier run are skipped unless their
+// output has disappeared since, and resolved items go straight to the download.
+func (j *Journal) remaining() []*Task {
+	var tasks []*Task
+	for _, entry := range j.Items {
+		if entry.State == ItemDownloaded {
+			if _, err := os.Stat(entry.OutputPath); err == nil {
+				continue
+			}
+			log.Printf("Downloading %s again, %s is gone", entry.Item.describe(), entry.OutputPath)
+		}
+		item := entry.Item
+		if item.Target == "" && entry.VideoID != "" {
+			item.Target = entry.VideoID
+		}
+		tasks = append(tasks, &Task{Input: entry.Item, Item: item, entry: entry})
+	}
+	return tasks
+}
+
+// autosave writes the journal every journalFlushInterval while it has unsaved changes, and right away once ctx
+// is cancelled, until finish stops it. Events only mark the journal changed, so no worker waits for the disk.
+func (j *Journal) autosave(ctx context.Context) {
+	j.stop, j.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(journalFlushInterval)
+		defer ticker.Stop()
+		cancelled := ctx.Done()
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-ticker.C:
+			case <-cancelled:
+				cancelled = nil
+			}
+			j.mu.Lock()
+			dirty := j.dirty
+			j.mu.Unlock()
+			if !dirty {
+				continue
+			}
+			if err := j.save(); err != nil {
+				log.Printf("Error saving journal of batch %s: %v", j.BatchID, err)
+			}
+		}
+	}()
+}
+
+// record updates the entry of a task after an engine event; autosave writes the change to disk.
+// Jobs cut short by cancellation keep their state so they run again when the batch continues.
+func (j *Journal) record(event engine.Event[*Task], cancelled bool) {
+	task := event.Job.Value
+	entry := task.entry
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case event.Type == engine.StageFinished && event.Stage == StageResolve:
+		entry.State = ItemResolved
+		entry.VideoID = task.Item.Target
+	case event.Type == engine.JobDone:
+		entry.State = ItemDownloaded
+		entry.OutputPath = task.Result.outputPath()
+		entry.Error = ""
+	case event.Type == engine.JobFailed && skipOf(event.Job.Err) != nil:
+		if skipOf(event.Job.Err).Stopped {
+			return // like a cancelled job, the item runs again when the batch continues
+		}
+		entry.State = ItemSkipped
+		entry.Error = event.Job.Err.Error()
+	case event.Type == engine.JobFailed && !cancelled:
+		entry.State = ItemFailed
+		entry.Error = event.Job.Err.Error()
+	default:
+		return
+	}
+	j.dirty = true
+}
+
+// finish stops autosaving, marks the journal complete once every item is downloaded or skipped, saves it and
+// tells how to continue otherwise
+func (j *Journal) finish() {
+	if j.stop != nil {
+		close(j.stop)
+		<-j.done
+	}
+
+	counts := map[ItemState]int{}
+	j.mu.Lock()
+	for _, entry := range j.Items {
+		counts[entry.State]++
+	}
+	j.Complete = counts[ItemDownloaded]+counts[ItemSkipped] == len(j.Items)
+	j.mu.Unlock()
+	if err := j.save(); err != nil {
+		log.Printf("Error saving journal of batch %s: %v", j.BatchID, err)
+	}
+	if j.Complete {
+		return
+	}
+
+	var states []string
+	for state, n := range counts {
+		states = append(states, fmt.Sprintf("%d %s", n, state))
+	}
+	sort.Strings(states)
+	log.Printf("Batch %s is unfinished (%s), continue it with: ytaudio resume %s", j.BatchID, strings.Join(states, ", "), j.BatchID)
+}
+
+// outputPath is what a download left in the output directory: the file, or the folder of its split tracks
+func (r *DownloadResult) outputPath() string {
+	if len(r.Tracks) > 0 {
+		return filepath.Dir(r.Tracks[0].FilePath)
+	}
+	return r.FilePath
+}
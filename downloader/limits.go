@@ -0,0 +1,196 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// precheckPrefix marks the line yt-dlp prints after format selection, before anything is downloaded
+const precheckPrefix = "ytaudio-precheck "
+
+// SkipError reports an item that was deliberately not downloaded, with the reason why. Skips are not failures:
+// they leave the exit code alone, do not stop a --fail-fast batch and are not listed in the failures file.
+type SkipError struct {
+	Target string
+	Reason string
+	// Stopped is set when the batch stopped before the item rather than for anything about the item,
+	// so a continued batch tries it again
+	Stopped bool
+}
+
+func (e *SkipError) Error() string {
+	return fmt.Sprintf("skipped %s: %s", e.Target, e.Reason)
+}
+
+// skipOf returns the SkipError in err's chain, or nil when err is not a skip
+func skipOf(err error) *SkipError {
+	var skip *SkipError
+	if errors.As(err, &skip) {
+		return skip
+	}
+	return nil
+}
+
+// Guard enforces the disk space limits shared by every download of a batch
+type Guard struct {
+	limits config.LimitOptions
+	dir    string
+
+	mu       sync.Mutex
+	used     int64
+	stopped  string
+	noStatfs bool
+}
+
+// NewGuard creates the guard for a batch writing into dir and logs the free space up front
+func NewGuard(dir string, limits config.LimitOptions) *Guard {
+	g := &Guard{limits: limits, dir: dir}
+	if free, err := freeSpace(dir); err != nil {
+		log.Printf("Free space checks disabled: %v", err)
+		g.noStatfs = true
+	} else {
+		log.Printf("Free space on %s: %s (minimum %s)", dir, config.ByteSize(free), limits.MinFreeSpace)
+	}
+	return g
+}
+
+// Admit checks the batch budget and free space before a download starts; once either runs out
+// the batch is stopped and every later item is skipped
+func (g *Guard) Admit(target string) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.stopped == "" && g.limits.BatchBudget > 0 && g.used >= int64(g.limits.BatchBudget) {
+		g.stop(fmt.Sprintf("batch budget of %s used up (%s downloaded)", g.limits.BatchBudget, config.ByteSize(g.used)))
+	}
+	if g.stopped == "" && g.limits.MinFreeSpace > 0 && !g.noStatfs {
+		free, err := freeSpace(g.dir)
+		if err != nil {
+			log.Printf("Error checking free space: %v", err)
+		} else if free < int64(g.limits.MinFreeSpace) {
+			g.stop(fmt.Sprintf("free space on %s is %s, below the minimum of %s", g.dir, config.ByteSize(free), g.limits.MinFreeSpace))
+		}
+	}
+
+	if g.stopped != "" {
+		return &SkipError{Target: target, Reason: "batch stopped: " + g.stopped, Stopped: true}
+	}
+	return nil
+}
+
+// Record adds a finished download to the batch total
+func (g *Guard) Record(size int64) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.used += size
+}
+
+// maxFileSize returns the largest file the next download may produce, the smaller of the per-item
+// limit and what is left of the batch budget; zero means unlimited
+func (g *Guard) maxFileSize() int64 {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	max := int64(g.limits.MaxFileSize)
+	if g.limits.BatchBudget > 0 {
+		remaining := int64(g.limits.BatchBudget) - g.used
+		if remaining < 1 {
+			remaining = 1
+		}
+		if max == 0 || remaining < max {
+			max = remaining
+		}
+	}
+	return max
+}
+
+func (g *Guard) stop(reason string) {
+	g.stopped = reason
+	log.Printf("Stopping batch: %s", reason)
+}
+
+// checkItemLimits skips items longer than --max-duration or larger than the allowed file size;
+// unknown values (zero) pass
+func checkItemLimits(target string, duration time.Duration, size int64, opts Options) error {
+	if max := time.Duration(opts.Limits.MaxDuration); max > 0 && duration > max {
+		return &SkipError{Target: target, Reason: fmt.Sprintf("duration %s exceeds the maximum of %s", duration.Round(time.Second), max)}
+	}
+	if max := opts.Guard.maxFileSize(); max > 0 && size > max {
+		return &SkipError{Target: target, Reason: fmt.Sprintf("size %s exceeds the allowed %s", config.ByteSize(size), config.ByteSize(max))}
+	}
+	return nil
+}
+
+// limitArgs makes yt-dlp report duration and size before downloading and abort streams that grow past the size limit
+func limitArgs(opts Options) []string {
+	var args []string
+	if opts.Limits.MaxDuration > 0 || opts.Guard.maxFileSize() > 0 {
+		args = append(args, "--print", "video:"+precheckPrefix+"%(duration)s %(filesize,filesize_approx)s")
+	}
+	if max := opts.Guard.maxFileSize(); max > 0 {
+		args = append(args, "--max-filesize", strconv.FormatInt(max, 10))
+	}
+	return args
+}
+
+// parsePrecheck reads the duration and size from a precheck line, leaving unknown values at zero
+func parsePrecheck(line string, r config.TimeRange) (time.Duration, int64) {
+	fields := strings.Fields(strings.TrimPrefix(line, precheckPrefix))
+	var seconds, size float64
+	if len(fields) > 0 {
+		seconds, _ = strconv.ParseFloat(fields[0], 64)
+	}
+	if len(fields) > 1 {
+		size, _ = strconv.ParseFloat(fields[1], 64)
+	}
+
+	duration := time.Duration(seconds * float64(time.Second))
+	// Clips only download their share of the video
+	if !r.IsZero() && duration > 0 {
+		clip := r.Length(duration)
+		size = size * clip.Seconds() / duration.Seconds()
+		duration = clip
+	}
+	return duration, int64(size)
+}
+
+// enforceLimits checks a finished download against the limits and removes it when it is over them
+func enforceLimits(target string, result *DownloadResult, opts Options) error {
+	if err := checkItemLimits(target, result.Duration, result.FileSize, opts); err != nil {
+		if removeErr := os.Remove(result.FilePath); removeErr != nil {
+			log.Printf("Error removing %s: %v", result.FilePath, removeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// diskUsage returns the bytes a result occupies, counting split tracks next to a kept original
+func (r *DownloadResult) diskUsage() int64 {
+	if len(r.Tracks) == 0 || r.FilePath == filepath.Dir(r.Tracks[0].FilePath) {
+		return r.FileSize
+	}
+	size := r.FileSize
+	for _, track := range r.Tracks {
+		size += track.FileSize
+	}
+	return size
+}
@@ -0,0 +1,72 @@
+package downloader
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// matchColumns is the header of a match file before its candidate columns. Like the failures file it starts
+// with the columns of a song CSV, and video_id holds the chosen video, so a reviewed match file downloads
+// exactly the videos it lists.
+var matchColumns = []string{"artist", "title", "album", "track", "year", "query", "start", "end",
+	"format", "output_name", "video_id", "skip"}
+
+// candidateColumns are the columns listing each ranked search result, numbered from 1
+var candidateColumns = []string{"", "_title", "_channel", "_duration", "_score"}
+
+// reviewColumn reports whether a column only informs whoever reviews a match file, so reading it back
+// ignores the column without a warning
+func reviewColumn(name string) bool {
+	return name == "skip" || strings.HasPrefix(name, "candidate_")
+}
+
+// writeMatches writes a plan as a match file: every input with its chosen video and up to candidates
+// search results to pick another one from
+func writeMatches(w io.Writer, entries []PlanEntry, candidates int) error {
+	header := append([]string{}, matchColumns...)
+	for i := 1; i <= candidates; i++ {
+		for _, suffix := range candidateColumns {
+			header = append(header, fmt.Sprintf("candidate_%d%s", i, suffix))
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	for _, e := range entries {
+		item := e.item
+		var track string
+		if item.Metadata.Track > 0 {
+			track = strconv.Itoa(item.Metadata.Track)
+		}
+		// Skipped items are left without a video, so downloading the file as it is skips them too
+		videoID := e.VideoID
+		if e.Skip != "" {
+			videoID = ""
+		}
+		record := []string{
+			item.Metadata.Artist, item.Metadata.Title, item.Metadata.Album, track, item.Metadata.Year,
+			item.Query, formatRangeBound(item.Range.Start), formatRangeBound(item.Range.End),
+			item.Format, item.OutputName, videoID, e.Skip,
+		}
+		for i := 0; i < candidates; i++ {
+			if i >= len(e.Candidates) {
+				record = append(record, make([]string, len(candidateColumns))...)
+				continue
+			}
+			c := e.Candidates[i]
+			var duration string
+			if c.Duration > 0 {
+				duration = config.FormatClock(c.Duration.Seconds())
+			}
+			record = append(record, c.ID, c.Title, c.Channel, duration, strconv.FormatFloat(c.Score, 'f', 2, 64))
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
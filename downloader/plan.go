@@ -0,0 +1,258 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/engine"
+	"github.com/ktappdev/ytaudio/filename"
+	"github.com/ktappdev/ytaudio/youtube"
+)
+
+// PlanEntry is what a batch would do with one of its items
+type PlanEntry struct {
+	Input string `json:"input"`
+
+	// The video that would be downloaded; Score is only set when a search picked it
+	VideoID  string        `json:"video_id,omitempty"`
+	Title    string        `json:"title,omitempty"`
+	Channel  string        `json:"channel,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Score    *float64      `json:"score,omitempty"`
+
+	// OutputPath is empty when the name depends on a title only the download reveals
+	OutputPath string `json:"output_path,omitempty"`
+	// Skip says why the item would not be downloaded
+	Skip string `json:"skip,omitempty"`
+	// Candidates are the best ranked search results, the first of them the chosen video
+	Candidates []youtube.Candidate `json:"candidates,omitempty"`
+
+	item Item // the item as submitted, which a match file lists
+}
+
+// dryRun is the backend of a dry run; batches never get as far as downloading with it
+type dryRun struct{}
+
+func (dryRun) Download(ctx context.Context, target string, opts Options) (*DownloadResult, error) {
+	return nil, errors.New("--dry-run only plans playlist, song list, CSV and file batches")
+}
+
+// plan resolves the items like RunBatch would, without downloading anything, and prints what would happen.
+// Items the journal of an unfinished run of the same input has downloaded are listed as skipped.
+func (b Batch) plan(ctx context.Context, items []Item, opts Options) error {
+	tasks := make([]*Task, 0, len(items))
+	skips := make(map[*Task]string)
+	if journal := b.planJournal(opts.OutputDir, items); journal != nil {
+		log.Printf("Planning the rest of unfinished batch %s", journal.BatchID)
+		for _, entry := range journal.Items {
+			task := &Task{Input: entry.Item, Item: entry.Item}
+			if task.Item.Target == "" && entry.VideoID != "" {
+				task.Item.Target = entry.VideoID
+			}
+			if entry.State == ItemDownloaded {
+				if _, err := os.Stat(entry.OutputPath); err == nil {
+					skips[task] = "already downloaded to " + entry.OutputPath
+				}
+			}
+			tasks = append(tasks, task)
+		}
+	} else {
+		for _, item := range items {
+			tasks = append(tasks, &Task{Input: item, Item: item})
+		}
+	}
+
+	log.Printf("Dry run: resolving %d items with %d search workers, nothing will be downloaded", len(tasks), b.Workers.Resolve)
+	e := engine.New(engine.Stage[*Task]{Name: StageResolve, Workers: b.Workers.Resolve, Run: func(ctx context.Context, job *engine.Job[*Task]) error {
+		if _, ok := skips[job.Value]; ok {
+			return nil
+		}
+		return b.resolve(ctx, job.Value)
+	}})
+	jobs := e.Run(ctx, tasks)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// A registry of its own, so names are told apart like in a real run without holding any of them
+	names := filename.NewRegistry(opts.FileNames)
+	entries := make([]PlanEntry, len(jobs))
+	for i, job := range jobs {
+		entries[i] = planEntry(job, skips[job.Value], names, opts)
+		if candidates := job.Value.Candidates; len(candidates) > b.DryRun.Candidates {
+			entries[i].Candidates = candidates[:b.DryRun.Candidates]
+		} else {
+			entries[i].Candidates = candidates
+		}
+	}
+	if b.DryRun.File == "" {
+		return printPlan(os.Stdout, entries, opts.OutputDir, b.DryRun)
+	}
+	if err := writePlan(b.DryRun.File, entries, opts.OutputDir, b.DryRun); err != nil {
+		return err
+	}
+	log.Printf("Wrote the plan of %d items to %s", len(entries), b.DryRun.File)
+	return nil
+}
+
+// planJournal returns the journal an actual run would continue, or nil
+func (b Batch) planJournal(outputDir string, items []Item) *Journal {
+	if b.Resume != "" {
+		journal, err := readJournal(journalPath(outputDir, b.Resume))
+		if err != nil {
+			log.Printf("Planning without a journal: %v", err)
+			return nil
+		}
+		return journal
+	}
+	hash, err := inputHash(items)
+	if err != nil {
+		return nil
+	}
+	journal, err := findJournal(outputDir, hash)
+	if err != nil {
+		log.Printf("Planning without a journal: %v", err)
+	}
+	return journal
+}
+
+// planEntry describes the outcome of resolving one job
+func planEntry(job *engine.Job[*Task], skip string, names *filename.Registry, opts Options) PlanEntry {
+	task := job.Value
+	entry := PlanEntry{Input: task.Input.Query, VideoID: task.Item.Target, Skip: skip, item: task.Input}
+	if entry.Input == "" {
+		entry.Input = task.Input.Target
+	}
+	if match := task.Match; match != nil {
+		score := match.Score
+		entry.VideoID, entry.Title, entry.Channel, entry.Duration = match.ID, match.Title, match.Channel, match.Duration
+		entry.Score = &score
+	}
+	if job.Err != nil {
+		entry.Skip = job.Err.Error()
+	}
+	if entry.Skip != "" {
+		return entry
+	}
+
+	itemOpts := itemOptions(task.Item, opts)
+	if entry.Duration > 0 {
+		if err := checkItemLimits(task.Item.Target, itemOpts.Range.Length(entry.Duration), 0, opts); err != nil {
+			var skipErr *SkipError
+			if errors.As(err, &skipErr) {
+				entry.Skip = skipErr.Reason
+				return entry
+			}
+		}
+	}
+
+	title := task.Item.OutputName
+	if title == "" && entry.Title != "" {
+		title = entry.Title
+		if !itemOpts.Range.IsZero() {
+			title += " [" + itemOpts.Range.Label() + "]"
+		}
+	}
+	if title != "" {
+		entry.OutputPath = names.Reserve(opts.OutputDir, title, formatExt(itemOpts.AudioFormat), entry.VideoID)
+	}
+	return entry
+}
+
+// formatExt is the extension yt-dlp gives files extracted to format; "best" keeps whatever the source has
+func formatExt(format string) string {
+	switch format {
+	case "best":
+		return ""
+	case "aac", "alac":
+		return ".m4a"
+	case "vorbis":
+		return ".ogg"
+	default:
+		return "." + format
+	}
+}
+
+// writePlan writes the plan to a file, creating its directory
+func writePlan(path string, entries []PlanEntry, outputDir string, dryRun config.DryRunOptions) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("error creating plan file directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating plan file: %w", err)
+	}
+	if err := printPlan(file, entries, outputDir, dryRun); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing plan file: %w", err)
+	}
+	return file.Close()
+}
+
+// printPlan writes the plan as an aligned table with a summary line, a JSON array or a match file
+func printPlan(w io.Writer, entries []PlanEntry, outputDir string, dryRun config.DryRunOptions) error {
+	switch dryRun.Format {
+	case config.PlanCSV:
+		return writeMatches(w, entries, dryRun.Candidates)
+	case config.PlanJSON:
+		if entries == nil {
+			entries = []PlanEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	var skipped int
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tINPUT\tVIDEO\tTITLE\tCHANNEL\tDURATION\tSCORE\tOUTPUT\tSKIP")
+	for i, e := range entries {
+		output := e.OutputPath
+		if rel, err := filepath.Rel(outputDir, output); err == nil && output != "" {
+			output = rel
+		}
+		if e.Skip != "" {
+			skipped++
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", i+1, planCell(e.Input), planCell(e.VideoID),
+			planCell(e.Title), planCell(e.Channel), planCell(formatPlanDuration(e.Duration)), planCell(formatPlanScore(e.Score)),
+			planCell(output), planCell(e.Skip))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d items: %d to download into %s, %d skipped\n", len(entries), len(entries)-skipped, outputDir, skipped)
+	return err
+}
+
+// planCell keeps a table cell on one line and marks empty ones
+func planCell(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.NewReplacer("\n", " ", "\t", " ").Replace(s)
+}
+
+func formatPlanDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return config.FormatClock(d.Seconds())
+}
+
+func formatPlanScore(score *float64) string {
+	if score == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", *score)
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package downloader
+
+// processRunning cannot check processes on this platform, so staging directories are only removed once they are old
+func processRunning(pid int) bool {
+	return true
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package downloader
+
+import (
+	"errors"
+	"syscall"
+)
+
+// processRunning reports whether a process with the given ID exists
+func processRunning(pid int) bool {
+	// Signal 0 only checks for existence; EPERM means it exists but belongs to another user
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
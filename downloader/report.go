@@ -0,0 +1,69 @@
+package downloader
+
+import (
+	"log"
+	"time"
+
+	"github.com/ktappdev/ytaudio/engine"
+	"github.com/ktappdev/ytaudio/report"
+)
+
+// writeReports writes the report of a batch to every configured path
+func writeReports(paths []string, batchID string, started time.Time, jobs []*engine.Job[*Task]) {
+	if len(paths) == 0 {
+		return
+	}
+	r := report.New(batchID, started, time.Now(), reportEntries(jobs))
+	for _, path := range paths {
+		written, err := r.Write(path)
+		if err != nil {
+			log.Printf("Error writing report: %v", err)
+			continue
+		}
+		log.Printf("Wrote batch report to %s", written)
+	}
+}
+
+// reportEntries describes what became of every job of a batch
+func reportEntries(jobs []*engine.Job[*Task]) []report.Entry {
+	entries := make([]report.Entry, len(jobs))
+	for i, job := range jobs {
+		task := job.Value
+		entry := report.Entry{
+			Input:   task.Input.Query,
+			Status:  report.StatusDownloaded,
+			Elapsed: job.Elapsed(),
+		}
+		if entry.Input == "" {
+			entry.Input = task.Input.Target
+		}
+		if match := task.Match; match != nil {
+			score := match.Score
+			entry.VideoID, entry.Title, entry.Channel, entry.Duration = match.ID, match.Title, match.Channel, match.Duration
+			entry.Score = &score
+		} else if task.Item.Target != task.Input.Target {
+			entry.VideoID = task.Item.Target
+		}
+
+		if result := task.Result; result != nil {
+			entry.VideoID, entry.Title, entry.Channel, entry.Duration = result.VideoID, result.Title, result.Uploader, result.Duration
+			entry.OutputPath = result.outputPath()
+			entry.Size = result.diskUsage()
+		}
+		if job.Err != nil {
+			entry.Stage = job.Stage
+			entry.Class = ErrorClass(job.Err, job.Stage)
+			entry.Error = job.Err.Error()
+			switch entry.Class {
+			case ClassSkipped:
+				entry.Status = report.StatusSkipped
+			case ClassCorrupted:
+				entry.Status = report.StatusCorrupted
+			default:
+				entry.Status = report.StatusFailed
+			}
+		}
+		entries[i] = entry
+	}
+	return entries
+}
@@ -0,0 +1,110 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/postprocess"
+	"github.com/ktappdev/ytaudio/tagger"
+)
+
+// DownloadResult describes a finished download and the file it produced
+type DownloadResult struct {
+	VideoID  string          `json:"video_id"`
+	URL      string          `json:"url"`
+	Query    string          `json:"query,omitempty"`
+	FilePath string          `json:"file_path"`
+	Title    string          `json:"title"`
+	Uploader string          `json:"uploader"`
+	Duration time.Duration   `json:"duration"`
+	FileSize int64           `json:"file_size"`
+	Codec    string          `json:"codec"`
+	Bitrate  float64         `json:"bitrate_kbps"`
+	Elapsed  time.Duration   `json:"elapsed"`
+	Info     json.RawMessage `json:"info,omitempty"`
+
+	RemovedSegments []Segment           `json:"removed_segments,omitempty"`
+	PostProcess     *postprocess.Report `json:"postprocess,omitempty"`
+	Tags            *tagger.Metadata    `json:"tags,omitempty"`
+	Sidecars        []string            `json:"sidecars,omitempty"`
+	Range           *config.TimeRange   `json:"range,omitempty"`
+
+	Verification *postprocess.Verification `json:"verification,omitempty"`
+
+	// Chapter is set on tracks split from a chaptered video, Tracks on the video they came from
+	Chapter *Chapter          `json:"chapter,omitempty"`
+	Tracks  []*DownloadResult `json:"tracks,omitempty"`
+}
+
+// ytDlpInfo holds the subset of the yt-dlp info JSON that ytaudio uses
+type ytDlpInfo struct {
+	ID         string  `json:"id"`
+	Title      string  `json:"title"`
+	Uploader   string  `json:"uploader"`
+	Channel    string  `json:"channel"`
+	Duration   float64 `json:"duration"`
+	FilePath   string  `json:"filepath"`
+	WebpageURL string  `json:"webpage_url"`
+	Ext        string  `json:"ext"`
+	ACodec     string  `json:"acodec"`
+}
+
+// newDownloadResult builds a DownloadResult from the info JSON printed by yt-dlp after the final move
+func newDownloadResult(videoID string, infoJSON []byte, elapsed time.Duration) (*DownloadResult, error) {
+	var info ytDlpInfo
+	if err := json.Unmarshal(infoJSON, &info); err != nil {
+		return nil, fmt.Errorf("error parsing yt-dlp info JSON: %w", err)
+	}
+	if info.FilePath == "" {
+		return nil, fmt.Errorf("yt-dlp did not report an output file for %s", videoID)
+	}
+
+	result := &DownloadResult{
+		VideoID:  info.ID,
+		URL:      info.WebpageURL,
+		FilePath: info.FilePath,
+		Title:    info.Title,
+		Uploader: info.Uploader,
+		Duration: time.Duration(info.Duration * float64(time.Second)),
+		Codec:    strings.TrimPrefix(filepath.Ext(info.FilePath), "."),
+		Elapsed:  elapsed,
+		Info:     json.RawMessage(infoJSON),
+	}
+	if result.VideoID == "" {
+		result.VideoID = videoID
+	}
+	if result.Uploader == "" {
+		result.Uploader = info.Channel
+	}
+	if result.Codec == "" {
+		result.Codec = info.ACodec
+	}
+
+	if err := result.refreshFileInfo(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Download result: %s -> %s (%d bytes, %.0f kbps)", result.VideoID, result.FilePath, result.FileSize, result.Bitrate)
+	return result, nil
+}
+
+// refreshFileInfo updates the size and bitrate after the output file has been written or changed
+func (r *DownloadResult) refreshFileInfo() error {
+	stat, err := os.Stat(r.FilePath)
+	if err != nil {
+		return fmt.Errorf("error reading output file: %w", err)
+	}
+	r.FileSize = stat.Size()
+
+	// Average bitrate of the converted file, which is what ends up on disk
+	if r.Duration > 0 {
+		r.Bitrate = float64(r.FileSize*8) / r.Duration.Seconds() / 1000
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/youtube"
+)
+
+// ErrNoResults is returned when a search finds no videos at all
+var ErrNoResults = errors.New("no videos found")
+
+// Searcher finds the videos matching a query
+type Searcher interface {
+	Search(ctx context.Context, query string, results int) ([]youtube.Video, error)
+}
+
+// NewSearcher creates the search backend selected in the configuration
+func NewSearcher(cfg *config.Config) Searcher {
+	switch cfg.Search.Backend {
+	case config.SearchYtDlp:
+		return &ytDlpSearcher{binary: cfg.YtDlpPath, network: cfg.Network}
+	case config.SearchFake:
+		return fakeSearcher{}
+	default:
+		return apiSearcher{apiKey: cfg.APIKey}
+	}
+}
+
+// apiSearcher searches with the YouTube Data API
+type apiSearcher struct {
+	apiKey string
+}
+
+func (s apiSearcher) Search(ctx context.Context, query string, results int) ([]youtube.Video, error) {
+	return youtube.SearchVideosContext(ctx, query, s.apiKey, results)
+}
+
+// ytDlpSearcher searches through yt-dlp's ytsearch, which costs no API quota and also reports durations
+type ytDlpSearcher struct {
+	binary  string
+	network config.NetworkOptions
+}
+
+func (s *ytDlpSearcher) Search(ctx context.Context, query string, results int) ([]youtube.Video, error) {
+	log.Printf("Searching YouTube with yt-dlp for: %s", query)
+	args := []string{"--flat-playlist", "--dump-single-json", "--no-warnings"}
+	args = append(args, networkArgs(s.network)...)
+	args = append(args, "--", fmt.Sprintf("ytsearch%d:%s", results, query))
+
+	output, err := exec.CommandContext(ctx, s.binary, args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("yt-dlp search failed: %s", s.network.Redact(strings.TrimSpace(string(exitErr.Stderr))))
+		}
+		return nil, fmt.Errorf("yt-dlp search failed: %w", err)
+	}
+
+	var playlist struct {
+		Entries []struct {
+			ID       string  `json:"id"`
+			Title    string  `json:"title"`
+			Channel  string  `json:"channel"`
+			Uploader string  `json:"uploader"`
+			Duration float64 `json:"duration"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(output, &playlist); err != nil {
+		return nil, fmt.Errorf("error parsing yt-dlp search results: %w", err)
+	}
+
+	var videos []youtube.Video
+	for _, entry := range playlist.Entries {
+		video := youtube.Video{
+			ID:       entry.ID,
+			Title:    entry.Title,
+			Channel:  entry.Channel,
+			Duration: time.Duration(entry.Duration * float64(time.Second)),
+		}
+		if video.Channel == "" {
+			video.Channel = entry.Uploader
+		}
+		videos = append(videos, video)
+		log.Printf("Found video: %s (ID: %s)", video.Title, video.ID)
+	}
+	return videos, nil
+}
+
+// fakeSearcher makes up a few results per query so batches can run offline with the fake backend
+type fakeSearcher struct{}
+
+func (fakeSearcher) Search(ctx context.Context, query string, results int) ([]youtube.Video, error) {
+	versions := []string{" (Live)", "", " (Cover)", " (Karaoke)", " (Official Audio)"}
+	var videos []youtube.Video
+	for i := 0; i < results && i < len(versions); i++ {
+		videos = append(videos, youtube.Video{
+			ID:       fakeVideoID(fmt.Sprintf("%s#%d", query, i)),
+			Title:    query + versions[i],
+			Channel:  "Fake Channel",
+			Duration: time.Duration(30+fnvHash(query)%270) * time.Second,
+		})
+	}
+	return videos, nil
+}
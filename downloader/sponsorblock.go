@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// Segment is a stretch of a video, in seconds, identified by SponsorBlock
+type Segment struct {
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Category string  `json:"category"`
+}
+
+// sponsorBlockInfo holds the SponsorBlock data yt-dlp adds to the info JSON
+type sponsorBlockInfo struct {
+	Chapters []struct {
+		StartTime float64 `json:"start_time"`
+		EndTime   float64 `json:"end_time"`
+		Category  string  `json:"category"`
+	} `json:"sponsorblock_chapters"`
+}
+
+// sponsorBlockSidecar is the layout of the segments file written next to a download
+type sponsorBlockSidecar struct {
+	VideoID         string    `json:"video_id"`
+	Categories      []string  `json:"categories"`
+	APIURL          string    `json:"api_url"`
+	RemovedSegments []Segment `json:"removed_segments"`
+	RemovedSeconds  float64   `json:"removed_seconds"`
+}
+
+// sponsorBlockArgs maps the SponsorBlock options onto yt-dlp flags
+func sponsorBlockArgs(s config.SponsorBlockOptions) []string {
+	if !s.Enabled() {
+		return nil
+	}
+	args := []string{"--sponsorblock-remove", strings.Join(s.Remove, ",")}
+	if s.APIURL != "" {
+		args = append(args, "--sponsorblock-api", s.APIURL)
+	}
+	return args
+}
+
+// removedSegments extracts the segments yt-dlp cut out of the download from its info JSON
+func removedSegments(infoJSON []byte, s config.SponsorBlockOptions) []Segment {
+	if !s.Enabled() {
+		return nil
+	}
+
+	var info sponsorBlockInfo
+	if err := json.Unmarshal(infoJSON, &info); err != nil {
+		log.Printf("Error reading SponsorBlock segments: %v", err)
+		return nil
+	}
+
+	var segments []Segment
+	for _, chapter := range info.Chapters {
+		if !s.Removes(chapter.Category) {
+			continue
+		}
+		segments = append(segments, Segment{
+			Start:    chapter.StartTime,
+			End:      chapter.EndTime,
+			Category: chapter.Category,
+		})
+	}
+	return segments
+}
+
+// writeSponsorBlockSidecar records the removed segments in a JSON file next to the download
+func writeSponsorBlockSidecar(result *DownloadResult, s config.SponsorBlockOptions) (string, error) {
+	sidecar := sponsorBlockSidecar{
+		VideoID:         result.VideoID,
+		Categories:      s.Remove,
+		APIURL:          s.APIURL,
+		RemovedSegments: result.RemovedSegments,
+	}
+	if sidecar.APIURL == "" {
+		sidecar.APIURL = config.DefaultSponsorBlockAPI
+	}
+	if sidecar.RemovedSegments == nil {
+		sidecar.RemovedSegments = []Segment{}
+	}
+	for _, segment := range result.RemovedSegments {
+		sidecar.RemovedSeconds += segment.End - segment.Start
+	}
+
+	content, err := json.MarshalIndent(sidecar, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding SponsorBlock sidecar: %w", err)
+	}
+
+	path := sidecarPath(result.FilePath, "sponsorblock.json")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return "", fmt.Errorf("error writing SponsorBlock sidecar: %w", err)
+	}
+	log.Printf("Removed %d SponsorBlock segments (%.1fs) from %s", len(result.RemovedSegments), sidecar.RemovedSeconds, result.FilePath)
+	return path, nil
+}
+
+// sidecarPath returns the path of a metadata file stored alongside an audio file
+func sidecarPath(audioPath, suffix string) string {
+	return strings.TrimSuffix(audioPath, filepath.Ext(audioPath)) + "." + suffix
+}
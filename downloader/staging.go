@@ -0,0 +1,106 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stagingDirName is the hidden folder in the output directory holding unfinished jobs. It lives on the
+// same file system as the output so finished files are moved into place with a single rename.
+const stagingDirName = ".ytaudio-staging"
+
+// staleStagingAge is how old a staging directory has to be before it is removed even though
+// its process seems alive, which guards against reused process IDs
+const staleStagingAge = 7 * 24 * time.Hour
+
+// orphanStagingAge is how long a staging directory of a process that is not running must have been left
+// alone before it is removed. A process ID only identifies a process on this machine, and an output folder
+// on a network share may be in use by a ytaudio running elsewhere.
+const orphanStagingAge = time.Hour
+
+// newStagingDir creates a job directory named after the current process so cleanup can tell live jobs from dead ones
+func newStagingDir(outputDir string) (string, error) {
+	root := filepath.Join(outputDir, stagingDirName)
+	for attempt := 0; ; attempt++ {
+		if err := os.MkdirAll(root, 0755); err != nil {
+			return "", fmt.Errorf("error creating staging directory: %w", err)
+		}
+		dir, err := os.MkdirTemp(root, strconv.Itoa(os.Getpid())+"-")
+		// Another worker may have removed the empty root in between
+		if os.IsNotExist(err) && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("error creating staging directory: %w", err)
+		}
+		return dir, nil
+	}
+}
+
+// removeStagingDir deletes a job directory with whatever a failed or cancelled job left in it
+func removeStagingDir(dir string) {
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Error removing staging directory %s: %v", dir, err)
+	}
+	// Only succeeds once the last job of every running process is done
+	os.Remove(filepath.Dir(dir))
+}
+
+// CleanStaging removes the staging directories crashed or killed runs left in the output directory.
+// It runs once at startup, before this run creates staging directories of its own.
+func CleanStaging() {
+	cleanStaging(getDownloadPath())
+}
+
+// cleanStaging removes staging directories left behind by ytaudio processes that are no longer running
+func cleanStaging(outputDir string) {
+	root := filepath.Join(outputDir, stagingDirName)
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading staging directory %s: %v", root, err)
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(root, entry.Name())
+		if !stagingStale(entry) {
+			continue
+		}
+		log.Printf("Removing stale staging directory %s", path)
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("Error removing stale staging directory %s: %v", path, err)
+		}
+	}
+	// Only succeeds when nothing else is running
+	os.Remove(root)
+}
+
+// stagingStale reports whether a staging directory belongs to a process that is gone and has not
+// been touched for a while, or is old enough that its process ID may have been reused
+func stagingStale(entry os.DirEntry) bool {
+	info, err := entry.Info()
+	if err != nil {
+		return false
+	}
+	age := time.Since(info.ModTime())
+	if age > staleStagingAge {
+		return true
+	}
+	if age < orphanStagingAge {
+		return false
+	}
+	prefix, _, _ := strings.Cut(entry.Name(), "-")
+	pid, err := strconv.Atoi(prefix)
+	if err != nil || !entry.IsDir() {
+		// Not created by ytaudio, or a stray file
+		return true
+	}
+	return pid != os.Getpid() && !processRunning(pid)
+}
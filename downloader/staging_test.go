@@ -0,0 +1,70 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCleanStaging(t *testing.T) {
+	// Above the largest process ID Linux hands out
+	const deadPID = 1<<22 + 1
+	if processRunning(deadPID) {
+		t.Skip("cannot tell running processes apart on this system")
+	}
+	live := strconv.Itoa(os.Getpid())
+	dead := strconv.Itoa(deadPID)
+
+	tests := []struct {
+		name string
+		age  time.Duration
+		dir  bool
+		kept bool
+	}{
+		{live + "-running", 2 * time.Hour, true, true},
+		{live + "-reused", 8 * 24 * time.Hour, true, false},
+		{dead + "-crashed", 2 * time.Hour, true, false},
+		{dead + "-recent", 10 * time.Minute, true, true}, // maybe a ytaudio on another machine
+		{"notes.txt", 2 * time.Hour, false, false},
+		{"fresh.txt", time.Minute, false, true},
+	}
+
+	output := t.TempDir()
+	root := filepath.Join(output, stagingDirName)
+	for _, tt := range tests {
+		path := filepath.Join(root, tt.name)
+		if tt.dir {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(path, "abc.mp3"), []byte("audio"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		} else if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified := time.Now().Add(-tt.age)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cleanStaging(output)
+	for _, tt := range tests {
+		_, err := os.Stat(filepath.Join(root, tt.name))
+		if kept := err == nil; kept != tt.kept {
+			t.Errorf("%s kept = %v, want %v", tt.name, kept, tt.kept)
+		}
+	}
+
+	// Once every job is gone the staging directory itself goes as well
+	for _, tt := range tests {
+		os.RemoveAll(filepath.Join(root, tt.name))
+	}
+	cleanStaging(output)
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Errorf("empty staging directory kept: %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ktappdev/ytaudio/tagger"
+)
+
+// musicInfo holds the music metadata yt-dlp extracts for YouTube Music and similar uploads
+type musicInfo struct {
+	Artist      string `json:"artist"`
+	Track       string `json:"track"`
+	Album       string `json:"album"`
+	ReleaseYear int    `json:"release_year"`
+	UploadDate  string `json:"upload_date"`
+}
+
+// resolveMetadata picks the tags for a download, preferring what the user supplied over what the video says
+func resolveMetadata(item Item, result *DownloadResult, opts Options) tagger.Metadata {
+	meta := item.Metadata
+
+	// Queries in "Artist - Title" form are the next best source
+	if item.Query != "" && (meta.Artist == "" || meta.Title == "") {
+		artist, title := tagger.ParseQuery(item.Query)
+		if artist != "" {
+			meta = meta.Merge(tagger.Metadata{Artist: artist, Title: title})
+		}
+	}
+
+	// Then the music metadata yt-dlp found, then the plain video details
+	var info musicInfo
+	if len(result.Info) > 0 {
+		if err := json.Unmarshal(result.Info, &info); err != nil {
+			log.Printf("Error reading music metadata from info JSON: %v", err)
+		}
+	}
+	external := tagger.Metadata{
+		Artist: info.Artist,
+		Title:  info.Track,
+		Album:  info.Album,
+	}
+	if info.ReleaseYear > 0 {
+		external.Year = strconv.Itoa(info.ReleaseYear)
+	}
+	meta = meta.Merge(external)
+
+	meta = meta.Merge(tagger.Metadata{
+		Artist:  strings.TrimSuffix(result.Uploader, " - Topic"),
+		Title:   result.Title,
+		Album:   opts.Tags.Album,
+		Year:    opts.Tags.Year,
+		Genre:   opts.Tags.Genre,
+		Comment: result.URL,
+	})
+	// Without a release year or --year, the upload date (YYYYMMDD) is the best guess
+	if len(info.UploadDate) >= 4 {
+		meta = meta.Merge(tagger.Metadata{Year: info.UploadDate[:4]})
+	}
+
+	// Clips keep a user-supplied title, derived ones say which part of the video they are
+	if result.Range != nil {
+		if item.Metadata.Title == "" {
+			meta.Title += " (" + result.Range.String() + ")"
+		}
+		meta.Comment += " (" + result.Range.String() + ")"
+	}
+	return meta
+}
+
+// writeTags resolves and writes the tags and cover art of a finished download
+func writeTags(ctx context.Context, item Item, result *DownloadResult, opts Options) error {
+	var meta tagger.Metadata
+	if opts.Tags.Enabled {
+		meta = resolveMetadata(item, result, opts)
+		meta.Cover = nil
+		tags := meta
+		result.Tags = &tags
+	}
+
+	// Only the tracks split from a video have a folder of their own; flat downloads of different playlists,
+	// albums and songs share the output folder, where one cover.jpg would stand for all of them
+	folderCover := opts.Artwork.SaveCover && result.Chapter != nil
+	if opts.Artwork.Embed || folderCover {
+		// Split tracks share the cover fetched for their video, missing artwork never fails a download
+		cover := item.Metadata.Cover
+		var err error
+		if cover == nil {
+			cover, err = coverArt(ctx, result, opts)
+		}
+		if err != nil {
+			log.Printf("Skipping cover art for %s: %v", result.FilePath, err)
+		} else {
+			if opts.Artwork.Embed {
+				meta.Cover = cover
+			}
+			// Split tracks are still in their staging folder, which moves as a whole
+			if folderCover {
+				if err := saveCover(filepath.Dir(result.FilePath), cover); err != nil {
+					log.Printf("Error saving cover art: %v", err)
+				}
+			}
+		}
+	}
+	if !opts.Tags.Enabled && meta.Cover == nil {
+		return nil
+	}
+
+	if err := tagger.Write(result.FilePath, meta); err != nil {
+		if errors.Is(err, tagger.ErrUnsupportedFormat) {
+			log.Printf("Skipping tags for %s: %v", result.FilePath, err)
+			return nil
+		}
+		return err
+	}
+	return result.refreshFileInfo()
+}
@@ -0,0 +1,111 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/postprocess"
+)
+
+// sectionInfo holds the fields yt-dlp adds to the info JSON when it downloaded a section
+type sectionInfo struct {
+	SectionStart *float64 `json:"section_start"`
+	SectionEnd   *float64 `json:"section_end"`
+}
+
+// itemRange picks the time range of an item: its own, then the one given on the command line,
+// then a t= parameter in a pasted URL
+func itemRange(item Item, opts Options) config.TimeRange {
+	if !item.Range.IsZero() {
+		return item.Range
+	}
+	if !opts.Range.IsZero() {
+		return opts.Range
+	}
+	return rangeFromURL(item.Target)
+}
+
+// rangeFromURL reads the start time of links such as watch?v=ID&t=83s, youtu.be/ID?t=1h2m or embed/ID?start=83&end=120
+func rangeFromURL(target string) config.TimeRange {
+	if !strings.Contains(target, "://") {
+		return config.TimeRange{}
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return config.TimeRange{}
+	}
+
+	query := u.Query()
+	if fragment, err := url.ParseQuery(u.Fragment); err == nil && query.Get("t") == "" {
+		query.Set("t", fragment.Get("t"))
+	}
+
+	var r config.TimeRange
+	for _, key := range []string{"t", "start"} {
+		if value := query.Get(key); value != "" {
+			if seconds, err := config.ParseTimestamp(value); err == nil {
+				r.Start = seconds
+				break
+			}
+			log.Printf("Ignoring invalid %s=%s in %s", key, value, target)
+		}
+	}
+	if value := query.Get("end"); value != "" {
+		if seconds, err := config.ParseTimestamp(value); err == nil && seconds > r.Start {
+			r.End = seconds
+		}
+	}
+	if !r.IsZero() {
+		log.Printf("Using time range %s from URL %s", r, target)
+	}
+	return r
+}
+
+// sectionArgs maps a time range onto yt-dlp's --download-sections
+func sectionArgs(r config.TimeRange) []string {
+	if r.IsZero() {
+		return nil
+	}
+	end := "inf"
+	if r.End > 0 {
+		end = formatSeconds(r.End)
+	}
+	return []string{"--download-sections", "*" + formatSeconds(r.Start) + "-" + end}
+}
+
+// applyRange records the range on a result, cutting the file with ffmpeg when the backend downloaded the whole video
+func applyRange(ctx context.Context, result *DownloadResult, r config.TimeRange, opts Options) error {
+	var info sectionInfo
+	if len(result.Info) > 0 {
+		if err := json.Unmarshal(result.Info, &info); err != nil {
+			log.Printf("Error reading section info: %v", err)
+		}
+	}
+
+	if info.SectionStart != nil && info.SectionEnd != nil {
+		result.Duration = time.Duration((*info.SectionEnd - *info.SectionStart) * float64(time.Second))
+	} else {
+		log.Printf("Backend downloaded the whole video, cutting %s from %s", r, result.FilePath)
+		ext := filepath.Ext(result.FilePath)
+		tmpPath := strings.TrimSuffix(result.FilePath, ext) + ".ytaudio-cut" + ext
+		if err := postprocess.Cut(ctx, result.FilePath, tmpPath, r.Start, r.End, opts.PostProcess); err != nil {
+			return fmt.Errorf("error cutting %s: %w", result.FilePath, err)
+		}
+		if err := os.Rename(tmpPath, result.FilePath); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("error replacing %s: %w", result.FilePath, err)
+		}
+		result.Duration = r.Length(result.Duration)
+	}
+
+	result.Range = &r
+	return result.refreshFileInfo()
+}
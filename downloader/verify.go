@@ -0,0 +1,169 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/postprocess"
+)
+
+// CorruptError reports a download that still failed verification after every retry
+type CorruptError struct {
+	Target   string
+	Problems []string
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("corrupted download of %s: %s", e.Target, strings.Join(e.Problems, "; "))
+}
+
+// countCorrupted counts the downloads that failed verification
+func countCorrupted(errs []error) int {
+	var n int
+	for _, err := range errs {
+		var corrupt *CorruptError
+		if errors.As(err, &corrupt) {
+			n++
+		}
+	}
+	return n
+}
+
+// fetch downloads an item and cuts it to its time range, retrying downloads that fail verification
+func fetch(ctx context.Context, dl Downloader, item Item, opts Options) (*DownloadResult, error) {
+	for attempt := 0; ; attempt++ {
+		result, err := dl.Download(ctx, item.Target, opts)
+		if err != nil {
+			return nil, err
+		}
+		if !opts.Range.IsZero() {
+			if err := applyRange(ctx, result, opts.Range, opts); err != nil {
+				return nil, err
+			}
+		}
+		if !opts.Verify.Enabled {
+			return result, nil
+		}
+
+		verification, err := postprocess.Verify(ctx, result.FilePath, expectation(result, opts), opts.Verify, opts.PostProcess)
+		if err != nil {
+			return nil, fmt.Errorf("error verifying %s: %w", result.FilePath, err)
+		}
+		result.Verification = verification
+		if verification.OK() {
+			log.Printf("Verified %s: %s, %.0f kbps, %s", result.FilePath, verification.Codec, verification.Bitrate, config.FormatClock(verification.DecodedDuration))
+			return result, nil
+		}
+
+		log.Printf("Verification of %s failed: %s", result.FilePath, strings.Join(verification.Problems, "; "))
+		if err := os.Remove(result.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing %s: %v", result.FilePath, err)
+		}
+		if attempt >= opts.Verify.Retries {
+			return nil, &CorruptError{Target: item.Target, Problems: verification.Problems}
+		}
+		log.Printf("Retrying %s (%d of %d)", item.Target, attempt+1, opts.Verify.Retries)
+	}
+}
+
+// expectation derives what a download should look like from its info JSON and the requested format
+func expectation(result *DownloadResult, opts Options) postprocess.Expectation {
+	expect := postprocess.Expectation{
+		Duration: result.Duration.Seconds(),
+		Codec:    postprocess.CodecForFormat(opts.AudioFormat),
+	}
+	// Removed SponsorBlock segments are missing from the file but not from the reported duration
+	if result.Range == nil {
+		for _, segment := range result.RemovedSegments {
+			expect.Duration -= segment.End - segment.Start
+		}
+	}
+	return expect
+}
+
+// verifyTrack checks a track cut from a split video before its folder is committed. Tracks must not be empty, and
+// with --verify they must decode to the end at the length of their chapter, since a failed cut is not retried.
+func verifyTrack(ctx context.Context, item Item, result, track *DownloadResult, opts Options) error {
+	if err := verifyStaged(track); err != nil {
+		return err
+	}
+	if !opts.Verify.Enabled {
+		return nil
+	}
+
+	expect := postprocess.Expectation{
+		Duration: track.Duration.Seconds(),
+		Codec:    postprocess.CodecForFormat(opts.AudioFormat),
+	}
+	// Chapter times are those of the video, removed SponsorBlock segments move them
+	if len(result.RemovedSegments) > 0 {
+		expect.Duration = 0
+	}
+	verification, err := postprocess.Verify(ctx, track.FilePath, expect, opts.Verify, opts.PostProcess)
+	if err != nil {
+		return fmt.Errorf("error verifying %s: %w", track.FilePath, err)
+	}
+	track.Verification = verification
+	if !verification.OK() {
+		log.Printf("Verification of %s failed: %s", track.FilePath, strings.Join(verification.Problems, "; "))
+		problems := make([]string, len(verification.Problems))
+		for i, problem := range verification.Problems {
+			problems[i] = fmt.Sprintf("chapter %d: %s", track.Chapter.Index, problem)
+		}
+		return &CorruptError{Target: item.Target, Problems: problems}
+	}
+	log.Printf("Verified %s: %s, %.0f kbps, %s", track.FilePath, verification.Codec, verification.Bitrate, config.FormatClock(verification.DecodedDuration))
+	return nil
+}
+
+// VerifyDir checks every audio file below dir the way downloads are verified and returns the corrupted ones.
+// Without the original video only the codec matching the extension and the length stored in the file are checked.
+func VerifyDir(ctx context.Context, dir string, verify config.VerifyOptions, post config.PostProcessOptions) ([]string, error) {
+	if err := postprocess.CheckFFmpeg(ctx, post); err != nil {
+		return nil, err
+	}
+
+	var checked int
+	var corrupted []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == stagingDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !postprocess.IsAudioFile(path) {
+			return nil
+		}
+
+		expect := postprocess.Expectation{Codec: postprocess.CodecForFormat(filepath.Ext(path))}
+		verification, err := postprocess.Verify(ctx, path, expect, verify, post)
+		if err != nil {
+			return err
+		}
+		checked++
+		if verification.OK() {
+			fmt.Printf("OK        %s\n", path)
+			return nil
+		}
+		fmt.Printf("CORRUPTED %s: %s\n", path, strings.Join(verification.Problems, "; "))
+		corrupted = append(corrupted, path)
+		return nil
+	})
+	if err != nil {
+		return corrupted, err
+	}
+
+	fmt.Printf("\nChecked %d files, %d corrupted\n", checked, len(corrupted))
+	return corrupted, nil
+}
@@ -0,0 +1,273 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/exitcode"
+	"github.com/ktappdev/ytaudio/throttle"
+)
+
+// MinYtDlpVersion is the oldest yt-dlp release that supports every flag ytaudio passes
+const MinYtDlpVersion = "2023.03.04"
+
+// YtDlp downloads audio by running the yt-dlp executable (much more reliable than the Go library)
+type YtDlp struct {
+	Binary    string
+	ExtraArgs []string
+
+	limiter  *throttle.Limiter
+	proxyURL string
+}
+
+// NewYtDlp creates a yt-dlp backend, falling back to yt-dlp on PATH when binary is empty
+func NewYtDlp(binary string, extraArgs []string) *YtDlp {
+	if binary == "" {
+		binary = "yt-dlp"
+	}
+	return &YtDlp{
+		Binary:    binary,
+		ExtraArgs: extraArgs,
+	}
+}
+
+// CheckVersion verifies that yt-dlp is installed and recent enough
+func (y *YtDlp) CheckVersion(ctx context.Context) error {
+	output, err := exec.CommandContext(ctx, y.Binary, "--version").Output()
+	if err != nil {
+		return exitcode.Wrap(exitcode.Dependency, fmt.Errorf("yt-dlp not found at %q. Please install it with: brew install yt-dlp (or pip install yt-dlp), or point --yt-dlp at the executable", y.Binary))
+	}
+
+	version := strings.TrimSpace(string(output))
+	log.Printf("Using yt-dlp %s (%s)", version, y.Binary)
+	if compareVersions(version, MinYtDlpVersion) < 0 {
+		return exitcode.Wrap(exitcode.Dependency, fmt.Errorf("yt-dlp %s is too old, ytaudio needs %s or newer. Update it with: yt-dlp -U, pip install -U yt-dlp or brew upgrade yt-dlp", version, MinYtDlpVersion))
+	}
+	return nil
+}
+
+// Download runs yt-dlp for a single target and returns the resulting file
+func (y *YtDlp) Download(ctx context.Context, target string, opts Options) (*DownloadResult, error) {
+	url := videoURL(target)
+	network, release := y.limitNetwork(opts.Network)
+	defer release()
+	opts.Network = network
+
+	log.Printf("Downloading from: %s", url)
+	log.Printf("Download path: %s", opts.OutputDir)
+	log.Printf("Network options: %s", opts.Network)
+	log.Printf("SponsorBlock: %s", opts.SponsorBlock)
+
+	args := y.buildArgs(url, opts)
+
+	// A failed precheck cancels the download with the reason as cause
+	dlCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	cmd := exec.CommandContext(dlCtx, y.Binary, args...)
+
+	// Create a pipe to capture output for progress monitoring
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating stderr pipe: %w", err)
+	}
+
+	// Start the command
+	log.Println("Starting yt-dlp download...")
+	startTime := time.Now()
+	if startErr := cmd.Start(); startErr != nil {
+		return nil, fmt.Errorf("error starting yt-dlp: %w", startErr)
+	}
+
+	var readers sync.WaitGroup
+	readers.Add(2)
+
+	// Monitor progress from stderr (yt-dlp outputs progress to stderr)
+	go func() {
+		defer readers.Done()
+		logYtDlpOutput(stderr, "yt-dlp", opts.Network)
+	}()
+
+	// Capture stdout, which carries the info JSON printed after the final move
+	var infoJSON []byte
+	go func() {
+		defer readers.Done()
+		infoJSON = scanYtDlpStdout(stdout, func(line string) {
+			duration, size := parsePrecheck(line, opts.Range)
+			if err := checkItemLimits(target, duration, size, opts); err != nil {
+				log.Printf("Aborting download: %v", err)
+				cancel(err)
+			}
+		})
+	}()
+
+	// Wait for the output to be drained before waiting on the command
+	readers.Wait()
+	if err := cmd.Wait(); err != nil {
+		var skip *SkipError
+		if errors.As(context.Cause(dlCtx), &skip) {
+			return nil, skip
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("yt-dlp download cancelled: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("yt-dlp download failed: %w", err)
+	}
+
+	if infoJSON == nil {
+		if max := opts.Guard.maxFileSize(); max > 0 {
+			// yt-dlp silently drops streams that grow past --max-filesize
+			return nil, &SkipError{Target: target, Reason: fmt.Sprintf("no output, the download probably exceeded the allowed %s", config.ByteSize(max))}
+		}
+		return nil, fmt.Errorf("yt-dlp finished without reporting an output file for %s", target)
+	}
+	result, err := newDownloadResult(target, infoJSON, time.Since(startTime))
+	if err != nil {
+		return nil, err
+	}
+	result.RemovedSegments = removedSegments(infoJSON, opts.SponsorBlock)
+	return result, nil
+}
+
+// buildArgs assembles the yt-dlp command line for a download
+func (y *YtDlp) buildArgs(url string, opts Options) []string {
+	args := []string{
+		"-f", "bestaudio", // Download only audio stream (more efficient)
+		"--extract-audio", // Extract audio only
+		"--audio-format", opts.AudioFormat,
+		"--audio-quality", opts.AudioQuality,
+		"--output", filepath.Join(opts.OutputDir, opts.OutputTemplate),
+		"--no-playlist",              // Don't download playlists
+		"--embed-metadata",           // Embed metadata
+		"--add-metadata",             // Add metadata
+		"--print", "after_move:%()j", // Print the final info JSON (includes the output filepath)
+		"--progress", // Keep progress output, --print implies --quiet
+		"--newline",  // One progress update per line
+	}
+	args = append(args, networkArgs(opts.Network)...)
+	args = append(args, sponsorBlockArgs(opts.SponsorBlock)...)
+	args = append(args, sectionArgs(opts.Range)...)
+	args = append(args, limitArgs(opts)...)
+	args = append(args, y.ExtraArgs...)
+	return append(args, "--", url)
+}
+
+// networkArgs maps the networking and authentication options onto yt-dlp flags
+func networkArgs(n config.NetworkOptions) []string {
+	var args []string
+	if n.CookiesFile != "" {
+		args = append(args, "--cookies", n.CookiesFile)
+	}
+	if n.CookiesFromBrowser != "" {
+		args = append(args, "--cookies-from-browser", n.CookiesFromBrowser)
+	}
+	if n.Proxy != "" {
+		args = append(args, "--proxy", n.Proxy)
+	}
+	if n.SourceAddress != "" {
+		args = append(args, "--source-address", n.SourceAddress)
+	}
+	if n.LimitRate != "" {
+		args = append(args, "--limit-rate", n.LimitRate)
+	}
+	if n.SleepInterval > 0 {
+		args = append(args, "--sleep-interval", formatSeconds(n.SleepInterval))
+	}
+	if n.MaxSleepInterval > 0 {
+		args = append(args, "--max-sleep-interval", formatSeconds(n.MaxSleepInterval))
+	}
+	if n.SleepRequests > 0 {
+		args = append(args, "--sleep-requests", formatSeconds(n.SleepRequests))
+	}
+	if n.UserAgent != "" {
+		args = append(args, "--user-agent", n.UserAgent)
+	}
+	return args
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
+
+// logYtDlpOutput logs each line of yt-dlp output, with the proxy credentials of network hidden, and reports download progress
+func logYtDlpOutput(r io.Reader, prefix string, network config.NetworkOptions) {
+	scanner := bufio.NewScanner(r)
+	progressRegex := regexp.MustCompile(`\[(\d+\.\d+)%\]`)
+
+	for scanner.Scan() {
+		line := network.Redact(scanner.Text())
+		log.Printf("%s: %s", prefix, line)
+
+		// Extract progress percentage
+		if matches := progressRegex.FindStringSubmatch(line); len(matches) > 1 {
+			if progress, parseErr := strconv.ParseFloat(matches[1], 64); parseErr == nil {
+				fmt.Printf("\rProgress: %.1f%%", progress)
+			}
+		}
+	}
+}
+
+// scanYtDlpStdout logs yt-dlp stdout, hands precheck lines to onPrecheck and returns the last info JSON line it printed
+func scanYtDlpStdout(r io.Reader, onPrecheck func(line string)) []byte {
+	scanner := bufio.NewScanner(r)
+	// Info JSON lines can be far longer than the default scanner limit
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	var infoJSON []byte
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if bytes.HasPrefix(line, []byte("{")) {
+			infoJSON = append([]byte(nil), line...)
+			log.Printf("yt-dlp stdout: received info JSON (%d bytes)", len(line))
+			continue
+		}
+		if bytes.HasPrefix(line, []byte(precheckPrefix)) {
+			log.Printf("yt-dlp stdout: %s", line)
+			onPrecheck(string(line))
+			continue
+		}
+		log.Printf("yt-dlp stdout: %s", line)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading yt-dlp output: %v", err)
+	}
+	return infoJSON
+}
+
+// compareVersions compares dotted yt-dlp versions such as 2024.08.06 numerically
+func compareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,247 @@
+// Package engine runs batches of jobs through a fixed sequence of stages, each with its own pool of workers.
+// It knows nothing about downloading; callers supply the stage functions and the job payload type.
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// State is where a job is in its life cycle
+type State string
+
+const (
+	Queued  State = "queued"
+	Running State = "running"
+	Done    State = "done"
+	Failed  State = "failed"
+)
+
+// Job is one unit of work moving through the stages of an engine. Its fields are only written by the
+// worker holding the job, so they are safe to read in event callbacks and once Run has returned.
+type Job[T any] struct {
+	Index    int // position in the submitted list
+	Value    T
+	State    State
+	Stage    string // current stage while running, the last one reached afterwards
+	Err      error
+	Started  time.Time
+	Finished time.Time
+}
+
+// Elapsed is how long the job has been or was in the engine
+func (j *Job[T]) Elapsed() time.Duration {
+	if j.Started.IsZero() {
+		return 0
+	}
+	if j.Finished.IsZero() {
+		return time.Since(j.Started)
+	}
+	return j.Finished.Sub(j.Started)
+}
+
+// Stage is a step every job goes through, run by Workers goroutines in parallel
+type Stage[T any] struct {
+	Name    string
+	Workers int
+	Run     func(ctx context.Context, job *Job[T]) error
+}
+
+// EventType tells what happened to a job
+type EventType string
+
+const (
+	JobQueued     EventType = "queued"
+	StageStarted  EventType = "stage_started"
+	StageFinished EventType = "stage_finished"
+	JobDone       EventType = "done"
+	JobFailed     EventType = "failed"
+)
+
+// Event reports a change of a job
+type Event[T any] struct {
+	Type  EventType
+	Stage string
+	Job   *Job[T]
+	Total int // jobs in the batch; for a stream, the jobs received so far
+}
+
+// Engine runs jobs through its stages in order
+type Engine[T any] struct {
+	Stages []Stage[T]
+
+	// OnEvent is called for every change of a job; calls are serialized so callbacks need no locking
+	OnEvent func(Event[T])
+
+	// Finish is called once for every job that left the engine, whether it succeeded or not. It runs on the
+	// worker that finished the job, after the job's last event, and may be called concurrently for different jobs.
+	Finish func(job *Job[T])
+
+	eventMu  sync.Mutex
+	total    int
+	streamed bool // total counts the jobs queued so far
+}
+
+// New creates an engine with the given stages
+func New[T any](stages ...Stage[T]) *Engine[T] {
+	return &Engine[T]{Stages: stages}
+}
+
+// Run pushes every value through all stages and returns the jobs in submission order.
+// A job that fails a stage skips the remaining ones; once ctx is cancelled, jobs that have
+// not started a stage yet fail with the cause of the cancellation.
+func (e *Engine[T]) Run(ctx context.Context, values []T) []*Job[T] {
+	if len(values) == 0 {
+		return []*Job[T]{}
+	}
+	e.total, e.streamed = len(values), false
+
+	// Every channel can hold the whole batch, so a stage never blocks on the next one
+	next := 0
+	return e.run(ctx, len(values), func() (T, bool) {
+		if next == len(values) {
+			var zero T
+			return zero, false
+		}
+		next++
+		return values[next-1], true
+	})
+}
+
+// RunStream is Run for values that arrive over time: each one starts as soon as it is received, and the
+// jobs are returned once values is closed and every job has left the engine. Stages hand jobs on through
+// small buffers, so a slow stage holds back reading instead of queueing the whole input. Once ctx is
+// cancelled no more values are taken.
+func (e *Engine[T]) RunStream(ctx context.Context, values <-chan T) []*Job[T] {
+	e.total, e.streamed = 0, true
+	return e.run(ctx, 0, func() (T, bool) {
+		select {
+		case value, ok := <-values:
+			return value, ok
+		case <-ctx.Done():
+			var zero T
+			return zero, false
+		}
+	})
+}
+
+// run feeds the values returned by next into the first stage until it reports the end of the input.
+// Each stage's input holds buffer jobs, or as many as the stage has workers when buffer is 0.
+func (e *Engine[T]) run(ctx context.Context, buffer int, next func() (T, bool)) []*Job[T] {
+	if len(e.Stages) == 0 {
+		panic("engine: no stages")
+	}
+
+	inputs := make([]chan *Job[T], len(e.Stages))
+	for i, stage := range e.Stages {
+		size := buffer
+		if size == 0 {
+			size = max(stage.Workers, 1)
+		}
+		inputs[i] = make(chan *Job[T], size)
+	}
+
+	var stagesDone sync.WaitGroup
+	for i := range e.Stages {
+		stagesDone.Add(1)
+		go func(i int) {
+			defer stagesDone.Done()
+			var next chan<- *Job[T]
+			if i+1 < len(e.Stages) {
+				next = inputs[i+1]
+				defer close(inputs[i+1])
+			}
+			e.runStage(ctx, e.Stages[i], inputs[i], next)
+		}(i)
+	}
+
+	jobs := []*Job[T]{}
+	for value, ok := next(); ok; value, ok = next() {
+		job := &Job[T]{Index: len(jobs), Value: value, State: Queued}
+		jobs = append(jobs, job)
+		e.emit(Event[T]{Type: JobQueued, Job: job})
+		inputs[0] <- job
+	}
+	close(inputs[0])
+
+	stagesDone.Wait()
+	return jobs
+}
+
+// runStage starts the workers of a stage and waits until its input is drained; jobs that pass
+// the last stage, which has no next channel, are done
+func (e *Engine[T]) runStage(ctx context.Context, stage Stage[T], in <-chan *Job[T], next chan<- *Job[T]) {
+	workers := stage.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range in {
+				err := e.runJob(ctx, stage, job)
+				switch {
+				case err != nil:
+					job.State = Failed
+					job.Err = err
+					e.finish(Event[T]{Type: JobFailed, Stage: stage.Name, Job: job})
+				case next == nil:
+					job.State = Done
+					e.finish(Event[T]{Type: JobDone, Stage: stage.Name, Job: job})
+				default:
+					next <- job
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// finish records that a job left the engine and hands it to the Finish callback
+func (e *Engine[T]) finish(event Event[T]) {
+	event.Job.Finished = time.Now()
+	e.emit(event)
+	if e.Finish != nil {
+		e.Finish(event.Job)
+	}
+}
+
+// runJob runs one stage for a job, turning panics into errors so one bad item cannot take down the batch
+func (e *Engine[T]) runJob(ctx context.Context, stage Stage[T], job *Job[T]) (err error) {
+	if ctx.Err() != nil {
+		return fmt.Errorf("skipped before %s: %w", stage.Name, context.Cause(ctx))
+	}
+	if job.Started.IsZero() {
+		job.Started = time.Now()
+	}
+	job.State = Running
+	job.Stage = stage.Name
+	e.emit(Event[T]{Type: StageStarted, Stage: stage.Name, Job: job})
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s panicked: %v", stage.Name, r)
+		}
+		if err == nil {
+			e.emit(Event[T]{Type: StageFinished, Stage: stage.Name, Job: job})
+		}
+	}()
+	return stage.Run(ctx, job)
+}
+
+func (e *Engine[T]) emit(event Event[T]) {
+	e.eventMu.Lock()
+	defer e.eventMu.Unlock()
+	if event.Type == JobQueued && e.streamed {
+		e.total++
+	}
+	if e.OnEvent == nil {
+		return
+	}
+	event.Total = e.total
+	e.OnEvent(event)
+}
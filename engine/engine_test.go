@@ -0,0 +1,230 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// record returns a stage that appends "<stage>:<value>" to log, failing the values in fail
+func record(name string, workers int, log *[]string, mu *sync.Mutex, fail ...int) Stage[int] {
+	return Stage[int]{Name: name, Workers: workers, Run: func(ctx context.Context, job *Job[int]) error {
+		mu.Lock()
+		*log = append(*log, fmt.Sprintf("%s:%d", name, job.Value))
+		mu.Unlock()
+		if slices.Contains(fail, job.Value) {
+			return fmt.Errorf("%s failed %d", name, job.Value)
+		}
+		return nil
+	}}
+}
+
+func TestRun(t *testing.T) {
+	var mu sync.Mutex
+	var log []string
+	e := New(record("resolve", 1, &log, &mu), record("download", 4, &log, &mu, 2), record("tag", 2, &log, &mu))
+
+	values := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	jobs := e.Run(context.Background(), values)
+
+	if len(jobs) != len(values) {
+		t.Fatalf("Run returned %d jobs, want %d", len(jobs), len(values))
+	}
+	for i, job := range jobs {
+		if job.Index != i || job.Value != values[i] {
+			t.Errorf("job %d = index %d value %d, want submission order", i, job.Index, job.Value)
+		}
+		if job.Finished.IsZero() || job.Elapsed() < 0 {
+			t.Errorf("job %d has no finish time", i)
+		}
+		want, wantStage := Done, "tag"
+		if i == 2 {
+			want, wantStage = Failed, "download"
+		}
+		if job.State != want || job.Stage != wantStage {
+			t.Errorf("job %d = %s in %s, want %s in %s", i, job.State, job.Stage, want, wantStage)
+		}
+	}
+	if jobs[2].Err == nil || jobs[2].Err.Error() != "download failed 2" {
+		t.Errorf("job 2 error = %v", jobs[2].Err)
+	}
+
+	// Every job runs its stages in order, and a failed job skips the rest
+	for _, value := range values {
+		var stages []string
+		for _, entry := range log {
+			if name, v, _ := strings.Cut(entry, ":"); v == fmt.Sprint(value) {
+				stages = append(stages, name)
+			}
+		}
+		want := []string{"resolve", "download", "tag"}
+		if value == 2 {
+			want = want[:2]
+		}
+		if !slices.Equal(stages, want) {
+			t.Errorf("job %d ran %v, want %v", value, stages, want)
+		}
+	}
+
+	// A single worker takes jobs in submission order
+	var resolved []string
+	for _, entry := range log {
+		if strings.HasPrefix(entry, "resolve:") {
+			resolved = append(resolved, entry)
+		}
+	}
+	if !slices.IsSorted(resolved) {
+		t.Errorf("resolve ran %v, want submission order", resolved)
+	}
+}
+
+func TestRunEvents(t *testing.T) {
+	var mu sync.Mutex
+	var log []string
+	e := New(record("a", 2, &log, &mu, 1), record("b", 2, &log, &mu))
+
+	events := make(map[int][]EventType)
+	e.OnEvent = func(event Event[int]) {
+		if event.Total != 3 {
+			t.Errorf("event total = %d, want 3", event.Total)
+		}
+		events[event.Job.Value] = append(events[event.Job.Value], event.Type)
+	}
+	var finished []int
+	var finishMu sync.Mutex
+	e.Finish = func(job *Job[int]) {
+		finishMu.Lock()
+		finished = append(finished, job.Value)
+		finishMu.Unlock()
+	}
+	e.Run(context.Background(), []int{0, 1, 2})
+
+	done := []EventType{JobQueued, StageStarted, StageFinished, StageStarted, StageFinished, JobDone}
+	failed := []EventType{JobQueued, StageStarted, JobFailed}
+	for value, want := range map[int][]EventType{0: done, 1: failed, 2: done} {
+		if !slices.Equal(events[value], want) {
+			t.Errorf("job %d events = %v, want %v", value, events[value], want)
+		}
+	}
+	slices.Sort(finished)
+	if !slices.Equal(finished, []int{0, 1, 2}) {
+		t.Errorf("Finish called for %v, want every job once", finished)
+	}
+}
+
+func TestRunFailFast(t *testing.T) {
+	errStop := errors.New("stopping after the first failure")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+
+	var mu sync.Mutex
+	var log []string
+	e := New(record("download", 1, &log, &mu, 2))
+	// Like a batch with --fail-fast, the first failure cancels everything still queued
+	e.Finish = func(job *Job[int]) {
+		if job.State == Failed {
+			cancel(errStop)
+		}
+	}
+	jobs := e.Run(ctx, []int{0, 1, 2, 3, 4})
+
+	for i, job := range jobs[:2] {
+		if job.State != Done {
+			t.Errorf("job %d = %s, want done", i, job.State)
+		}
+	}
+	if jobs[2].State != Failed || errors.Is(jobs[2].Err, errStop) {
+		t.Errorf("job 2 = %s %v, want its own failure", jobs[2].State, jobs[2].Err)
+	}
+	for i, job := range jobs[3:] {
+		if job.State != Failed || !errors.Is(job.Err, errStop) || !strings.HasPrefix(job.Err.Error(), "skipped before download") {
+			t.Errorf("job %d = %s %v, want skipped with the cancellation cause", i+3, job.State, job.Err)
+		}
+		if !job.Started.IsZero() {
+			t.Errorf("job %d started after the batch was cancelled", i+3)
+		}
+	}
+	for _, entry := range log {
+		if entry == "download:3" || entry == "download:4" {
+			t.Errorf("%s ran after the batch was cancelled", entry)
+		}
+	}
+}
+
+func TestRunPanic(t *testing.T) {
+	e := New(Stage[int]{Name: "tag", Run: func(ctx context.Context, job *Job[int]) error {
+		if job.Value == 1 {
+			panic("bad tag")
+		}
+		return nil
+	}})
+	jobs := e.Run(context.Background(), []int{0, 1, 2})
+	if jobs[0].State != Done || jobs[2].State != Done {
+		t.Errorf("a panic in one job failed others: %s, %s", jobs[0].State, jobs[2].State)
+	}
+	if jobs[1].State != Failed || jobs[1].Err == nil || jobs[1].Err.Error() != "tag panicked: bad tag" {
+		t.Errorf("job 1 = %s %v", jobs[1].State, jobs[1].Err)
+	}
+}
+
+func TestRunEmpty(t *testing.T) {
+	e := New(Stage[int]{Name: "a", Run: func(ctx context.Context, job *Job[int]) error { return nil }})
+	if jobs := e.Run(context.Background(), nil); jobs == nil || len(jobs) != 0 {
+		t.Errorf("Run(nil) = %v, want an empty slice", jobs)
+	}
+}
+
+func TestRunStream(t *testing.T) {
+	var mu sync.Mutex
+	var log []string
+	e := New(record("a", 1, &log, &mu), record("b", 1, &log, &mu))
+	totals := make(map[int]int)
+	e.OnEvent = func(event Event[int]) {
+		if event.Type == JobQueued {
+			totals[event.Job.Value] = event.Total
+		}
+	}
+
+	values := make(chan int)
+	go func() {
+		for i := 0; i < 5; i++ {
+			values <- i
+			time.Sleep(time.Millisecond)
+		}
+		close(values)
+	}()
+	jobs := e.RunStream(context.Background(), values)
+
+	if len(jobs) != 5 {
+		t.Fatalf("RunStream returned %d jobs, want 5", len(jobs))
+	}
+	for i, job := range jobs {
+		if job.Value != i || job.State != Done {
+			t.Errorf("job %d = value %d %s", i, job.Value, job.State)
+		}
+		// A stream counts the jobs received so far
+		if totals[i] != i+1 {
+			t.Errorf("job %d queued with total %d, want %d", i, totals[i], i+1)
+		}
+	}
+}
+
+func TestRunStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e := New(Stage[int]{Name: "a", Run: func(ctx context.Context, job *Job[int]) error { return nil }})
+	values := make(chan int)
+	go func() {
+		values <- 0
+		cancel()
+	}()
+	// Never closing values must not hang once ctx is cancelled
+	jobs := e.RunStream(ctx, values)
+	if len(jobs) > 1 {
+		t.Errorf("RunStream took %d values after cancellation", len(jobs))
+	}
+}
@@ -0,0 +1,65 @@
+// Package exitcode defines the exit codes of ytaudio, which scripts rely on, and errors that carry them.
+package exitcode
+
+import (
+	"errors"
+	"log"
+	"os"
+)
+
+const (
+	// OK means everything that was asked for was downloaded
+	OK = 0
+	// Failure means the download, or every item of a batch, failed
+	Failure = 1
+	// Usage means the flags or arguments were invalid
+	Usage = 2
+	// Partial means some items of a batch were downloaded and others failed, or a limit stopped the batch early
+	Partial = 3
+	// Dependency means yt-dlp, ffmpeg or ffprobe is missing or too old
+	Dependency = 4
+	// Auth means the YouTube API key is missing, invalid or out of quota
+	Auth = 5
+	// Cancelled means the run was interrupted, the code a shell uses for SIGINT
+	Cancelled = 130
+)
+
+// Error is an error that ends the program with a specific exit code
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap attaches an exit code to err; a nil err stays nil
+func Wrap(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// Of returns the exit code carried by err, OK for nil and Failure for errors without a code
+func Of(err error) int {
+	if err == nil {
+		return OK
+	}
+	var coded *Error
+	if errors.As(err, &coded) {
+		return coded.Code
+	}
+	return Failure
+}
+
+// Fatalf logs a message like log.Fatalf and exits with the given code
+func Fatalf(code int, format string, args ...interface{}) {
+	log.Printf(format, args...)
+	os.Exit(code)
+}
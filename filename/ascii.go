@@ -0,0 +1,86 @@
+package filename
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// asciiGroups maps characters to their ASCII spelling, each key lists every character with the same replacement
+var asciiGroups = map[string]string{
+	// Latin-1 and Latin Extended-A
+	"ÀÁÂÃÄÅĀĂĄ": "A", "àáâãäåāăą": "a",
+	"ÆǼ": "AE", "æǽ": "ae",
+	"ÇĆĈĊČ": "C", "çćĉċč": "c",
+	"ĎĐÐ": "D", "ďđð": "d",
+	"ÈÉÊËĒĔĖĘĚ": "E", "èéêëēĕėęě": "e",
+	"ĜĞĠĢ": "G", "ĝğġģ": "g",
+	"ĤĦ": "H", "ĥħ": "h",
+	"ÌÍÎÏĨĪĬĮİ": "I", "ìíîïĩīĭįı": "i",
+	"Ĳ": "IJ", "ĳ": "ij",
+	"Ĵ": "J", "ĵ": "j",
+	"Ķ": "K", "ķĸ": "k",
+	"ĹĻĽĿŁ": "L", "ĺļľŀł": "l",
+	"ÑŃŅŇŊ": "N", "ñńņňŉŋ": "n",
+	"ÒÓÔÕÖØŌŎŐ": "O", "òóôõöøōŏő": "o",
+	"Œ": "OE", "œ": "oe",
+	"ŔŖŘ": "R", "ŕŗř": "r",
+	"ŚŜŞŠȘ": "S", "śŝşšș": "s",
+	"ẞ": "SS", "ß": "ss",
+	"ŢŤŦȚ": "T", "ţťŧț": "t",
+	"Þ": "Th", "þ": "th",
+	"ÙÚÛÜŨŪŬŮŰŲ": "U", "ùúûüũūŭůűų": "u",
+	"Ŵ": "W", "ŵ": "w",
+	"ÝŶŸ": "Y", "ýÿŷ": "y",
+	"ŹŻŽ": "Z", "źżž": "z",
+
+	// Cyrillic, following common music library romanization
+	"А": "A", "а": "a", "Б": "B", "б": "b", "В": "V", "в": "v", "Г": "G", "г": "g",
+	"Д": "D", "д": "d", "ЕЭ": "E", "еэ": "e", "Ё": "Yo", "ё": "yo", "Ж": "Zh", "ж": "zh",
+	"З": "Z", "з": "z", "ИІ": "I", "иі": "i", "Й": "Y", "й": "y", "К": "K", "к": "k",
+	"Л": "L", "л": "l", "М": "M", "м": "m", "Н": "N", "н": "n", "О": "O", "о": "o",
+	"П": "P", "п": "p", "Р": "R", "р": "r", "С": "S", "с": "s", "Т": "T", "т": "t",
+	"У": "U", "у": "u", "Ф": "F", "ф": "f", "Х": "Kh", "х": "kh", "Ц": "Ts", "ц": "ts",
+	"Ч": "Ch", "ч": "ch", "Ш": "Sh", "ш": "sh", "Щ": "Shch", "щ": "shch", "Ы": "Y", "ы": "y",
+	"Ю": "Yu", "ю": "yu", "Я": "Ya", "я": "ya", "Ї": "Yi", "ї": "yi", "Є": "Ye", "є": "ye",
+	"ЪЬъь": "",
+
+	// Greek
+	"ΑΆ": "A", "αά": "a", "Β": "V", "β": "v", "Γ": "G", "γ": "g", "Δ": "D", "δ": "d",
+	"ΕΈ": "E", "εέ": "e", "Ζ": "Z", "ζ": "z", "ΗΉ": "I", "ηή": "i", "Θ": "Th", "θ": "th",
+	"ΙΊΪ": "I", "ιίϊΐ": "i", "Κ": "K", "κ": "k", "Λ": "L", "λ": "l", "Μ": "M", "μ": "m",
+	"Ν": "N", "ν": "n", "Ξ": "X", "ξ": "x", "ΟΌ": "O", "οό": "o", "Π": "P", "π": "p",
+	"Ρ": "R", "ρ": "r", "Σ": "S", "σς": "s", "Τ": "T", "τ": "t", "ΥΎΫ": "Y", "υύϋΰ": "y",
+	"Φ": "F", "φ": "f", "Χ": "Ch", "χ": "ch", "Ψ": "Ps", "ψ": "ps", "ΩΏ": "O", "ωώ": "o",
+
+	// Punctuation and symbols
+	"‘’‚‛′´`": "'", "“”„‟″«»": "\"", "‐‑‒–—―−": "-", "…": "...",
+	"×": "x", "÷": "/", "•·": "-", "©": "(c)", "®": "(R)", "™": "TM",
+	"¡": "!", "¿": "?", "°": "deg", "½": "1/2", "¼": "1/4", "¾": "3/4",
+	"¹": "1", "²": "2", "³": "3", "€": "EUR", "£": "GBP", "¥": "JPY", "¢": "c",
+	"              　": " ",
+}
+
+// asciiTable is asciiGroups keyed by character
+var asciiTable = func() map[rune]string {
+	table := make(map[rune]string)
+	for chars, replacement := range asciiGroups {
+		for _, r := range chars {
+			table[r] = replacement
+		}
+	}
+	return table
+}()
+
+// Transliterate spells name with ASCII characters only, dropping characters it has no spelling for
+func Transliterate(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		default:
+			b.WriteString(asciiTable[r])
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package filename
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// fallbackName is used when nothing printable is left of a title
+const fallbackName = "untitled"
+
+// invalidChars cannot appear in file names on Windows; macOS and Linux only reject / but share the same rules
+const invalidChars = `<>:"/\|?*`
+
+// reservedNames are device names Windows refuses as file names, with or without an extension
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM0": true, "COM1": true, "COM2": true, "COM3": true, "COM4": true,
+	"COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT0": true, "LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true,
+	"LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// Clean turns a title into a base name without extension that is valid on Windows, macOS and Linux
+func Clean(name string, opts config.FileNameOptions) string {
+	if opts.ASCII {
+		name = Transliterate(name)
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case strings.ContainsRune(invalidChars, r):
+			b.WriteByte('_')
+		case unicode.IsSpace(r):
+			b.WriteByte(' ')
+		case unicode.IsControl(r), r == utf8.RuneError, unicode.Is(unicode.Cf, r):
+			// Control and invisible formatting characters are dropped
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	// Leading dots hide files on macOS and Linux, trailing dots and spaces are stripped by Windows
+	name = strings.Join(strings.Fields(b.String()), " ")
+	name = strings.TrimLeft(name, ". ")
+	name = Truncate(name, opts.MaxBytes)
+	if name == "" {
+		return fallbackName
+	}
+	if isReserved(name) {
+		name = "_" + name
+	}
+	return name
+}
+
+// Truncate shortens name to at most max bytes without splitting a UTF-8 sequence,
+// then strips the trailing dots and spaces Windows would drop
+func Truncate(name string, max int) string {
+	if max > 0 && len(name) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut]
+	}
+	return strings.TrimRight(name, ". ")
+}
+
+// isReserved reports whether Windows treats name as a device, which also applies to names such as "nul.mp3"
+func isReserved(name string) bool {
+	base, _, _ := strings.Cut(name, ".")
+	return reservedNames[strings.ToUpper(strings.TrimSpace(base))]
+}
@@ -0,0 +1,202 @@
+package filename
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+var defaultOpts = config.FileNameOptions{MaxBytes: config.DefaultFileNameBytes, Collision: config.CollisionID}
+
+func TestClean(t *testing.T) {
+	ascii := defaultOpts
+	ascii.ASCII = true
+	short := defaultOpts
+	short.MaxBytes = 10
+
+	tests := []struct {
+		name string
+		in   string
+		opts config.FileNameOptions
+		want string
+	}{
+		{"plain", "Daft Punk - One More Time", defaultOpts, "Daft Punk - One More Time"},
+		{"invalid characters", `AC/DC: Back in Black? <Live> "1980" *|\`, defaultOpts, "AC_DC_ Back in Black_ _Live_ _1980_ ___"},
+		{"whitespace", "  Tabs\tand\nnewlines   here ", defaultOpts, "Tabs and newlines here"},
+		{"control characters", "Zero\u200bWidth\x00Null\x7f", defaultOpts, "ZeroWidthNull"},
+		{"leading dots", "...hidden", defaultOpts, "hidden"},
+		{"trailing dots", "The End...", defaultOpts, "The End"},
+		{"empty", "", defaultOpts, "untitled"},
+		{"nothing printable", "\u200b\u200b", defaultOpts, "untitled"},
+		{"reserved", "CON", defaultOpts, "_CON"},
+		{"reserved lower case", "nul.mp3", defaultOpts, "_nul.mp3"},
+		{"reserved prefix only", "CONTROL", defaultOpts, "CONTROL"},
+		{"unicode kept", "Sigur Rós – Hoppípolla", defaultOpts, "Sigur Rós – Hoppípolla"},
+		{"ascii", "Sigur Rós – Hoppípolla", ascii, "Sigur Ros - Hoppipolla"},
+		{"ascii cyrillic", "Кино - Группа крови", ascii, "Kino - Gruppa krovi"},
+		{"ascii unmapped", "残酷な天使のテーゼ", ascii, "untitled"},
+		{"truncated", "Hello World Again", short, "Hello Worl"},
+		{"truncated before dot", "Good Day. Sunshine", short, "Good Day"},
+		{"truncated within rune", "Ratatouilé!", short, "Ratatouil"},
+	}
+	for _, tt := range tests {
+		if got := Clean(tt.in, tt.opts); got != tt.want {
+			t.Errorf("%s: Clean(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		in   string
+		max  int
+		want string
+	}{
+		{"abcdef", 0, "abcdef"},
+		{"abcdef", 10, "abcdef"},
+		{"abcdef", 3, "abc"},
+		{"ab. cdef", 4, "ab"},
+		{"日本語", 4, "日"},
+		{"日本語", 6, "日本"},
+		{"trailing. ", 20, "trailing"},
+	}
+	for _, tt := range tests {
+		if got := Truncate(tt.in, tt.max); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.in, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	counter := defaultOpts
+	counter.Collision = config.CollisionCounter
+	short := defaultOpts
+	short.MaxBytes = 32
+
+	type reservation struct {
+		title, videoID, want string
+	}
+	tests := []struct {
+		name     string
+		opts     config.FileNameOptions
+		existing []string
+		reserve  []reservation
+	}{
+		{
+			name: "id suffix",
+			opts: defaultOpts,
+			reserve: []reservation{
+				{"Song", "aaa", "Song.mp3"},
+				{"Song", "bbb", "Song [bbb].mp3"},
+				{"song", "ccc", "song [ccc].mp3"}, // names differing in case collide too
+				{"Song", "bbb", "Song (2).mp3"},   // the same video twice in one run
+				{"Song", "", "Song (3).mp3"},
+			},
+		},
+		{
+			name: "counter",
+			opts: counter,
+			reserve: []reservation{
+				{"Song", "aaa", "Song.mp3"},
+				{"Song", "bbb", "Song (2).mp3"},
+				{"Song", "ccc", "Song (3).mp3"},
+			},
+		},
+		{
+			name:     "existing files",
+			opts:     defaultOpts,
+			existing: []string{"Song.mp3", "Song [aaa].mp3"},
+			reserve: []reservation{
+				{"Song", "aaa", "Song [aaa].mp3"}, // an earlier download of the same video is reused
+				{"Song", "bbb", "Song [bbb].mp3"},
+			},
+		},
+		{
+			name:     "existing files with counter",
+			opts:     counter,
+			existing: []string{"Song.mp3", "Song (2).mp3"},
+			reserve: []reservation{
+				{"Song", "aaa", "Song (3).mp3"},
+			},
+		},
+		{
+			name: "untitled uses the video id",
+			opts: defaultOpts,
+			reserve: []reservation{
+				{"\u200b", "aaa", "aaa.mp3"},
+				{"", "", "untitled.mp3"},
+			},
+		},
+		{
+			name: "suffix fits the length limit",
+			opts: short,
+			reserve: []reservation{
+				{strings.Repeat("x", 40), "aaa", strings.Repeat("x", 28) + ".mp3"},
+				{strings.Repeat("x", 40), "bbb", strings.Repeat("x", 22) + " [bbb].mp3"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for _, name := range tt.existing {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		r := NewRegistry(tt.opts)
+		for _, res := range tt.reserve {
+			if got := r.Reserve(dir, res.title, ".mp3", res.videoID); got != filepath.Join(dir, res.want) {
+				t.Errorf("%s: Reserve(%q, %q) = %q, want %q", tt.name, res.title, res.videoID, filepath.Base(got), res.want)
+			}
+		}
+	}
+}
+
+func TestReleaseAndPlace(t *testing.T) {
+	dir := t.TempDir()
+	r := NewRegistry(defaultOpts)
+
+	path := r.Reserve(dir, "Song", ".mp3", "aaa")
+	r.Release(path)
+	if again := r.Reserve(dir, "Song", ".mp3", "bbb"); again != path {
+		t.Errorf("Reserve after Release = %q, want %q", again, path)
+	}
+
+	src := filepath.Join(dir, "aaa.mp3")
+	if err := os.WriteFile(src, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dst, err := r.Place(src, filepath.Join(dir, "album"), "Song", "aaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst != filepath.Join(dir, "album", "Song.mp3") {
+		t.Errorf("Place = %q", dst)
+	}
+	if data, err := os.ReadFile(dst); err != nil || string(data) != "audio" {
+		t.Errorf("placed file = %q, %v", data, err)
+	}
+
+	// A file already at the name it would get stays where it is
+	if again, err := NewRegistry(defaultOpts).Place(dst, filepath.Join(dir, "album"), "Song", "aaa"); err != nil || again != dst {
+		t.Errorf("Place in place = %q, %v", again, err)
+	}
+}
+
+func TestReserveDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "Album [aaa]"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "Album"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRegistry(defaultOpts)
+	// Folders are never reused, not even one carrying the video ID
+	if got := r.ReserveDir(dir, "Album", "aaa"); got != filepath.Join(dir, "Album (2)") {
+		t.Errorf("ReserveDir = %q", got)
+	}
+}
@@ -0,0 +1,108 @@
+package filename
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// Registry hands out file names to concurrent workers so two downloads never end up at the same path
+type Registry struct {
+	opts config.FileNameOptions
+
+	mu       sync.Mutex
+	reserved map[string]bool // lower-cased, case-insensitive file systems treat Song.mp3 and song.mp3 alike
+}
+
+// NewRegistry creates a registry that names files according to opts
+func NewRegistry(opts config.FileNameOptions) *Registry {
+	return &Registry{opts: opts, reserved: make(map[string]bool)}
+}
+
+// Reserve picks a free path in dir for a file titled title with extension ext, owned by videoID.
+// The plain title is tried first, then a suffix with the video ID or a counter depending on the collision policy.
+// A file left by an earlier run of the same video under its ID suffix is reused instead of duplicated.
+func (r *Registry) Reserve(dir, title, ext, videoID string) string {
+	return r.reserve(dir, title, ext, videoID, "", true)
+}
+
+// ReserveDir picks a free path in dir for a folder named after title. Existing folders are never reused,
+// since a folder cannot be replaced with a single rename.
+func (r *Registry) ReserveDir(dir, title, videoID string) string {
+	return r.reserve(dir, title, "", videoID, "", false)
+}
+
+// reserve is Reserve treating the file at src as free, since it is the one being renamed
+func (r *Registry) reserve(dir, title, ext, videoID, src string, reuse bool) string {
+	base := Clean(title, r.opts)
+	if base == fallbackName && videoID != "" {
+		// Titles without a single usable character, e.g. Japanese ones with --ascii-filenames
+		base = videoID
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	suffixes := []string{""}
+	idSuffix := ""
+	if r.opts.Collision == config.CollisionID && videoID != "" {
+		idSuffix = " [" + videoID + "]"
+		suffixes = append(suffixes, idSuffix)
+	}
+	for n := 2; ; n++ {
+		for _, suffix := range suffixes {
+			path := filepath.Join(dir, Truncate(base, r.opts.MaxBytes-len(suffix)-len(ext))+suffix+ext)
+			if r.claim(path, path == src || (reuse && suffix != "" && suffix == idSuffix)) {
+				if suffix != "" {
+					log.Printf("File name %s%s is taken, using %s", base, ext, filepath.Base(path))
+				}
+				return path
+			}
+		}
+		suffixes = []string{fmt.Sprintf(" (%d)", n)}
+	}
+}
+
+// claim reserves path when no other worker holds it and nothing exists there yet; reuse allows
+// taking over an existing file, such as one from an earlier run whose name already carries the video ID
+func (r *Registry) claim(path string, reuse bool) bool {
+	key := strings.ToLower(path)
+	if _, ok := r.reserved[key]; ok {
+		return false
+	}
+	if _, err := os.Lstat(path); err == nil && !reuse {
+		return false
+	}
+	r.reserved[key] = true
+	return true
+}
+
+// Place moves the file at src to a reserved path in dir named after title and returns the new path
+func (r *Registry) Place(src, dir, title, videoID string) (string, error) {
+	ext := filepath.Ext(src)
+	dst := r.reserve(dir, title, ext, videoID, src, true)
+	if dst == src {
+		return dst, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("error creating output directory: %w", err)
+	}
+	if err := os.Rename(src, dst); err != nil {
+		r.Release(dst)
+		return "", fmt.Errorf("error moving %s to %s: %w", src, dst, err)
+	}
+	log.Printf("Saved %s as %s", filepath.Base(src), dst)
+	return dst, nil
+}
+
+// Release gives up a reserved path, e.g. when the download that held it failed
+func (r *Registry) Release(path string) {
+	r.mu.Lock()
+	delete(r.reserved, strings.ToLower(path))
+	r.mu.Unlock()
+}
@@ -0,0 +1,162 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// Env holds the values exposed to hooks as YTAUDIO_* environment variables
+type Env struct {
+	File    string
+	VideoID string
+	Title   string
+	Query   string
+	BatchID string
+	Count   int
+}
+
+// Runner runs the configured hook commands and applies the failure policy
+type Runner struct {
+	opts config.HookOptions
+}
+
+// NewRunner creates a hook runner for the given options
+func NewRunner(opts config.HookOptions) *Runner {
+	return &Runner{opts: opts}
+}
+
+// HasItemHooks reports whether any post-download hooks are configured
+func (r *Runner) HasItemHooks() bool {
+	return len(r.opts.PostDownload) > 0
+}
+
+// HasBatchHooks reports whether any post-batch hooks are configured
+func (r *Runner) HasBatchHooks() bool {
+	return len(r.opts.PostBatch) > 0
+}
+
+// RunItem runs the post-download hooks for one file and returns the replacement path
+// printed by the last hook that printed one, or the original path
+func (r *Runner) RunItem(ctx context.Context, env Env, payload []byte) (string, error) {
+	path := env.File
+	for _, command := range r.opts.PostDownload {
+		env.File = path
+		output, err := r.run(ctx, command, env, payload)
+		if err != nil {
+			if policyErr := r.handleFailure(err); policyErr != nil {
+				return path, policyErr
+			}
+			continue
+		}
+		if newPath := replacementPath(output, path); newPath != "" {
+			log.Printf("Hook %q replaced %s with %s", command, path, newPath)
+			path = newPath
+		}
+	}
+	return path, nil
+}
+
+// RunBatch runs the post-batch hooks once a batch has finished
+func (r *Runner) RunBatch(ctx context.Context, env Env, payload []byte) error {
+	for _, command := range r.opts.PostBatch {
+		if _, err := r.run(ctx, command, env, payload); err != nil {
+			if policyErr := r.handleFailure(err); policyErr != nil {
+				return policyErr
+			}
+		}
+	}
+	return nil
+}
+
+// run executes a single hook command through the shell with the payload on stdin
+func (r *Runner) run(ctx context.Context, command string, env Env, payload []byte) (string, error) {
+	timeout := time.Duration(r.opts.Timeout)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	log.Printf("Running hook: %s", command)
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(os.Environ(), env.variables()...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.WaitDelay = 5 * time.Second
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	for _, line := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		if line != "" {
+			log.Printf("hook: %s", line)
+		}
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("hook %q timed out after %v", command, timeout)
+		}
+		return "", fmt.Errorf("hook %q failed: %w", command, err)
+	}
+	return stdout.String(), nil
+}
+
+// handleFailure applies the failure policy and returns an error only when the item should fail
+func (r *Runner) handleFailure(err error) error {
+	switch r.opts.OnFailure {
+	case config.HookFailureIgnore:
+		return nil
+	case config.HookFailureFail:
+		return err
+	default:
+		log.Printf("Warning: %v", err)
+		return nil
+	}
+}
+
+// variables returns the environment variables describing the item or batch
+func (e Env) variables() []string {
+	vars := []string{
+		"YTAUDIO_FILE=" + e.File,
+		"YTAUDIO_VIDEO_ID=" + e.VideoID,
+		"YTAUDIO_TITLE=" + e.Title,
+		"YTAUDIO_QUERY=" + e.Query,
+		"YTAUDIO_BATCH_ID=" + e.BatchID,
+	}
+	if e.Count > 0 {
+		vars = append(vars, fmt.Sprintf("YTAUDIO_COUNT=%d", e.Count))
+	}
+	return vars
+}
+
+// replacementPath returns the last line a hook printed if it names a different, existing file
+func replacementPath(output, current string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	candidate := strings.TrimSpace(lines[len(lines)-1])
+	if candidate == "" || candidate == current {
+		return ""
+	}
+	if stat, err := os.Stat(candidate); err != nil || stat.IsDir() {
+		return ""
+	}
+	return candidate
+}
+
+// shellCommand runs a command line through the platform shell
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
 
 	"github.com/ktappdev/ytaudio/config"
 	"github.com/ktappdev/ytaudio/downloader"
+	"github.com/ktappdev/ytaudio/exitcode"
 	"github.com/ktappdev/ytaudio/playlist"
 	"github.com/ktappdev/ytaudio/youtube"
 )
@@ -13,17 +23,86 @@ func main() {
 	// Set up logging to include timestamps
 	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
 
-	cfg := config.ParseFlags()
+	// Cancel in-flight downloads on Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Subcommands work on files already on disk and need no API key
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		if err := runVerify(ctx, config.ParseVerifyFlags(os.Args[2:])); err != nil {
+			fail(ctx, err)
+		}
+		return
+	}
+
+	var cfg *config.Config
+	switch {
+	case len(os.Args) > 1 && os.Args[1] == "resume":
+		var err error
+		if cfg, err = resumeConfig(os.Args[2:]); err != nil {
+			fail(ctx, exitcode.Wrap(exitcode.Usage, err))
+		}
+	case len(os.Args) > 1 && os.Args[1] == "batch":
+		cfg = batchConfig(os.Args[2:])
+	case len(os.Args) > 1 && (os.Args[1] == "resolve" || os.Args[1] == "download"):
+		var err error
+		if cfg, err = matchConfig(os.Args[1], os.Args[2:]); err != nil {
+			fail(ctx, exitcode.Wrap(exitcode.Usage, err))
+		}
+	default:
+		cfg = config.ParseFlags()
+	}
 
-	if err := run(cfg); err != nil {
-		log.Fatalf("Error: %v", err)
+	if err := run(ctx, cfg); err != nil {
+		fail(ctx, err)
 	}
 
 	log.Println("Program completed successfully")
 }
 
+// fail logs the error that ended the run and exits with the matching exit code
+func fail(ctx context.Context, err error) {
+	code := exitCode(ctx, err)
+	log.Printf("Error: %v (exit code %d)", err, code)
+	os.Exit(code)
+}
+
+// exitCode maps the error of a run to one of the documented exit codes
+func exitCode(ctx context.Context, err error) int {
+	var apiErr *youtube.APIError
+	var googleErr *googleapi.Error
+	var batchErr *downloader.BatchError
+	switch {
+	case err == nil:
+		return exitcode.OK
+	case ctx.Err() != nil || errors.Is(err, context.Canceled):
+		return exitcode.Cancelled
+	case errors.As(err, &apiErr) && apiErr.AuthFailed():
+		return exitcode.Auth
+	case errors.As(err, &googleErr) && (googleErr.Code == 401 || googleErr.Code == 403 ||
+		googleErr.Code == 400 && strings.Contains(googleErr.Message, "API key")):
+		// Playlists are read through the client library, which reports a bad key as a bad request
+		return exitcode.Auth
+	case errors.As(err, &batchErr) && batchErr.Failed == 0:
+		// A limit stopped the batch before all of its items, which a rerun or "ytaudio resume" picks up
+		return exitcode.Partial
+	case errors.As(err, &batchErr):
+		// Skipped items were not meant to be downloaded, so only the others decide between partial and total failure
+		if batchErr.Failed < batchErr.Total-batchErr.Skipped {
+			return exitcode.Partial
+		}
+		for _, itemErr := range batchErr.Errs {
+			if !errors.As(itemErr, &apiErr) || !apiErr.AuthFailed() {
+				return exitcode.Failure
+			}
+		}
+		return exitcode.Auth
+	}
+	return exitcode.Of(err)
+}
+
 // run executes the main program logic based on the provided configuration
-func run(cfg *config.Config) error {
+func run(ctx context.Context, cfg *config.Config) error {
 	// Check if help flag is set or no command is provided
 	if cfg.ShowHelp {
 		config.ShowHelp()
@@ -31,25 +110,38 @@ func run(cfg *config.Config) error {
 	}
 
 	// Check if no command is provided
-	if cfg.Query == "" && cfg.FilePath == "" && cfg.PlaylistID == "" && !cfg.SongListMode {
+	if cfg.Query == "" && cfg.FilePath == "" && cfg.PlaylistID == "" && !cfg.SongListMode && cfg.RetryFailed == "" {
 		config.ShowHelp()
 		return nil
 	}
 
+	// Clear what crashed runs left behind once, before any worker stages a download of its own
+	if !cfg.DryRun.Enabled && !cfg.ListMode {
+		downloader.CleanStaging()
+	}
+
+	var results []*downloader.DownloadResult
+	var err error
+
 	switch {
+	case cfg.RetryFailed != "":
+		log.Printf("Retrying failed items from: %s", cfg.RetryFailed)
+		results, err = downloader.RetryFailed(ctx, cfg)
 	case cfg.PlaylistID != "":
 		log.Printf("Downloading playlist: %s", cfg.PlaylistID)
-		return playlist.DownloadPlaylist(cfg)
+		results, err = playlist.DownloadPlaylist(ctx, cfg)
 	case cfg.SongListMode:
-		if cfg.SongCSVFile != "" {
+		if cfg.ImportFile != "" {
+			log.Printf("Importing songs from: %s", cfg.ImportFile)
+		} else if cfg.SongCSVFile != "" {
 			log.Printf("Downloading songs from CSV file: %s", cfg.SongCSVFile)
 		} else {
 			log.Printf("Downloading song list: %s", cfg.SongList)
 		}
-		return downloader.DownloadSongList(cfg)
+		results, err = downloader.DownloadSongList(ctx, cfg)
 	case cfg.FilePath != "":
 		log.Printf("Processing file: %s", cfg.FilePath)
-		return downloader.ProcessFile(cfg)
+		results, err = downloader.ProcessFile(ctx, cfg)
 	case cfg.Query == "":
 		log.Println("No query provided")
 		config.ShowHelp()
@@ -59,13 +151,133 @@ func run(cfg *config.Config) error {
 		return youtube.ListVideos(cfg)
 	case cfg.SongMode:
 		log.Printf("Searching and downloading song: %s", cfg.Query)
-		videoID, err := youtube.SearchAndDownloadSong(cfg)
-		if err != nil {
-			return err
+		videoID, searchErr := youtube.SearchAndDownloadSong(cfg)
+		if searchErr != nil {
+			return searchErr
+		}
+		var result *downloader.DownloadResult
+		result, err = downloadSingle(ctx, cfg, downloader.Item{Target: videoID, Query: cfg.Query})
+		if err == nil {
+			results = append(results, result)
 		}
-		return downloader.DownloadAudio(videoID)
 	default:
 		log.Printf("Downloading audio for query: %s", cfg.Query)
-		return downloader.DownloadAudio(cfg.Query)
+		var result *downloader.DownloadResult
+		result, err = downloadSingle(ctx, cfg, downloader.Item{Target: cfg.Query})
+		if err == nil {
+			results = append(results, result)
+		}
+	}
+
+	logResults(results)
+	return err
+}
+
+// runVerify checks existing downloads and fails when any of them is corrupted
+func runVerify(ctx context.Context, cmd *config.VerifyCommand) error {
+	corrupted, err := downloader.VerifyDir(ctx, cmd.Dir, cmd.Verify, cmd.PostProcess)
+	if err != nil {
+		return err
+	}
+	if len(corrupted) > 0 {
+		return fmt.Errorf("%d corrupted files in %s", len(corrupted), cmd.Dir)
 	}
-}
\ No newline at end of file
+	return nil
+}
+
+// resumeConfig rebuilds the configuration of a journaled batch from its recorded command line.
+// Flags given after the batch ID are applied on top, e.g. to change the number of workers.
+func resumeConfig(args []string) (*config.Config, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return nil, fmt.Errorf("usage: ytaudio resume BATCH_ID [flags]")
+	}
+	journal, err := downloader.LoadJournal(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(journal.Args) == 0 {
+		return nil, fmt.Errorf("batch %s has no recorded command line, run its input again to continue it", journal.BatchID)
+	}
+	if missing := journal.MissingSecrets(args[1:]); len(missing) > 0 {
+		return nil, fmt.Errorf("batch %s was started with %s, which the journal does not record; give them again: ytaudio resume %s %s ...",
+			journal.BatchID, strings.Join(missing, ", "), journal.BatchID, strings.Join(missing, " ... "))
+	}
+
+	log.Printf("Resuming batch %s started %s", journal.BatchID, journal.Started.Format(time.RFC1123))
+	cfg := config.ParseArgs(append(append([]string{}, journal.Args...), args[1:]...))
+	cfg.Resume = journal.BatchID
+	return cfg, nil
+}
+
+// batchConfig parses "ytaudio batch [FILE] [flags]", which downloads the queries or URLs in FILE, one per line,
+// and streams them from standard input when FILE is left out or "-"
+func batchConfig(args []string) *config.Config {
+	path := "-"
+	if len(args) > 0 && (args[0] == "-" || !strings.HasPrefix(args[0], "-")) {
+		path, args = args[0], args[1:]
+	}
+	return config.ParseArgs(append([]string{"--file", path}, args...))
+}
+
+// matchConfig parses the two steps of reviewing matches by hand. "ytaudio resolve SONGFILE [-o MATCHES.csv]"
+// searches the songs of any file --import reads and writes a match file instead of downloading them, and
+// "ytaudio download MATCHES.csv" downloads the video IDs of the reviewed file, skipping rows left without one.
+func matchConfig(command string, args []string) (*config.Config, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		if command == "resolve" {
+			return nil, fmt.Errorf("usage: ytaudio resolve SONGFILE [-o MATCHES.csv] [flags]")
+		}
+		return nil, fmt.Errorf("usage: ytaudio download MATCHES.csv [flags]")
+	}
+	path, args := args[0], args[1:]
+	if command == "download" {
+		return config.ParseArgs(append([]string{"--import", path, "--no-search"}, args...)), nil
+	}
+
+	flags := []string{"--import", path, "--dry-run", "--plan-format", "csv"}
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case (arg == "-o" || arg == "--output") && i+1 < len(args):
+			flags = append(flags, "--plan-file", args[i+1])
+			i++
+		case strings.HasPrefix(arg, "--output="):
+			flags = append(flags, "--plan-file", strings.TrimPrefix(arg, "--output="))
+		default:
+			flags = append(flags, arg)
+		}
+	}
+	return config.ParseArgs(flags), nil
+}
+
+// downloadSingle downloads one video ID or URL with the configured backend
+func downloadSingle(ctx context.Context, cfg *config.Config, item downloader.Item) (*downloader.DownloadResult, error) {
+	dl, err := downloader.New(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return downloader.DownloadAudio(ctx, dl, item, downloader.OptionsFromConfig(cfg))
+}
+
+// logResults prints the files produced by a run
+func logResults(results []*downloader.DownloadResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	var totalSize int64
+	var files int
+	for _, result := range results {
+		totalSize += result.FileSize
+		if len(result.Tracks) > 0 {
+			log.Printf("Split %s into %d tracks in %s", result.Title, len(result.Tracks), result.FilePath)
+			for _, track := range result.Tracks {
+				log.Printf("  Saved %s (%s, %d bytes)", track.FilePath, track.Duration, track.FileSize)
+			}
+			files += len(result.Tracks)
+			continue
+		}
+		log.Printf("Saved %s (%s, %s, %d bytes)", result.FilePath, result.Title, result.Duration, result.FileSize)
+		files++
+	}
+	log.Printf("Downloaded %d files, %d bytes in total", files, totalSize)
+}
@@ -4,67 +4,54 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"sync"
 
 	"google.golang.org/api/option"
 	"google.golang.org/api/youtube/v3"
 
 	"github.com/ktappdev/ytaudio/config"
 	"github.com/ktappdev/ytaudio/downloader"
+	"github.com/ktappdev/ytaudio/tagger"
 )
 
 type PlaylistDownloader struct {
-	APIKey           string
-	ConcurrentLimit  int
-	DownloadFunction func(string) error
+	APIKey     string
+	Batch      downloader.Batch
+	Downloader downloader.Downloader
+	Options    downloader.Options
 }
 
-func NewPlaylistDownloader(apiKey string, concurrentLimit int, downloadFunc func(string) error) *PlaylistDownloader {
+// NewPlaylistDownloader creates a downloader that runs every stage with concurrentLimit workers
+func NewPlaylistDownloader(apiKey string, concurrentLimit int, dl downloader.Downloader, opts downloader.Options) *PlaylistDownloader {
+	workers := downloader.Workers{Resolve: concurrentLimit, Download: concurrentLimit, PostProcess: concurrentLimit}
 	return &PlaylistDownloader{
-		APIKey:           apiKey,
-		ConcurrentLimit:  concurrentLimit,
-		DownloadFunction: downloadFunc,
+		APIKey:     apiKey,
+		Batch:      downloader.Batch{APIKey: apiKey, Workers: workers},
+		Downloader: dl,
+		Options:    opts,
 	}
 }
 
-func (pd *PlaylistDownloader) DownloadPlaylist(playlistID string) error {
-	ctx := context.Background()
+func (pd *PlaylistDownloader) DownloadPlaylist(ctx context.Context, playlistID string) ([]*downloader.DownloadResult, error) {
 	youtubeService, err := youtube.NewService(ctx, option.WithAPIKey(pd.APIKey))
 	if err != nil {
-		return fmt.Errorf("error creating YouTube client: %w", err)
+		return nil, fmt.Errorf("error creating YouTube client: %w", err)
 	}
 
 	videos, err := pd.getPlaylistVideos(youtubeService, playlistID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	log.Printf("Found %d videos in playlist", len(videos))
 
-	jobs := make(chan string, len(videos))
-	results := make(chan error, len(videos))
-
-	var wg sync.WaitGroup
-	for w := 1; w <= pd.ConcurrentLimit; w++ {
-		wg.Add(1)
-		go pd.worker(jobs, results, &wg)
-	}
-
-	for _, video := range videos {
-		jobs <- video
+	items := make([]downloader.Item, len(videos))
+	for i, video := range videos {
+		// Playlist position doubles as the track number
+		items[i] = downloader.Item{Target: video, Metadata: tagger.Metadata{Track: i + 1}}
 	}
-	close(jobs)
-
-	wg.Wait()
-	close(results)
-
-	for err := range results {
-		if err != nil {
-			log.Printf("Error downloading video: %v", err)
-		}
-	}
-
-	return nil
+	jobs, err := downloader.RunBatch(ctx, pd.Downloader, items, pd.Options, pd.Batch)
+	downloads, _ := downloader.Outcome(jobs)
+	return downloads, err
 }
 
 func (pd *PlaylistDownloader) getPlaylistVideos(service *youtube.Service, playlistID string) ([]string, error) {
@@ -95,16 +82,12 @@ func (pd *PlaylistDownloader) getPlaylistVideos(service *youtube.Service, playli
 	return videos, nil
 }
 
-func (pd *PlaylistDownloader) worker(jobs <-chan string, results chan<- error, wg *sync.WaitGroup) {
-	defer wg.Done()
-	for videoID := range jobs {
-		log.Printf("Downloading video: %s", videoID)
-		err := pd.DownloadFunction(videoID)
-		results <- err
+func DownloadPlaylist(ctx context.Context, cfg *config.Config) ([]*downloader.DownloadResult, error) {
+	dl, err := downloader.New(ctx, cfg)
+	if err != nil {
+		return nil, err
 	}
+	pd := NewPlaylistDownloader(cfg.APIKey, cfg.ConcurrentDownloads, dl, downloader.OptionsFromConfig(cfg))
+	pd.Batch = downloader.BatchFromConfig(cfg)
+	return pd.DownloadPlaylist(ctx, cfg.PlaylistID)
 }
-
-func DownloadPlaylist(cfg *config.Config) error {
-	downloader := NewPlaylistDownloader(cfg.APIKey, cfg.ConcurrentDownloads, downloader.DownloadAudio)
-	return downloader.DownloadPlaylist(cfg.PlaylistID)
-}
\ No newline at end of file
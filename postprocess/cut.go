@@ -0,0 +1,51 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// Cut writes the part of src between start and end seconds to dst, copying the audio stream
+// when the container allows it and re-encoding otherwise. An end of zero cuts to the end of the file.
+func Cut(ctx context.Context, src, dst string, start, end float64, opts config.PostProcessOptions) error {
+	rangeArgs := []string{"-ss", formatSeconds(start)}
+	if end > start {
+		rangeArgs = append(rangeArgs, "-t", formatSeconds(end-start))
+	}
+
+	err := cut(ctx, src, dst, rangeArgs, []string{"-c:a", "copy"}, opts)
+	if err == nil {
+		return nil
+	}
+
+	log.Printf("Stream copy of %s failed, re-encoding: %v", dst, err)
+	return cut(ctx, src, dst, rangeArgs, codecArgs(dst), opts)
+}
+
+func cut(ctx context.Context, src, dst string, rangeArgs, codec []string, opts config.PostProcessOptions) error {
+	// Seeking before the input is fast, and exact for stream copies of MP3, AAC and Opus
+	args := append([]string{"-hide_banner", "-nostdin", "-y"}, rangeArgs...)
+	args = append(args, "-i", src, "-map", "0:a", "-map_metadata", "-1")
+	args = append(args, codec...)
+	args = append(args, dst)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpegPath(opts), args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, lastLine(stderr.String()))
+	}
+	return nil
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
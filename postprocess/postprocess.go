@@ -0,0 +1,327 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ktappdev/ytaudio/config"
+	"github.com/ktappdev/ytaudio/exitcode"
+	"github.com/ktappdev/ytaudio/tagger"
+)
+
+// ReplayGain 2.0 and Opus R128 reference loudness levels
+const (
+	replayGainReference = -18.0
+	r128Reference       = -23.0
+)
+
+// Report holds the values measured while post-processing a file
+type Report struct {
+	TrimmedSeconds float64 `json:"trimmed_seconds,omitempty"`
+	InputLUFS      float64 `json:"input_lufs"`
+	InputTruePeak  float64 `json:"input_true_peak"`
+	InputLRA       float64 `json:"input_lra"`
+	OutputLUFS     float64 `json:"output_lufs,omitempty"`
+	OutputTruePeak float64 `json:"output_true_peak,omitempty"`
+	Normalized     bool    `json:"normalized"`
+	TrackGain      float64 `json:"track_gain_db,omitempty"`
+	TrackPeak      float64 `json:"track_peak,omitempty"`
+}
+
+// loudnormStats is the JSON block printed by ffmpeg's loudnorm filter
+type loudnormStats struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	OutputI      string `json:"output_i"`
+	OutputTP     string `json:"output_tp"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// CheckFFmpeg verifies that ffmpeg and ffprobe are available
+func CheckFFmpeg(ctx context.Context, opts config.PostProcessOptions) error {
+	ffmpeg := ffmpegPath(opts)
+	if err := exec.CommandContext(ctx, ffmpeg, "-version").Run(); err != nil {
+		return exitcode.Wrap(exitcode.Dependency, fmt.Errorf("ffmpeg not found at %q. Please install it with: brew install ffmpeg, or point --ffmpeg at the executable", ffmpeg))
+	}
+	ffprobe := ffprobePath(opts)
+	if err := exec.CommandContext(ctx, ffprobe, "-version").Run(); err != nil {
+		return exitcode.Wrap(exitcode.Dependency, fmt.Errorf("ffprobe not found at %q, it is installed together with ffmpeg", ffprobe))
+	}
+	return nil
+}
+
+// Process applies the selected silence trimming, loudness normalization and ReplayGain tagging to a file in place
+func Process(ctx context.Context, path string, opts config.PostProcessOptions) (*Report, error) {
+	if !opts.Enabled() {
+		return nil, nil
+	}
+	log.Printf("Post-processing %s: %s", path, opts)
+	report := &Report{}
+
+	if opts.TrimSilence {
+		trimmed, err := trimSilence(ctx, path, opts)
+		if err != nil {
+			return nil, err
+		}
+		report.TrimmedSeconds = trimmed
+		log.Printf("Trimmed %.2fs of silence from %s", trimmed, path)
+	}
+
+	stats, err := measureLoudness(ctx, path, opts)
+	if err != nil {
+		return nil, err
+	}
+	report.InputLUFS = parseFloat(stats.InputI)
+	report.InputTruePeak = parseFloat(stats.InputTP)
+	report.InputLRA = parseFloat(stats.InputLRA)
+	log.Printf("Measured %s: %.1f LUFS, %.1f dBTP, LRA %.1f LU", path, report.InputLUFS, report.InputTruePeak, report.InputLRA)
+
+	loudness, peak := report.InputLUFS, report.InputTruePeak
+	if opts.Normalize {
+		output, err := normalize(ctx, path, opts, stats)
+		if err != nil {
+			return nil, err
+		}
+		report.Normalized = true
+		report.OutputLUFS = parseFloat(output.OutputI)
+		report.OutputTruePeak = parseFloat(output.OutputTP)
+		loudness, peak = report.OutputLUFS, report.OutputTruePeak
+		log.Printf("Normalized %s to %.1f LUFS, %.1f dBTP", path, report.OutputLUFS, report.OutputTruePeak)
+	}
+
+	if opts.ReplayGain {
+		report.TrackGain = replayGainReference - loudness
+		report.TrackPeak = math.Pow(10, peak/20)
+		if err := writeGainTags(ctx, path, opts, loudness, report); err != nil {
+			return nil, err
+		}
+		log.Printf("Tagged %s with track gain %.2f dB, peak %.6f", path, report.TrackGain, report.TrackPeak)
+	}
+
+	return report, nil
+}
+
+// measureLoudness runs the first loudnorm pass and returns the measured EBU R128 values
+func measureLoudness(ctx context.Context, path string, opts config.PostProcessOptions) (*loudnormStats, error) {
+	filter := fmt.Sprintf("%s:print_format=json", loudnormFilter(opts))
+	cmd := exec.CommandContext(ctx, ffmpegPath(opts), "-hide_banner", "-nostdin", "-i", path, "-af", filter, "-f", "null", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error measuring loudness: %w: %s", err, lastLine(stderr.String()))
+	}
+	return parseLoudnormStats(stderr.String())
+}
+
+// normalize runs the second loudnorm pass using the measured values for a linear gain change
+func normalize(ctx context.Context, path string, opts config.PostProcessOptions, measured *loudnormStats) (*loudnormStats, error) {
+	sampleRate, err := probeSampleRate(ctx, path, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := fmt.Sprintf("%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true:print_format=json",
+		loudnormFilter(opts), measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset)
+
+	var stderr bytes.Buffer
+	// loudnorm resamples to 192 kHz internally, so the original rate is restored on output
+	if err := reencodeWithStderr(ctx, path, opts, filter, sampleRate, &stderr); err != nil {
+		return nil, fmt.Errorf("error normalizing loudness: %w", err)
+	}
+	return parseLoudnormStats(stderr.String())
+}
+
+// writeGainTags stores ReplayGain (and R128 for Opus) tags without touching the audio
+func writeGainTags(ctx context.Context, path string, opts config.PostProcessOptions, loudness float64, report *Report) error {
+	gain := fmt.Sprintf("%.2f dB", report.TrackGain)
+	peak := fmt.Sprintf("%.6f", report.TrackPeak)
+	if isMP4(path) {
+		// ffmpeg's MP4 muxer drops metadata keys it has no iTunes atom for, players read freeform items instead
+		tags := map[string]string{"REPLAYGAIN_TRACK_GAIN": gain, "REPLAYGAIN_TRACK_PEAK": peak}
+		if err := tagger.WriteMP4Freeform(path, tags); err != nil {
+			return fmt.Errorf("error writing ReplayGain tags: %w", err)
+		}
+		return nil
+	}
+
+	tags := []string{
+		"REPLAYGAIN_TRACK_GAIN=" + gain,
+		"REPLAYGAIN_TRACK_PEAK=" + peak,
+	}
+	if isOgg(path) {
+		// Opus players read R128_TRACK_GAIN, a Q7.8 gain relative to -23 LUFS
+		tags = append(tags, fmt.Sprintf("R128_TRACK_GAIN=%d", int(math.Round((r128Reference-loudness)*256))))
+	}
+
+	metadataFlag := "-metadata"
+	if isOgg(path) {
+		// Ogg keeps comments on the stream rather than the container
+		metadataFlag = "-metadata:s:a:0"
+	}
+
+	args := []string{"-map", "0", "-map_metadata", "0", "-c", "copy"}
+	for _, tag := range tags {
+		args = append(args, metadataFlag, tag)
+	}
+	if err := rewrite(ctx, path, opts, args, nil); err != nil {
+		return fmt.Errorf("error writing ReplayGain tags: %w", err)
+	}
+	return nil
+}
+
+// reencode filters the audio of a file and replaces it with the result
+func reencode(ctx context.Context, path string, opts config.PostProcessOptions, filter, sampleRate string) error {
+	return reencodeWithStderr(ctx, path, opts, filter, sampleRate, nil)
+}
+
+func reencodeWithStderr(ctx context.Context, path string, opts config.PostProcessOptions, filter, sampleRate string, stderr *bytes.Buffer) error {
+	args := []string{"-map", "0:a", "-map_metadata", "0", "-af", filter}
+	if sampleRate != "" {
+		args = append(args, "-ar", sampleRate)
+	}
+	args = append(args, codecArgs(path)...)
+	return rewrite(ctx, path, opts, args, stderr)
+}
+
+// rewrite runs ffmpeg on a file into a temporary sibling and renames it over the original
+func rewrite(ctx context.Context, path string, opts config.PostProcessOptions, args []string, stderr *bytes.Buffer) error {
+	ext := filepath.Ext(path)
+	tmpPath := strings.TrimSuffix(path, ext) + ".ytaudio-tmp" + ext
+
+	cmdArgs := append([]string{"-hide_banner", "-nostdin", "-y", "-i", path}, args...)
+	cmdArgs = append(cmdArgs, tmpPath)
+	cmd := exec.CommandContext(ctx, ffmpegPath(opts), cmdArgs...)
+	if stderr == nil {
+		stderr = &bytes.Buffer{}
+	}
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("ffmpeg failed: %w: %s", err, lastLine(stderr.String()))
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error replacing %s: %w", path, err)
+	}
+	return nil
+}
+
+// codecArgs picks an encoder that matches the container of the file
+func codecArgs(path string) []string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		return []string{"-c:a", "libmp3lame", "-q:a", "0", "-id3v2_version", "3"}
+	case ".m4a", ".aac", ".mp4":
+		return []string{"-c:a", "aac", "-b:a", "256k"}
+	case ".opus":
+		return []string{"-c:a", "libopus", "-b:a", "160k"}
+	case ".ogg":
+		return []string{"-c:a", "libvorbis", "-q:a", "6"}
+	case ".flac":
+		return []string{"-c:a", "flac"}
+	case ".wav":
+		return []string{"-c:a", "pcm_s16le"}
+	default:
+		return nil
+	}
+}
+
+// probeDuration returns the duration of a file in seconds
+func probeDuration(ctx context.Context, path string, opts config.PostProcessOptions) (float64, error) {
+	value, err := probe(ctx, path, opts, "format=duration")
+	if err != nil {
+		return 0, err
+	}
+	duration, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing duration %q of %s", value, path)
+	}
+	return duration, nil
+}
+
+// probeSampleRate returns the sample rate of the first audio stream
+func probeSampleRate(ctx context.Context, path string, opts config.PostProcessOptions) (string, error) {
+	return probe(ctx, path, opts, "stream=sample_rate")
+}
+
+func probe(ctx context.Context, path string, opts config.PostProcessOptions, entries string) (string, error) {
+	output, err := exec.CommandContext(ctx, ffprobePath(opts),
+		"-v", "error", "-select_streams", "a:0", "-show_entries", entries,
+		"-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return "", fmt.Errorf("error probing %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// parseLoudnormStats extracts the JSON block loudnorm prints at the end of ffmpeg's log
+func parseLoudnormStats(output string) (*loudnormStats, error) {
+	start := strings.LastIndex(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("loudnorm statistics not found in ffmpeg output")
+	}
+
+	var stats loudnormStats
+	if err := json.Unmarshal([]byte(output[start:end+1]), &stats); err != nil {
+		return nil, fmt.Errorf("error parsing loudnorm statistics: %w", err)
+	}
+	return &stats, nil
+}
+
+func loudnormFilter(opts config.PostProcessOptions) string {
+	return fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g", opts.TargetLUFS, opts.TruePeak, opts.LoudnessRange)
+}
+
+func ffmpegPath(opts config.PostProcessOptions) string {
+	if opts.FFmpegPath == "" {
+		return "ffmpeg"
+	}
+	return opts.FFmpegPath
+}
+
+// ffprobePath looks for ffprobe next to the configured ffmpeg
+func ffprobePath(opts config.PostProcessOptions) string {
+	ffmpeg := ffmpegPath(opts)
+	dir, name := filepath.Split(ffmpeg)
+	return dir + strings.Replace(name, "ffmpeg", "ffprobe", 1)
+}
+
+func isMP4(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".m4a", ".m4b", ".mp4":
+		return true
+	default:
+		return false
+	}
+}
+
+func isOgg(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".opus" || ext == ".ogg"
+}
+
+func parseFloat(s string) float64 {
+	value, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return value
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		return s[i+1:]
+	}
+	return s
+}
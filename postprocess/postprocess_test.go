@@ -0,0 +1,89 @@
+package postprocess
+
+import (
+	"math"
+	"testing"
+)
+
+// loudnormOutput is the tail of ffmpeg's log for a loudnorm pass with print_format=json
+const loudnormOutput = `Input #0, mp3, from 'song.mp3':
+  Metadata:
+    title           : One More Time {Radio Edit}
+  Duration: 00:05:20.35, start: 0.025057, bitrate: 256 kb/s
+  Stream #0:0: Audio: mp3, 44100 Hz, stereo, fltp, 256 kb/s
+Stream mapping:
+  Stream #0:0 -> #0:0 (mp3 (mp3float) -> pcm_s16le (native))
+Output #0, null, to 'pipe:':
+size=N/A time=00:05:20.32 bitrate=N/A speed=62.1x
+video:0kB audio:55181kB subtitle:0kB other streams:0kB global headers:0kB muxing overhead: unknown
+[Parsed_loudnorm_0 @ 0x600001b0c0b0] 
+{
+	"input_i" : "-8.47",
+	"input_tp" : "0.54",
+	"input_lra" : "4.10",
+	"input_thresh" : "-18.55",
+	"output_i" : "-14.06",
+	"output_tp" : "-1.00",
+	"output_lra" : "3.60",
+	"output_thresh" : "-24.09",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.06"
+}
+`
+
+func TestParseLoudnormStats(t *testing.T) {
+	tests := []struct {
+		name, output string
+		want         *loudnormStats
+	}{
+		{
+			name:   "first pass",
+			output: loudnormOutput,
+			want:   &loudnormStats{InputI: "-8.47", InputTP: "0.54", InputLRA: "4.10", InputThresh: "-18.55", OutputI: "-14.06", OutputTP: "-1.00", TargetOffset: "0.06"},
+		},
+		{
+			name: "silent input",
+			output: `[Parsed_loudnorm_0 @ 0x55d0c1e2a380] 
+{
+	"input_i" : "-inf",
+	"input_tp" : "-inf",
+	"input_lra" : "0.00",
+	"input_thresh" : "-70.00",
+	"output_i" : "-inf",
+	"output_tp" : "-inf",
+	"output_lra" : "0.00",
+	"output_thresh" : "-70.00",
+	"normalization_type" : "dynamic",
+	"target_offset" : "inf"
+}
+`,
+			want: &loudnormStats{InputI: "-inf", InputTP: "-inf", InputLRA: "0.00", InputThresh: "-70.00", OutputI: "-inf", OutputTP: "-inf", TargetOffset: "inf"},
+		},
+		{name: "missing block", output: "size=N/A time=00:05:20.32 bitrate=N/A speed=62.1x\n"},
+		{name: "metadata braces only", output: "    title           : One More Time {Radio Edit}\n"},
+		{name: "truncated block", output: "[Parsed_loudnorm_0 @ 0x1] \n{\n\t\"input_i\" : \"-8.47\",\n"},
+	}
+	for _, tt := range tests {
+		got, err := parseLoudnormStats(tt.output)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("%s: parseLoudnormStats = %+v, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: parseLoudnormStats error = %v", tt.name, err)
+			continue
+		}
+		if *got != *tt.want {
+			t.Errorf("%s: parseLoudnormStats = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if stats, err := parseLoudnormStats(loudnormOutput); err != nil || parseFloat(stats.InputI) != -8.47 {
+		t.Errorf("input loudness of %+v (%v), want -8.47", stats, err)
+	}
+	if value := parseFloat("-inf"); !math.IsInf(value, -1) {
+		t.Errorf("parseFloat(-inf) = %g", value)
+	}
+}
@@ -0,0 +1,105 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// silencePattern matches the silence_start and silence_end lines silencedetect logs
+var silencePattern = regexp.MustCompile(`silence_(start|end): (-?[0-9.]+)`)
+
+// silenceEdge is how close to the start or end of the file a silence must reach to be trimmed
+const silenceEdge = 0.05
+
+// silence is a stretch of audio below the threshold; End is negative when it lasts to the end of the file
+type silence struct {
+	Start, End float64
+}
+
+// trimSilence removes leading and trailing silence and returns the number of seconds removed
+func trimSilence(ctx context.Context, path string, opts config.PostProcessOptions) (float64, error) {
+	duration, err := probeDuration(ctx, path, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	silences, err := detectSilence(ctx, path, opts)
+	if err != nil {
+		return 0, err
+	}
+	start, end := silenceBounds(silences, duration)
+	if start <= 0 && end >= duration {
+		return 0, nil
+	}
+	if end <= start {
+		return 0, fmt.Errorf("%s is silent throughout, nothing left after trimming", path)
+	}
+
+	// Cutting after the input decodes up to the exact sample, and the audio is encoded only once
+	args := []string{"-map", "0:a", "-map_metadata", "0", "-ss", formatSeconds(start), "-to", formatSeconds(end)}
+	args = append(args, codecArgs(path)...)
+	if err := rewrite(ctx, path, opts, args, nil); err != nil {
+		return 0, fmt.Errorf("error trimming silence: %w", err)
+	}
+	return math.Max(start+duration-end, 0), nil
+}
+
+// detectSilence lists the silences of a file using ffmpeg's silencedetect filter
+func detectSilence(ctx context.Context, path string, opts config.PostProcessOptions) ([]silence, error) {
+	filter := fmt.Sprintf("silencedetect=noise=%gdB:duration=%g", opts.SilenceThreshold, opts.SilenceDuration)
+	cmd := exec.CommandContext(ctx, ffmpegPath(opts), "-hide_banner", "-nostdin", "-i", path, "-map", "0:a", "-af", filter, "-f", "null", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error detecting silence: %w: %s", err, lastLine(stderr.String()))
+	}
+	return parseSilences(stderr.String()), nil
+}
+
+// parseSilences collects the silences from silencedetect's log lines; older ffmpeg versions
+// print no silence_end for a silence that lasts to the end of the file
+func parseSilences(output string) []silence {
+	var silences []silence
+	open := false
+	for _, match := range silencePattern.FindAllStringSubmatch(output, -1) {
+		value, err := strconv.ParseFloat(match[2], 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case match[1] == "start":
+			silences = append(silences, silence{Start: math.Max(value, 0), End: -1})
+			open = true
+		case open:
+			silences[len(silences)-1].End = value
+			open = false
+		}
+	}
+	return silences
+}
+
+// silenceBounds returns the part of a file of the given duration that is left after trimming
+// the silence touching its start and end; silences in the middle are kept
+func silenceBounds(silences []silence, duration float64) (start, end float64) {
+	start, end = 0, duration
+	if len(silences) == 0 {
+		return start, end
+	}
+	if first := silences[0]; first.Start <= silenceEdge {
+		if first.End < 0 {
+			return duration, duration
+		}
+		start = first.End
+	}
+	if last := silences[len(silences)-1]; last.End < 0 || last.End >= duration-silenceEdge {
+		end = math.Min(last.Start, duration)
+	}
+	return start, end
+}
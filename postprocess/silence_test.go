@@ -0,0 +1,64 @@
+package postprocess
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSilences(t *testing.T) {
+	tests := []struct {
+		name, output string
+		want         []silence
+	}{
+		{
+			name: "leading and trailing",
+			output: `Input #0, mp3, from 'song.mp3':
+  Duration: 00:03:05.04, start: 0.025057, bitrate: 245 kb/s
+[silencedetect @ 0x5581c7a0c440] silence_start: 0
+[silencedetect @ 0x5581c7a0c440] silence_end: 1.50095 | silence_duration: 1.50095
+[silencedetect @ 0x5581c7a0c440] silence_start: 92.2
+[silencedetect @ 0x5581c7a0c440] silence_end: 93.01 | silence_duration: 0.81
+size=N/A time=00:03:05.01 bitrate=N/A speed= 412x
+[silencedetect @ 0x5581c7a0c440] silence_start: 181.234
+[silencedetect @ 0x5581c7a0c440] silence_end: 185.04 | silence_duration: 3.806
+`,
+			want: []silence{{0, 1.50095}, {92.2, 93.01}, {181.234, 185.04}},
+		},
+		{
+			name: "unterminated",
+			output: `[silencedetect @ 0x1] silence_start: -0.00625
+[silencedetect @ 0x1] silence_end: 2 | silence_duration: 2
+[silencedetect @ 0x1] silence_start: 180.5
+`,
+			want: []silence{{0, 2}, {180.5, -1}},
+		},
+		{name: "no silence", output: "size=N/A time=00:03:05.01 bitrate=N/A speed= 412x\n"},
+	}
+	for _, tt := range tests {
+		if got := parseSilences(tt.output); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseSilences = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSilenceBounds(t *testing.T) {
+	tests := []struct {
+		name       string
+		silences   []silence
+		start, end float64
+	}{
+		{"none", nil, 0, 185},
+		{"leading", []silence{{0, 1.5}}, 1.5, 185},
+		{"trailing", []silence{{181, 185}}, 0, 181},
+		{"trailing to the end", []silence{{181, -1}}, 0, 181},
+		{"both, middle kept", []silence{{0, 1.5}, {92, 93}, {181, 184.98}}, 1.5, 181},
+		{"middle only", []silence{{92, 93}}, 0, 185},
+		{"silent throughout", []silence{{0, -1}}, 185, 185},
+	}
+	for _, tt := range tests {
+		start, end := silenceBounds(tt.silences, 185)
+		if start != tt.start || end != tt.end {
+			t.Errorf("%s: silenceBounds = %g, %g, want %g, %g", tt.name, start, end, tt.start, tt.end)
+		}
+	}
+}
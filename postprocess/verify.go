@@ -0,0 +1,173 @@
+package postprocess
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// Expectation describes what a download should contain; zero values skip the check
+type Expectation struct {
+	Duration float64 // seconds
+	Codec    string  // ffprobe codec name
+}
+
+// Verification holds what ffprobe and a full decode found in a file
+type Verification struct {
+	Codec           string   `json:"codec"`
+	Duration        float64  `json:"duration"`
+	DecodedDuration float64  `json:"decoded_duration"`
+	Bitrate         float64  `json:"bitrate_kbps"`
+	Problems        []string `json:"problems,omitempty"`
+}
+
+// OK reports whether the file passed every check
+func (v *Verification) OK() bool {
+	return len(v.Problems) == 0
+}
+
+func (v *Verification) problem(format string, args ...interface{}) {
+	v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+}
+
+// probeOutput is the part of ffprobe's JSON output used for verification
+type probeOutput struct {
+	Streams []struct {
+		CodecName string `json:"codec_name"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+		BitRate  string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// decodeTimePattern matches the position in ffmpeg's progress output
+var decodeTimePattern = regexp.MustCompile(`time=(\d+):(\d+):(\d+(?:\.\d+)?)`)
+
+// Verify checks that the file at path exists, decodes to the end and matches the expectation.
+// Problems with the file are reported in the result, the error is only set when the check itself could not run.
+func Verify(ctx context.Context, path string, expect Expectation, verify config.VerifyOptions, opts config.PostProcessOptions) (*Verification, error) {
+	v := &Verification{}
+	stat, err := os.Stat(path)
+	if err != nil {
+		v.problem("file is missing")
+		return v, nil
+	}
+	if stat.Size() == 0 {
+		v.problem("file is empty")
+		return v, nil
+	}
+
+	output, err := exec.CommandContext(ctx, ffprobePath(opts),
+		"-v", "error", "-select_streams", "a:0", "-show_entries", "stream=codec_name:format=duration,bit_rate",
+		"-of", "json", path).Output()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return nil, fmt.Errorf("error running ffprobe: %w", err)
+		}
+		v.problem("ffprobe cannot read the file")
+		return v, nil
+	}
+	var probed probeOutput
+	if err := json.Unmarshal(output, &probed); err != nil {
+		return nil, fmt.Errorf("error parsing ffprobe output for %s: %w", path, err)
+	}
+	if len(probed.Streams) == 0 {
+		v.problem("no audio stream")
+		return v, nil
+	}
+	v.Codec = probed.Streams[0].CodecName
+	v.Duration = parseFloat(probed.Format.Duration)
+	v.Bitrate = parseFloat(probed.Format.BitRate) / 1000
+	if v.Bitrate == 0 && v.Duration > 0 {
+		v.Bitrate = float64(stat.Size()*8) / v.Duration / 1000
+	}
+
+	decoded, decodeErr := decode(ctx, path, opts)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	v.DecodedDuration = decoded
+	if decodeErr != "" {
+		v.problem("decoding failed: %s", decodeErr)
+	}
+
+	tolerance := time.Duration(verify.Tolerance).Seconds()
+	// A truncated file still carries the full length in its header, but decoding stops early
+	if v.Duration > 0 && math.Abs(v.DecodedDuration-v.Duration) > tolerance {
+		v.problem("decoded %s of %s", config.FormatClock(v.DecodedDuration), config.FormatClock(v.Duration))
+	}
+	if expect.Duration > 0 && math.Abs(v.DecodedDuration-expect.Duration) > tolerance {
+		v.problem("duration %s, expected %s", config.FormatClock(v.DecodedDuration), config.FormatClock(expect.Duration))
+	}
+	if expect.Codec != "" && !strings.HasPrefix(v.Codec, expect.Codec) {
+		v.problem("codec %s, expected %s", v.Codec, expect.Codec)
+	}
+	if verify.MinBitrate > 0 && v.Bitrate > 0 && v.Bitrate < float64(verify.MinBitrate) {
+		v.problem("bitrate %.0f kbps, expected at least %d kbps", v.Bitrate, verify.MinBitrate)
+	}
+	return v, nil
+}
+
+// decode runs the whole file through the decoder and returns how far it got plus the first decoder error
+func decode(ctx context.Context, path string, opts config.PostProcessOptions) (float64, string) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpegPath(opts), "-nostdin", "-hide_banner", "-v", "error", "-stats",
+		"-i", path, "-map", "0:a:0", "-f", "null", "-")
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	var decoded float64
+	var firstError string
+	for _, line := range strings.FieldsFunc(stderr.String(), func(r rune) bool { return r == '\r' || r == '\n' }) {
+		if match := decodeTimePattern.FindStringSubmatch(line); match != nil {
+			decoded = parseFloat(match[1])*3600 + parseFloat(match[2])*60 + parseFloat(match[3])
+			continue
+		}
+		if line = strings.TrimSpace(line); line != "" && firstError == "" {
+			firstError = line
+		}
+	}
+	if runErr != nil && firstError == "" {
+		firstError = runErr.Error()
+	}
+	return decoded, firstError
+}
+
+// CodecForFormat returns the ffprobe codec name of files in the given audio format or extension
+func CodecForFormat(format string) string {
+	switch strings.TrimPrefix(strings.ToLower(format), ".") {
+	case "mp3":
+		return "mp3"
+	case "m4a", "m4b", "aac", "mp4":
+		return "aac"
+	case "opus":
+		return "opus"
+	case "ogg", "oga", "vorbis":
+		return "vorbis"
+	case "flac":
+		return "flac"
+	case "wav":
+		return "pcm"
+	default:
+		return ""
+	}
+}
+
+// IsAudioFile reports whether path has the extension of a format ytaudio downloads
+func IsAudioFile(path string) bool {
+	return CodecForFormat(filepath.Ext(path)) != ""
+}
@@ -0,0 +1,133 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// markdown renders the report as a Markdown document with a totals table, one row per item and the failures by class
+func (r *Report) markdown() []byte {
+	var b bytes.Buffer
+	t := r.Totals
+	fmt.Fprintf(&b, "# ytaudio batch %s\n\n", r.BatchID)
+	fmt.Fprintf(&b, "Started %s, finished %s, took %s.\n\n", r.Started.Format(time.RFC1123), r.Finished.Format(time.RFC1123), formatElapsed(t.Elapsed))
+
+	b.WriteString("| Items | Downloaded | Skipped | Failed | Corrupted | Size | Audio | Throughput |\n")
+	b.WriteString("|---:|---:|---:|---:|---:|---:|---:|---|\n")
+	fmt.Fprintf(&b, "| %d | %d | %d | %d | %d | %s | %s | %s |\n\n", t.Items, t.Downloaded, t.Skipped, t.Failed, t.Corrupted,
+		formatSize(t.Bytes), formatDuration(t.Audio), throughput(t))
+
+	b.WriteString("## Items\n\n")
+	b.WriteString("| # | Input | Status | Video | Channel | Duration | Score | Output | Size | Time |\n")
+	b.WriteString("|---:|---|---|---|---|---:|---:|---|---:|---:|\n")
+	for i, e := range r.Entries {
+		fmt.Fprintf(&b, "| %d | %s | %s | %s | %s | %s | %s | %s | %s | %s |\n", i+1,
+			cell(e.Input), e.Status, cell(e.Title), cell(e.Channel), formatDuration(e.Duration), formatScore(e.Score),
+			cell(e.OutputPath), formatSize(e.Size), formatElapsed(e.Elapsed))
+	}
+
+	if len(r.Failures) > 0 {
+		b.WriteString("\n## Failures\n")
+		for _, group := range r.Failures {
+			fmt.Fprintf(&b, "\n### %s (%d)\n\n", group.Class, len(group.Entries))
+			for _, e := range group.Entries {
+				fmt.Fprintf(&b, "- %s (%s): %s\n", e.Input, e.Stage, strings.ReplaceAll(e.Error, "\n", " "))
+			}
+		}
+	}
+	return b.Bytes()
+}
+
+// cell escapes a value for a Markdown table cell
+func cell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"size":       formatSize,
+	"duration":   formatDuration,
+	"elapsed":    formatElapsed,
+	"score":      formatScore,
+	"throughput": throughput,
+	"time":       func(t time.Time) string { return t.Format(time.RFC1123) },
+	"inc":        func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>ytaudio batch {{.BatchID}}</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; }
+td.num { text-align: right; white-space: nowrap; }
+tr.failed td { background: #fdecea; }
+tr.corrupted td { background: #fff4e5; }
+tr.skipped td { color: #777; }
+</style>
+</head>
+<body>
+<h1>ytaudio batch {{.BatchID}}</h1>
+<p>Started {{time .Started}}, finished {{time .Finished}}, took {{elapsed .Totals.Elapsed}}.</p>
+<table>
+<tr><th>Items</th><th>Downloaded</th><th>Skipped</th><th>Failed</th><th>Corrupted</th><th>Size</th><th>Audio</th><th>Throughput</th></tr>
+<tr><td class="num">{{.Totals.Items}}</td><td class="num">{{.Totals.Downloaded}}</td><td class="num">{{.Totals.Skipped}}</td><td class="num">{{.Totals.Failed}}</td><td class="num">{{.Totals.Corrupted}}</td><td class="num">{{size .Totals.Bytes}}</td><td class="num">{{duration .Totals.Audio}}</td><td>{{throughput .Totals}}</td></tr>
+</table>
+<h2>Items</h2>
+<table>
+<tr><th>#</th><th>Input</th><th>Status</th><th>Video</th><th>Channel</th><th>Duration</th><th>Score</th><th>Output</th><th>Size</th><th>Time</th></tr>
+{{range $i, $e := .Entries}}<tr class="{{$e.Status}}"><td class="num">{{inc $i}}</td><td>{{$e.Input}}</td><td>{{$e.Status}}</td><td>{{if $e.VideoID}}<a href="https://www.youtube.com/watch?v={{$e.VideoID}}">{{or $e.Title $e.VideoID}}</a>{{end}}</td><td>{{$e.Channel}}</td><td class="num">{{duration $e.Duration}}</td><td class="num">{{score $e.Score}}</td><td>{{$e.OutputPath}}</td><td class="num">{{size $e.Size}}</td><td class="num">{{elapsed $e.Elapsed}}</td></tr>
+{{end}}</table>
+{{if .Failures}}<h2>Failures</h2>
+{{range .Failures}}<h3>{{.Class}} ({{len .Entries}})</h3>
+<ul>
+{{range .Entries}}<li>{{.Input}} ({{.Stage}}): {{.Error}}</li>
+{{end}}</ul>
+{{end}}{{end}}</body>
+</html>
+`))
+
+// html renders the report as a standalone HTML page
+func (r *Report) html() ([]byte, error) {
+	var b bytes.Buffer
+	if err := htmlTemplate.Execute(&b, r); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func formatSize(size int64) string {
+	if size == 0 {
+		return ""
+	}
+	return config.ByteSize(size).String()
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return config.FormatClock(d.Seconds())
+}
+
+func formatElapsed(d time.Duration) string {
+	return d.Round(100 * time.Millisecond).String()
+}
+
+func formatScore(score *float64) string {
+	if score == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", *score)
+}
+
+func throughput(t Totals) string {
+	return fmt.Sprintf("%.1f items/min, %s/s", t.ItemsPerMinute, config.ByteSize(int64(t.BytesPerSecond)))
+}
@@ -0,0 +1,150 @@
+// Package report writes the summary of a finished batch as JSON for tooling and as Markdown or HTML for people.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// Status of an item in a report
+const (
+	StatusDownloaded = "downloaded"
+	StatusSkipped    = "skipped"
+	StatusFailed     = "failed"
+	StatusCorrupted  = "corrupted"
+)
+
+// Entry is one input of a batch and what became of it
+type Entry struct {
+	Input  string `json:"input"`
+	Status string `json:"status"`
+
+	// The matched video; Score is only set when a search picked it
+	VideoID  string        `json:"video_id,omitempty"`
+	Title    string        `json:"title,omitempty"`
+	Channel  string        `json:"channel,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Score    *float64      `json:"score,omitempty"`
+
+	OutputPath string        `json:"output_path,omitempty"`
+	Size       int64         `json:"size,omitempty"`
+	Elapsed    time.Duration `json:"elapsed"`
+
+	Stage string `json:"stage,omitempty"`
+	Class string `json:"class,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Totals sums up a batch
+type Totals struct {
+	Items      int           `json:"items"`
+	Downloaded int           `json:"downloaded"`
+	Skipped    int           `json:"skipped"`
+	Failed     int           `json:"failed"`
+	Corrupted  int           `json:"corrupted"`
+	Bytes      int64         `json:"bytes"`
+	Audio      time.Duration `json:"audio_duration"`
+	Elapsed    time.Duration `json:"elapsed"`
+
+	// Throughput over the wall-clock time of the batch
+	ItemsPerMinute float64 `json:"items_per_minute"`
+	BytesPerSecond float64 `json:"bytes_per_second"`
+}
+
+// FailureGroup collects the failed items that share an error class; skipped items are not failures
+type FailureGroup struct {
+	Class   string  `json:"class"`
+	Entries []Entry `json:"entries"`
+}
+
+// Report is the summary of one batch
+type Report struct {
+	BatchID  string         `json:"batch_id"`
+	Started  time.Time      `json:"started"`
+	Finished time.Time      `json:"finished"`
+	Totals   Totals         `json:"totals"`
+	Entries  []Entry        `json:"entries"`
+	Failures []FailureGroup `json:"failures,omitempty"`
+}
+
+// New builds a report from the entries of a batch, computing the totals and grouping the failures
+func New(batchID string, started, finished time.Time, entries []Entry) *Report {
+	r := &Report{BatchID: batchID, Started: started, Finished: finished, Entries: entries}
+	if r.Entries == nil {
+		r.Entries = []Entry{}
+	}
+
+	t := &r.Totals
+	t.Items = len(entries)
+	t.Elapsed = finished.Sub(started)
+	groups := make(map[string][]Entry)
+	for _, entry := range entries {
+		switch entry.Status {
+		case StatusDownloaded:
+			t.Downloaded++
+			t.Bytes += entry.Size
+			t.Audio += entry.Duration
+			continue
+		case StatusSkipped:
+			t.Skipped++
+			continue
+		case StatusCorrupted:
+			t.Corrupted++
+		default:
+			t.Failed++
+		}
+		groups[entry.Class] = append(groups[entry.Class], entry)
+	}
+	if seconds := t.Elapsed.Seconds(); seconds > 0 {
+		t.ItemsPerMinute = float64(t.Downloaded) / seconds * 60
+		t.BytesPerSecond = float64(t.Bytes) / seconds
+	}
+
+	for class, entries := range groups {
+		r.Failures = append(r.Failures, FailureGroup{Class: class, Entries: entries})
+	}
+	// Largest group first, then by name so reports of the same batch compare cleanly
+	sort.Slice(r.Failures, func(a, b int) bool {
+		if len(r.Failures[a].Entries) != len(r.Failures[b].Entries) {
+			return len(r.Failures[a].Entries) > len(r.Failures[b].Entries)
+		}
+		return r.Failures[a].Class < r.Failures[b].Class
+	})
+	return r
+}
+
+// Write writes the report to path in the format its extension names. {batch} in the path is replaced
+// by the batch ID; the path written to is returned.
+func (r *Report) Write(path string) (string, error) {
+	path = strings.ReplaceAll(path, config.ReportBatchPlaceholder, r.BatchID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return path, fmt.Errorf("error creating report directory: %w", err)
+	}
+
+	var data []byte
+	var err error
+	switch config.ReportFormat(path) {
+	case "json":
+		data, err = json.MarshalIndent(r, "", "  ")
+	case "markdown":
+		data = r.markdown()
+	case "html":
+		data, err = r.html()
+	default:
+		return path, fmt.Errorf("unknown report format for %s", path)
+	}
+	if err != nil {
+		return path, fmt.Errorf("error rendering report %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return path, fmt.Errorf("error writing report: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,213 @@
+package tagger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// id3Padding leaves room for later tag edits without rewriting the file
+const id3Padding = 1024
+
+// id3Frame is a raw ID3v2.4 frame
+type id3Frame struct {
+	ID   string
+	Data []byte
+}
+
+// id3Obsolete lists ID3v2.3 frames that have no ID3v2.4 equivalent and are dropped on upgrade
+var id3Obsolete = map[string]bool{"TDAT": true, "TIME": true, "TRDA": true, "TSIZ": true, "TORY": true}
+
+// writeID3 replaces the ID3v2 tag of an MP3 file with an ID3v2.4 tag holding the metadata
+func writeID3(path string, meta Metadata) error {
+	return rewriteFile(path, func(src *os.File, dst io.Writer) error {
+		frames, audioStart, err := readID3Frames(src)
+		if err != nil {
+			return err
+		}
+
+		frames = setID3Text(frames, "TPE1", meta.Artist)
+		frames = setID3Text(frames, "TIT2", meta.Title)
+		frames = setID3Text(frames, "TALB", meta.Album)
+		frames = setID3Text(frames, "TRCK", meta.trackNumber())
+		frames = setID3Text(frames, "TDRC", meta.Year)
+		frames = setID3Text(frames, "TCON", meta.Genre)
+		if meta.Comment != "" {
+			frames = append(removeID3Frames(frames, "COMM"), id3Frame{ID: "COMM", Data: id3Comment(meta.Comment)})
+		}
+
+		if meta.Cover != nil {
+			frames = append(removeID3Frames(frames, "APIC"), id3Frame{ID: "APIC", Data: id3Picture(meta.Cover)})
+		}
+
+		if _, err := dst.Write(encodeID3(frames)); err != nil {
+			return fmt.Errorf("error writing ID3 tag: %w", err)
+		}
+		if _, err := src.Seek(audioStart, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			return fmt.Errorf("error copying audio data: %w", err)
+		}
+		return nil
+	})
+}
+
+// readID3Frames reads the frames of an existing ID3v2.3/2.4 tag and returns where the audio starts
+func readID3Frames(r io.ReadSeeker) ([]id3Frame, int64, error) {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:3]) != "ID3" {
+		return nil, 0, nil
+	}
+
+	version := header[3]
+	flags := header[5]
+	size := int64(syncsafe(header[6:10]))
+	tagEnd := 10 + size
+	if flags&0x10 != 0 {
+		// Footer present
+		tagEnd += 10
+	}
+
+	// ID3v2.2 and tags with whole-tag unsynchronisation are replaced rather than upgraded
+	if (version != 3 && version != 4) || flags&0x80 != 0 {
+		return nil, tagEnd, nil
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, fmt.Errorf("error reading ID3 tag: %w", err)
+	}
+
+	pos := 0
+	if flags&0x40 != 0 && len(body) >= 4 {
+		// Skip the extended header
+		if version == 4 {
+			pos = int(syncsafe(body[:4]))
+		} else {
+			pos = 4 + int(binary.BigEndian.Uint32(body[:4]))
+		}
+	}
+
+	var frames []id3Frame
+	for pos+10 <= len(body) && body[pos] != 0 {
+		id := string(body[pos : pos+4])
+		var frameSize int
+		if version == 4 {
+			frameSize = int(syncsafe(body[pos+4 : pos+8]))
+		} else {
+			frameSize = int(binary.BigEndian.Uint32(body[pos+4 : pos+8]))
+		}
+		formatFlags := body[pos+9]
+		start := pos + 10
+		end := start + frameSize
+		if frameSize < 0 || end > len(body) {
+			break
+		}
+		pos = end
+
+		data, ok := id3FramePayload(body[start:end], version, formatFlags)
+		if !ok {
+			continue
+		}
+		if version == 3 {
+			if id3Obsolete[id] {
+				continue
+			}
+			if id == "TYER" {
+				id = "TDRC"
+			}
+		}
+		frames = append(frames, id3Frame{ID: id, Data: append([]byte(nil), data...)})
+	}
+
+	return frames, tagEnd, nil
+}
+
+// id3FramePayload strips the grouping byte and data length indicator a frame's format flags add in front of its
+// content, since frames are written back without flags. Compressed, encrypted or unsynchronised frames cannot be
+// copied and are reported as not ok.
+func id3FramePayload(data []byte, version, formatFlags byte) ([]byte, bool) {
+	var prefix int
+	if version == 4 {
+		if formatFlags&0x0E != 0 {
+			return nil, false
+		}
+		if formatFlags&0x40 != 0 {
+			prefix++
+		}
+		if formatFlags&0x01 != 0 {
+			prefix += 4
+		}
+	} else {
+		if formatFlags&0xC0 != 0 {
+			return nil, false
+		}
+		if formatFlags&0x20 != 0 {
+			prefix++
+		}
+	}
+	if prefix > len(data) {
+		return nil, false
+	}
+	return data[prefix:], true
+}
+
+// encodeID3 serializes frames into an ID3v2.4 tag with padding
+func encodeID3(frames []id3Frame) []byte {
+	var body bytes.Buffer
+	for _, frame := range frames {
+		body.WriteString(frame.ID)
+		body.Write(syncsafeBytes(uint32(len(frame.Data))))
+		body.Write([]byte{0, 0})
+		body.Write(frame.Data)
+	}
+	body.Write(make([]byte, id3Padding))
+
+	tag := []byte{'I', 'D', '3', 4, 0, 0}
+	tag = append(tag, syncsafeBytes(uint32(body.Len()))...)
+	return append(tag, body.Bytes()...)
+}
+
+// setID3Text replaces all frames with the given ID by a single UTF-8 text frame
+func setID3Text(frames []id3Frame, id, value string) []id3Frame {
+	if value == "" {
+		return frames
+	}
+	return append(removeID3Frames(frames, id), id3Frame{ID: id, Data: append([]byte{3}, value...)})
+}
+
+func removeID3Frames(frames []id3Frame, id string) []id3Frame {
+	kept := frames[:0]
+	for _, frame := range frames {
+		if frame.ID != id {
+			kept = append(kept, frame)
+		}
+	}
+	return kept
+}
+
+// id3Comment builds a UTF-8 COMM frame body with an empty description
+func id3Comment(text string) []byte {
+	data := []byte{3, 'e', 'n', 'g', 0}
+	return append(data, text...)
+}
+
+// id3Picture builds an APIC frame body holding a JPEG front cover
+func id3Picture(cover []byte) []byte {
+	data := []byte{3}
+	data = append(data, "image/jpeg"...)
+	// MIME terminator, picture type 3 (front cover), empty description
+	data = append(data, 0, 3, 0)
+	return append(data, cover...)
+}
+
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+func syncsafeBytes(n uint32) []byte {
+	return []byte{byte(n>>21) & 0x7F, byte(n>>14) & 0x7F, byte(n>>7) & 0x7F, byte(n) & 0x7F}
+}
@@ -0,0 +1,386 @@
+package tagger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// mp4Containers are the atoms ytaudio descends into to reach the iTunes tag list and chunk offsets
+var mp4Containers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true, "udta": true, "meta": true, "ilst": true,
+}
+
+// iTunes data atom type indicators
+const (
+	mp4TypeImplicit = 0
+	mp4TypeUTF8     = 1
+	mp4TypeJPEG     = 13
+)
+
+// mp4FreeformMean is the namespace of the freeform items iTunes and ReplayGain scanners write
+const mp4FreeformMean = "com.apple.iTunes"
+
+// mp4Atom is an atom whose children are parsed when it is a known container
+type mp4Atom struct {
+	Type     string
+	Prefix   []byte // version and flags of full-box containers such as meta
+	Data     []byte
+	Children []*mp4Atom
+}
+
+// mp4FileAtom locates a top-level atom in the file
+type mp4FileAtom struct {
+	Type   string
+	Offset int64
+	Size   int64
+}
+
+// writeMP4 replaces the iTunes-style tags of an MP4/M4A file
+func writeMP4(path string, meta Metadata) error {
+	return updateMP4(path, func(moov *mp4Atom) { setMP4Tags(moov, meta) })
+}
+
+// WriteMP4Freeform stores "----:com.apple.iTunes:<name>" text items in an MP4/M4A file, the form
+// players read for tags without an iTunes atom such as REPLAYGAIN_TRACK_GAIN
+func WriteMP4Freeform(path string, values map[string]string) error {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return updateMP4(path, func(moov *mp4Atom) {
+		ilst := mp4TagList(moov)
+		for _, name := range names {
+			setMP4Freeform(ilst, name, values[name])
+		}
+	})
+}
+
+// updateMP4 rewrites the moov atom of an MP4/M4A file after update has changed it
+func updateMP4(path string, update func(moov *mp4Atom)) error {
+	return rewriteFile(path, func(src *os.File, dst io.Writer) error {
+		stat, err := src.Stat()
+		if err != nil {
+			return err
+		}
+		topLevel, err := scanMP4(src, stat.Size())
+		if err != nil {
+			return err
+		}
+
+		var moovInfo *mp4FileAtom
+		var mdatOffset int64 = -1
+		for i := range topLevel {
+			switch topLevel[i].Type {
+			case "moov":
+				moovInfo = &topLevel[i]
+			case "mdat":
+				if mdatOffset < 0 {
+					mdatOffset = topLevel[i].Offset
+				}
+			}
+		}
+		if moovInfo == nil {
+			return fmt.Errorf("MP4 file has no moov atom")
+		}
+
+		raw := make([]byte, moovInfo.Size)
+		if _, err := src.ReadAt(raw, moovInfo.Offset); err != nil {
+			return fmt.Errorf("error reading moov atom: %w", err)
+		}
+		moov, err := parseMP4Atom(raw)
+		if err != nil {
+			return err
+		}
+
+		update(moov)
+		encoded := moov.encode()
+
+		// Media data after the moov atom moves by the size difference, so chunk offsets follow it
+		if mdatOffset > moovInfo.Offset {
+			shiftChunkOffsets(moov, int64(len(encoded))-moovInfo.Size)
+			encoded = moov.encode()
+		}
+
+		for _, atom := range topLevel {
+			if atom.Type == "moov" {
+				if _, err := dst.Write(encoded); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := io.Copy(dst, io.NewSectionReader(src, atom.Offset, atom.Size)); err != nil {
+				return fmt.Errorf("error copying %s atom: %w", atom.Type, err)
+			}
+		}
+		return nil
+	})
+}
+
+// scanMP4 lists the top-level atoms of the file
+func scanMP4(r io.ReaderAt, fileSize int64) ([]mp4FileAtom, error) {
+	var atoms []mp4FileAtom
+	header := make([]byte, 16)
+	for offset := int64(0); offset < fileSize; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("error reading MP4 atom header: %w", err)
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		switch size {
+		case 0:
+			size = fileSize - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("error reading MP4 atom header: %w", err)
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+		if size < 8 || offset+size > fileSize {
+			return nil, fmt.Errorf("invalid MP4 atom %q at offset %d", typ, offset)
+		}
+		atoms = append(atoms, mp4FileAtom{Type: typ, Offset: offset, Size: size})
+		offset += size
+	}
+	return atoms, nil
+}
+
+// parseMP4Atom parses a complete atom held in memory
+func parseMP4Atom(raw []byte) (*mp4Atom, error) {
+	if len(raw) < 8 {
+		return nil, fmt.Errorf("truncated MP4 atom")
+	}
+	atom := &mp4Atom{Type: string(raw[4:8])}
+	payload := raw[8:]
+	if binary.BigEndian.Uint32(raw[:4]) == 1 {
+		if len(raw) < 16 {
+			return nil, fmt.Errorf("truncated MP4 atom")
+		}
+		payload = raw[16:]
+	}
+
+	if !mp4Containers[atom.Type] {
+		atom.Data = payload
+		return atom, nil
+	}
+
+	// iTunes meta atoms are full boxes, QuickTime ones are plain containers
+	if atom.Type == "meta" && len(payload) >= 4 && binary.BigEndian.Uint32(payload[:4]) == 0 {
+		atom.Prefix = payload[:4]
+		payload = payload[4:]
+	}
+
+	for len(payload) >= 8 {
+		size := int64(binary.BigEndian.Uint32(payload[:4]))
+		switch size {
+		case 0:
+			size = int64(len(payload))
+		case 1:
+			// 64-bit size following the type, the atom is written back with a 32-bit one
+			if len(payload) < 16 {
+				return nil, fmt.Errorf("truncated extended size for child of %s atom", atom.Type)
+			}
+			size = int64(binary.BigEndian.Uint64(payload[8:16]))
+			if size < 16 {
+				return nil, fmt.Errorf("invalid size for child of %s atom", atom.Type)
+			}
+		}
+		if size < 8 || size > int64(len(payload)) {
+			return nil, fmt.Errorf("invalid size for child of %s atom", atom.Type)
+		}
+		child, err := parseMP4Atom(payload[:size])
+		if err != nil {
+			return nil, err
+		}
+		atom.Children = append(atom.Children, child)
+		payload = payload[size:]
+	}
+	return atom, nil
+}
+
+// encode serializes the atom and its children
+func (a *mp4Atom) encode() []byte {
+	var body bytes.Buffer
+	body.Write(a.Prefix)
+	if a.Children != nil {
+		for _, child := range a.Children {
+			body.Write(child.encode())
+		}
+	} else {
+		body.Write(a.Data)
+	}
+
+	out := make([]byte, 8, 8+body.Len())
+	binary.BigEndian.PutUint32(out[:4], uint32(8+body.Len()))
+	copy(out[4:8], a.Type)
+	return append(out, body.Bytes()...)
+}
+
+// child returns the first child of the given type, creating it when missing
+func (a *mp4Atom) child(typ string) *mp4Atom {
+	for _, c := range a.Children {
+		if c.Type == typ {
+			return c
+		}
+	}
+	c := &mp4Atom{Type: typ, Children: []*mp4Atom{}}
+	a.Children = append(a.Children, c)
+	return c
+}
+
+// setItem replaces an iTunes tag item
+func (a *mp4Atom) setItem(item *mp4Atom) {
+	for i, c := range a.Children {
+		if c.Type == item.Type {
+			a.Children[i] = item
+			return
+		}
+	}
+	a.Children = append(a.Children, item)
+}
+
+// mp4TagList returns moov/udta/meta/ilst, creating the atoms that are missing
+func mp4TagList(moov *mp4Atom) *mp4Atom {
+	udta := moov.child("udta")
+	metaAtom := udta.child("meta")
+	if metaAtom.Prefix == nil && len(metaAtom.Children) == 0 {
+		metaAtom.Prefix = []byte{0, 0, 0, 0}
+	}
+	if !hasChild(metaAtom, "hdlr") {
+		hdlr := &mp4Atom{Type: "hdlr", Data: []byte{0, 0, 0, 0, 0, 0, 0, 0, 'm', 'd', 'i', 'r', 'a', 'p', 'p', 'l', 0, 0, 0, 0, 0, 0, 0, 0, 0}}
+		metaAtom.Children = append([]*mp4Atom{hdlr}, metaAtom.Children...)
+	}
+	return metaAtom.child("ilst")
+}
+
+// setMP4Tags writes the metadata into moov/udta/meta/ilst
+func setMP4Tags(moov *mp4Atom, meta Metadata) {
+	ilst := mp4TagList(moov)
+	setMP4Text(ilst, "\xa9ART", meta.Artist)
+	setMP4Text(ilst, "\xa9nam", meta.Title)
+	setMP4Text(ilst, "\xa9alb", meta.Album)
+	setMP4Text(ilst, "\xa9day", meta.Year)
+	setMP4Text(ilst, "\xa9gen", meta.Genre)
+	setMP4Text(ilst, "\xa9cmt", meta.Comment)
+	if meta.Track > 0 {
+		value := make([]byte, 8)
+		binary.BigEndian.PutUint16(value[2:4], uint16(meta.Track))
+		ilst.setItem(mp4DataItem("trkn", mp4TypeImplicit, value))
+	}
+	if meta.Cover != nil {
+		ilst.setItem(mp4DataItem("covr", mp4TypeJPEG, meta.Cover))
+	}
+}
+
+func setMP4Text(ilst *mp4Atom, typ, value string) {
+	if value != "" {
+		ilst.setItem(mp4DataItem(typ, mp4TypeUTF8, []byte(value)))
+	}
+}
+
+// setMP4Freeform replaces the freeform item with the given name, which all share the "----" type
+func setMP4Freeform(ilst *mp4Atom, name, value string) {
+	item := mp4DataItem("----", mp4TypeUTF8, []byte(value))
+	// The mean and name atoms start with four bytes of version and flags
+	item.Children = append([]*mp4Atom{
+		{Type: "mean", Data: append([]byte{0, 0, 0, 0}, mp4FreeformMean...)},
+		{Type: "name", Data: append([]byte{0, 0, 0, 0}, name...)},
+	}, item.Children...)
+
+	for i, c := range ilst.Children {
+		if c.Type == "----" && strings.EqualFold(mp4FreeformName(c), name) {
+			ilst.Children[i] = item
+			return
+		}
+	}
+	ilst.Children = append(ilst.Children, item)
+}
+
+// mp4FreeformName returns the name of a freeform item in the iTunes namespace
+func mp4FreeformName(item *mp4Atom) string {
+	var mean, name string
+	for _, c := range mp4ItemAtoms(item) {
+		if len(c.Data) < 4 {
+			continue
+		}
+		switch c.Type {
+		case "mean":
+			mean = string(c.Data[4:])
+		case "name":
+			name = string(c.Data[4:])
+		}
+	}
+	if mean != mp4FreeformMean {
+		return ""
+	}
+	return name
+}
+
+// mp4ItemAtoms returns the atoms of a tag item, which holds them in Data when read back from the file
+// and as children when built in memory
+func mp4ItemAtoms(item *mp4Atom) []*mp4Atom {
+	atoms := item.Children
+	for data := item.Data; len(data) >= 8; {
+		size := int(binary.BigEndian.Uint32(data[:4]))
+		if size < 8 || size > len(data) {
+			break
+		}
+		atom, err := parseMP4Atom(data[:size])
+		if err != nil {
+			break
+		}
+		atoms = append(atoms, atom)
+		data = data[size:]
+	}
+	return atoms
+}
+
+// mp4DataItem builds an ilst item holding a single data atom
+func mp4DataItem(typ string, dataType uint32, value []byte) *mp4Atom {
+	data := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint32(data[:4], dataType)
+	data = append(data, value...)
+	return &mp4Atom{Type: typ, Children: []*mp4Atom{{Type: "data", Data: data}}}
+}
+
+func hasChild(a *mp4Atom, typ string) bool {
+	for _, c := range a.Children {
+		if c.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// shiftChunkOffsets moves every stco/co64 chunk offset in the tree by delta bytes
+func shiftChunkOffsets(a *mp4Atom, delta int64) {
+	for _, c := range a.Children {
+		switch c.Type {
+		case "stco":
+			if len(c.Data) < 8 {
+				continue
+			}
+			count := int(binary.BigEndian.Uint32(c.Data[4:8]))
+			for i := 0; i < count && 8+4*i+4 <= len(c.Data); i++ {
+				entry := c.Data[8+4*i : 8+4*i+4]
+				binary.BigEndian.PutUint32(entry, uint32(int64(binary.BigEndian.Uint32(entry))+delta))
+			}
+		case "co64":
+			if len(c.Data) < 8 {
+				continue
+			}
+			count := int(binary.BigEndian.Uint32(c.Data[4:8]))
+			for i := 0; i < count && 8+8*i+8 <= len(c.Data); i++ {
+				entry := c.Data[8+8*i : 8+8*i+8]
+				binary.BigEndian.PutUint64(entry, uint64(int64(binary.BigEndian.Uint64(entry))+delta))
+			}
+		default:
+			shiftChunkOffsets(c, delta)
+		}
+	}
+}
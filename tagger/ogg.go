@@ -0,0 +1,244 @@
+package tagger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Ogg page header flags
+const (
+	oggContinued = 0x01
+)
+
+// oggPage is a single Ogg page with its segment table decoded
+type oggPage struct {
+	HeaderType byte
+	Granule    uint64
+	Serial     uint32
+	Sequence   uint32
+	Segments   []byte
+	Data       []byte
+}
+
+// oggCRCTable is the CRC-32 lookup table for polynomial 0x04c11db7 used by Ogg
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// writeOgg replaces the comment header of an Ogg Opus or Ogg Vorbis file
+func writeOgg(path string, meta Metadata) error {
+	return rewriteFile(path, func(src *os.File, dst io.Writer) error {
+		r := bufio.NewReader(src)
+
+		first, err := readOggPage(r)
+		if err != nil {
+			return fmt.Errorf("error reading Ogg stream: %w", err)
+		}
+
+		// The first page holds the identification header, which tells how many headers follow
+		var headerCount int
+		var commentPrefix, commentSuffix []byte
+		switch {
+		case bytes.HasPrefix(first.Data, []byte("OpusHead")):
+			headerCount = 2
+			commentPrefix = []byte("OpusTags")
+		case bytes.HasPrefix(first.Data, []byte("\x01vorbis")):
+			headerCount = 3
+			commentPrefix = []byte("\x03vorbis")
+			commentSuffix = []byte{1}
+		default:
+			return fmt.Errorf("unsupported Ogg codec, only Opus and Vorbis can be tagged")
+		}
+
+		// Collect the remaining header packets, which must end on a page boundary
+		var packets [][]byte
+		var current []byte
+		lastHeaderSeq := first.Sequence
+		for len(packets) < headerCount-1 {
+			page, err := readOggPage(r)
+			if err != nil {
+				return fmt.Errorf("error reading Ogg headers: %w", err)
+			}
+			if page.Serial != first.Serial {
+				return fmt.Errorf("multiplexed Ogg streams are not supported")
+			}
+			lastHeaderSeq = page.Sequence
+
+			offset := 0
+			for _, lace := range page.Segments {
+				current = append(current, page.Data[offset:offset+int(lace)]...)
+				offset += int(lace)
+				if lace < 255 {
+					packets = append(packets, current)
+					current = nil
+				}
+			}
+			if len(packets) >= headerCount-1 && (current != nil || len(packets) > headerCount-1) {
+				return fmt.Errorf("audio data shares a page with the Ogg headers")
+			}
+		}
+
+		comment, err := parseVorbisComment(bytes.TrimPrefix(packets[0], commentPrefix))
+		if err != nil {
+			return err
+		}
+		comment.apply(meta)
+		if meta.Cover != nil {
+			// Ogg has no picture block, covers are stored base64 encoded as a comment
+			comment.set("METADATA_BLOCK_PICTURE", base64.StdEncoding.EncodeToString(pictureBlock(meta.Cover)))
+		}
+		packets[0] = append(append(append([]byte(nil), commentPrefix...), comment.encode()...), commentSuffix...)
+
+		// Identification page first, then every other header packet on its own pages
+		if err := writeOggPage(dst, first); err != nil {
+			return err
+		}
+		seq := first.Sequence + 1
+		for _, packet := range packets {
+			for _, page := range paginateOgg(packet, first.Serial, seq) {
+				if err := writeOggPage(dst, page); err != nil {
+					return err
+				}
+				seq++
+			}
+		}
+
+		// Audio pages keep their content but are renumbered after the new headers
+		for {
+			page, err := readOggPage(r)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("error reading Ogg audio: %w", err)
+			}
+			if page.Serial == first.Serial {
+				page.Sequence = seq + (page.Sequence - lastHeaderSeq - 1)
+			}
+			if err := writeOggPage(dst, page); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// readOggPage reads the next page from r
+func readOggPage(r io.Reader) (*oggPage, error) {
+	header := make([]byte, 27)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("truncated Ogg page")
+		}
+		return nil, err
+	}
+	if string(header[:4]) != "OggS" {
+		return nil, fmt.Errorf("invalid Ogg page signature")
+	}
+
+	page := &oggPage{
+		HeaderType: header[5],
+		Granule:    binary.LittleEndian.Uint64(header[6:14]),
+		Serial:     binary.LittleEndian.Uint32(header[14:18]),
+		Sequence:   binary.LittleEndian.Uint32(header[18:22]),
+		Segments:   make([]byte, header[26]),
+	}
+	if _, err := io.ReadFull(r, page.Segments); err != nil {
+		return nil, fmt.Errorf("truncated Ogg page")
+	}
+
+	size := 0
+	for _, lace := range page.Segments {
+		size += int(lace)
+	}
+	page.Data = make([]byte, size)
+	if _, err := io.ReadFull(r, page.Data); err != nil {
+		return nil, fmt.Errorf("truncated Ogg page")
+	}
+	return page, nil
+}
+
+// writeOggPage serializes a page and computes its checksum
+func writeOggPage(w io.Writer, page *oggPage) error {
+	buf := make([]byte, 27, 27+len(page.Segments)+len(page.Data))
+	copy(buf, "OggS")
+	buf[5] = page.HeaderType
+	binary.LittleEndian.PutUint64(buf[6:14], page.Granule)
+	binary.LittleEndian.PutUint32(buf[14:18], page.Serial)
+	binary.LittleEndian.PutUint32(buf[18:22], page.Sequence)
+	buf[26] = byte(len(page.Segments))
+	buf = append(buf, page.Segments...)
+	buf = append(buf, page.Data...)
+
+	var crc uint32
+	for _, b := range buf {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	binary.LittleEndian.PutUint32(buf[22:26], crc)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// paginateOgg splits a header packet over as many pages as its lacing values need
+func paginateOgg(packet []byte, serial, sequence uint32) []*oggPage {
+	var lacing []byte
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			lacing = append(lacing, byte(n))
+			break
+		}
+		lacing = append(lacing, 255)
+	}
+
+	var pages []*oggPage
+	offset := 0
+	for len(lacing) > 0 {
+		count := len(lacing)
+		if count > 255 {
+			count = 255
+		}
+		segments := lacing[:count]
+		lacing = lacing[count:]
+
+		size := 0
+		for _, lace := range segments {
+			size += int(lace)
+		}
+
+		page := &oggPage{
+			Serial:   serial,
+			Sequence: sequence,
+			Segments: segments,
+			Data:     packet[offset : offset+size],
+		}
+		if offset > 0 {
+			page.HeaderType = oggContinued
+		}
+		if len(lacing) > 0 {
+			// No packet finishes on this page
+			page.Granule = ^uint64(0)
+		}
+
+		pages = append(pages, page)
+		offset += size
+		sequence++
+	}
+	return pages
+}
@@ -0,0 +1,162 @@
+package tagger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedFormat is returned for files whose container has no tag writer
+var ErrUnsupportedFormat = errors.New("unsupported format for tagging")
+
+// Metadata holds the tags written to a downloaded file
+type Metadata struct {
+	Artist  string `json:"artist,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Album   string `json:"album,omitempty"`
+	Track   int    `json:"track,omitempty"`
+	Year    string `json:"year,omitempty"`
+	Genre   string `json:"genre,omitempty"`
+	Comment string `json:"comment,omitempty"`
+
+	// Cover is JPEG front cover art, embedded when set
+	Cover []byte `json:"-"`
+}
+
+// Merge fills the empty fields of m with the values from other
+func (m Metadata) Merge(other Metadata) Metadata {
+	if m.Artist == "" {
+		m.Artist = other.Artist
+	}
+	if m.Title == "" {
+		m.Title = other.Title
+	}
+	if m.Album == "" {
+		m.Album = other.Album
+	}
+	if m.Track == 0 {
+		m.Track = other.Track
+	}
+	if m.Year == "" {
+		m.Year = other.Year
+	}
+	if m.Genre == "" {
+		m.Genre = other.Genre
+	}
+	if m.Comment == "" {
+		m.Comment = other.Comment
+	}
+	if m.Cover == nil {
+		m.Cover = other.Cover
+	}
+	return m
+}
+
+// trackNumber formats the track number for text based tag formats
+func (m Metadata) trackNumber() string {
+	if m.Track <= 0 {
+		return ""
+	}
+	return strconv.Itoa(m.Track)
+}
+
+// Supported reports whether the file format of path can be tagged
+func Supported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3", ".flac", ".opus", ".ogg", ".oga", ".m4a", ".m4b", ".mp4":
+		return true
+	default:
+		return false
+	}
+}
+
+// Write stores the metadata in the native tag format of the file, replacing the matching existing tags
+func Write(path string, meta Metadata) error {
+	log.Printf("Writing tags to %s: %s - %s", path, meta.Artist, meta.Title)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".mp3":
+		return writeID3(path, meta)
+	case ".flac":
+		return writeFLAC(path, meta)
+	case ".opus", ".ogg", ".oga":
+		return writeOgg(path, meta)
+	case ".m4a", ".m4b", ".mp4":
+		return writeMP4(path, meta)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, ext)
+	}
+}
+
+// querySeparators split "Artist - Title" style queries, most specific first
+var querySeparators = []string{" - ", " – ", " — ", " -- "}
+
+// ParseQuery splits an "Artist - Title" query into its parts; queries without a separator become the title
+func ParseQuery(query string) (artist, title string) {
+	query = strings.TrimSpace(query)
+	for _, sep := range querySeparators {
+		if i := strings.Index(query, sep); i > 0 {
+			return strings.TrimSpace(query[:i]), strings.TrimSpace(query[i+len(sep):])
+		}
+	}
+	return "", query
+}
+
+// rewriteFile writes a new version of path through a temporary sibling file and renames it into place
+func rewriteFile(path string, write func(src *os.File, dst io.Writer) error) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".ytaudio-tags-*"+filepath.Ext(path))
+	if err != nil {
+		src.Close()
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+
+	writeErr := write(src, tmp)
+	src.Close()
+	closeErr := tmp.Close()
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		os.Remove(tmp.Name())
+		return writeErr
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("error replacing %s: %w", path, err)
+	}
+	return nil
+}
+
+// pictureBlock builds a FLAC PICTURE block body for the JPEG front cover, also used by Ogg as METADATA_BLOCK_PICTURE
+func pictureBlock(cover []byte) []byte {
+	width, height := 0, 0
+	if cfg, err := jpeg.DecodeConfig(bytes.NewReader(cover)); err == nil {
+		width, height = cfg.Width, cfg.Height
+	}
+
+	const mime = "image/jpeg"
+	var buf bytes.Buffer
+	for _, v := range []uint32{3, uint32(len(mime))} {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	buf.WriteString(mime)
+	// Empty description, dimensions, 24-bit color depth, no palette, then the image itself
+	for _, v := range []uint32{0, uint32(width), uint32(height), 24, 0, uint32(len(cover))} {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	buf.Write(cover)
+	return buf.Bytes()
+}
@@ -0,0 +1,682 @@
+package tagger
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testMeta = Metadata{
+	Artist:  "Daft Punk",
+	Title:   "One More Time",
+	Album:   "Discovery",
+	Track:   1,
+	Year:    "2001",
+	Genre:   "House",
+	Comment: "https://www.youtube.com/watch?v=FGBhQbmPwH8",
+}
+
+func writeTestFile(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testCover(t *testing.T, size int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, size, size)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query, artist, title string
+	}{
+		{"Daft Punk - One More Time", "Daft Punk", "One More Time"},
+		{"  Muse – Uprising ", "Muse", "Uprising"},
+		{"AC/DC -- Thunderstruck", "AC/DC", "Thunderstruck"},
+		{"Jay-Z - 99 Problems", "Jay-Z", "99 Problems"},
+		{"Uprising", "", "Uprising"},
+		{"- Untitled", "", "- Untitled"},
+	}
+	for _, tt := range tests {
+		artist, title := ParseQuery(tt.query)
+		if artist != tt.artist || title != tt.title {
+			t.Errorf("ParseQuery(%q) = %q, %q, want %q, %q", tt.query, artist, title, tt.artist, tt.title)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	got := Metadata{Title: "Mine", Track: 3}.Merge(Metadata{Artist: "Theirs", Title: "Theirs", Track: 9, Year: "1999"})
+	want := Metadata{Artist: "Theirs", Title: "Mine", Track: 3, Year: "1999"}
+	if got.Artist != want.Artist || got.Title != want.Title || got.Track != want.Track || got.Year != want.Year {
+		t.Errorf("Merge = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteUnsupported(t *testing.T) {
+	path := writeTestFile(t, "song.wav", []byte("RIFF"))
+	if err := Write(path, testMeta); err == nil || !strings.Contains(err.Error(), ErrUnsupportedFormat.Error()) {
+		t.Errorf("Write(.wav) = %v, want %v", err, ErrUnsupportedFormat)
+	}
+}
+
+// id3Frames reads the frames of the ID3 tag in path and the bytes following it
+func id3Frames(t *testing.T, path string) (map[string][][]byte, []byte) {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	frames, audioStart, err := readID3Frames(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string][][]byte)
+	for _, frame := range frames {
+		byID[frame.ID] = append(byID[frame.ID], frame.Data)
+	}
+	if _, err := file.Seek(audioStart, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	audio, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return byID, audio
+}
+
+func TestWriteID3(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x44, 0, 0, 0, 0}, 64)
+	path := writeTestFile(t, "song.mp3", audio)
+
+	meta := testMeta
+	meta.Cover = testCover(t, 8)
+	if err := Write(path, meta); err != nil {
+		t.Fatal(err)
+	}
+	// Writing again replaces the frames instead of adding more, and keeps those it has no value for
+	if err := Write(path, Metadata{Title: "One More Time (Live)"}); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, gotAudio := id3Frames(t, path)
+	want := map[string]string{
+		"TPE1": "Daft Punk", "TIT2": "One More Time (Live)", "TALB": "Discovery", "TRCK": "1", "TDRC": "2001", "TCON": "House",
+	}
+	for id, value := range want {
+		if len(frames[id]) != 1 || string(frames[id][0]) != "\x03"+value {
+			t.Errorf("%s frames = %q, want one UTF-8 frame %q", id, frames[id], value)
+		}
+	}
+	if len(frames["COMM"]) != 1 || !bytes.HasSuffix(frames["COMM"][0], []byte(testMeta.Comment)) {
+		t.Errorf("COMM frames = %q", frames["COMM"])
+	}
+	if len(frames["APIC"]) != 1 || !bytes.HasSuffix(frames["APIC"][0], meta.Cover) {
+		t.Errorf("APIC frames do not hold the cover")
+	}
+	if !bytes.Equal(gotAudio, audio) {
+		t.Errorf("audio changed: got %d bytes, want %d", len(gotAudio), len(audio))
+	}
+}
+
+func TestWriteID3UpgradesV23(t *testing.T) {
+	var body bytes.Buffer
+	for _, frame := range []struct{ id, value string }{{"TYER", "1997"}, {"TDAT", "0101"}, {"TPE1", "Radiohead"}} {
+		body.WriteString(frame.id)
+		binary.Write(&body, binary.BigEndian, uint32(len(frame.value)+1))
+		body.Write([]byte{0, 0, 0})
+		body.WriteString(frame.value)
+	}
+	tag := append([]byte{'I', 'D', '3', 3, 0, 0}, syncsafeBytes(uint32(body.Len()))...)
+	audio := []byte{0xFF, 0xFB, 0x90, 0x44, 1, 2, 3}
+	path := writeTestFile(t, "song.mp3", append(append(tag, body.Bytes()...), audio...))
+
+	if err := Write(path, Metadata{Title: "Karma Police"}); err != nil {
+		t.Fatal(err)
+	}
+	frames, gotAudio := id3Frames(t, path)
+	if len(frames["TDRC"]) != 1 || string(frames["TDRC"][0]) != "\x001997" {
+		t.Errorf("TYER was not upgraded to TDRC: %q", frames["TDRC"])
+	}
+	if frames["TDAT"] != nil || frames["TYER"] != nil {
+		t.Errorf("obsolete frames kept: %v", frames)
+	}
+	if string(frames["TPE1"][0]) != "\x00Radiohead" || string(frames["TIT2"][0]) != "\x03Karma Police" {
+		t.Errorf("frames = %q", frames)
+	}
+	if !bytes.Equal(gotAudio, audio) {
+		t.Errorf("audio = %v, want %v", gotAudio, audio)
+	}
+}
+
+func TestID3FramePayload(t *testing.T) {
+	tests := []struct {
+		name       string
+		version    byte
+		flags      byte
+		data, want string
+		ok         bool
+	}{
+		{"plain", 4, 0, "\x03Muse", "\x03Muse", true},
+		{"grouping", 4, 0x40, "\x07\x03Muse", "\x03Muse", true},
+		{"data length", 4, 0x01, "\x00\x00\x00\x05\x03Muse", "\x03Muse", true},
+		{"grouping and data length", 4, 0x41, "\x07\x00\x00\x00\x05\x03Muse", "\x03Muse", true},
+		{"compressed", 4, 0x09, "\x00\x00\x00\x05x\x9c", "", false},
+		{"encrypted", 4, 0x04, "\x01\x03Muse", "", false},
+		{"unsynchronised", 4, 0x02, "\x03Muse", "", false},
+		{"truncated", 4, 0x41, "\x07\x00", "", false},
+		{"v2.3 grouping", 3, 0x20, "\x07\x00Muse", "\x00Muse", true},
+		{"v2.3 compressed", 3, 0x80, "\x00\x00\x00\x05x\x9c", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := id3FramePayload([]byte(tt.data), tt.version, tt.flags)
+		if ok != tt.ok || string(got) != tt.want {
+			t.Errorf("%s: id3FramePayload = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWriteID3KeepsFlaggedV24Frames(t *testing.T) {
+	var body bytes.Buffer
+	for _, frame := range []struct {
+		id    string
+		flags byte
+		data  string
+	}{
+		{"TPE1", 0x41, "\x07\x00\x00\x00\x0a\x03Radiohead"},
+		{"TIT3", 0x08, "compressed"},
+	} {
+		body.WriteString(frame.id)
+		body.Write(syncsafeBytes(uint32(len(frame.data))))
+		body.Write([]byte{0, frame.flags})
+		body.WriteString(frame.data)
+	}
+	tag := append([]byte{'I', 'D', '3', 4, 0, 0}, syncsafeBytes(uint32(body.Len()))...)
+	path := writeTestFile(t, "song.mp3", append(append(tag, body.Bytes()...), 0xFF, 0xFB, 0x90, 0x44))
+
+	if err := Write(path, Metadata{Title: "Karma Police"}); err != nil {
+		t.Fatal(err)
+	}
+	frames, _ := id3Frames(t, path)
+	if len(frames["TPE1"]) != 1 || string(frames["TPE1"][0]) != "\x03Radiohead" {
+		t.Errorf("TPE1 frames = %q, want the text without the grouping byte and data length", frames["TPE1"])
+	}
+	if frames["TIT3"] != nil {
+		t.Errorf("compressed frame copied: %q", frames["TIT3"])
+	}
+}
+
+func TestWriteFLAC(t *testing.T) {
+	old := (&vorbisComment{Vendor: "reference libFLAC", Comments: []string{"title=Old", "ARTIST=Daft Punk", "LYRICS=la la"}}).encode()
+	audio := bytes.Repeat([]byte{0xFF, 0xF8, 0x69, 0x08}, 32)
+	var file bytes.Buffer
+	if err := writeFLACBlocks(&file, []flacBlock{
+		{Type: flacStreamInfo, Data: make([]byte, 34)},
+		{Type: flacPadding, Data: make([]byte, 10)},
+		{Type: flacVorbisComment, Data: old},
+		{Type: 2, Data: []byte("APPLICATION")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	file.Write(audio)
+	path := writeTestFile(t, "song.flac", file.Bytes())
+
+	cover := testCover(t, 16)
+	if err := Write(path, Metadata{Title: "One More Time", Track: 1, Cover: cover}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	blocks, err := readFLACBlocks(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []byte
+	for _, block := range blocks {
+		types = append(types, block.Type)
+	}
+	// STREAMINFO, comments, the kept application block, the new picture, padding last
+	if want := []byte{flacStreamInfo, flacVorbisComment, 2, flacPicture, flacPadding}; !bytes.Equal(types, want) {
+		t.Fatalf("block types = %v, want %v", types, want)
+	}
+
+	comment, err := parseVorbisComment(blocks[1].Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment.Vendor != "reference libFLAC" {
+		t.Errorf("vendor = %q", comment.Vendor)
+	}
+	want := []string{"ARTIST=Daft Punk", "LYRICS=la la", "TITLE=One More Time", "TRACKNUMBER=1"}
+	if strings.Join(comment.Comments, "|") != strings.Join(want, "|") {
+		t.Errorf("comments = %q, want %q", comment.Comments, want)
+	}
+	if !bytes.HasSuffix(blocks[3].Data, cover) {
+		t.Errorf("picture block does not hold the cover")
+	}
+
+	gotAudio, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gotAudio, audio) {
+		t.Errorf("audio changed: got %d bytes, want %d", len(gotAudio), len(audio))
+	}
+}
+
+func TestWriteFLACRejectsOtherFiles(t *testing.T) {
+	path := writeTestFile(t, "song.flac", []byte("OggS not really"))
+	if err := Write(path, testMeta); err == nil {
+		t.Error("Write accepted a file without the fLaC signature")
+	}
+}
+
+// oggFile builds an Opus stream of an identification header, a comment header and audio packets
+func oggFile(t *testing.T, audio [][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	head := append([]byte("OpusHead"), 1, 2, 0x38, 1, 0x80, 0xBB, 0, 0, 0, 0, 0)
+	pages := []*oggPage{
+		{HeaderType: 0x02, Sequence: 0, Segments: []byte{byte(len(head))}, Data: head},
+	}
+	tags := append([]byte("OpusTags"), (&vorbisComment{Vendor: "Lavf", Comments: []string{"ENCODER=Lavf"}}).encode()...)
+	pages = append(pages, &oggPage{Sequence: 1, Segments: []byte{byte(len(tags))}, Data: tags})
+	for i, packet := range audio {
+		page := &oggPage{Sequence: uint32(2 + i), Granule: uint64(960 * (i + 1)), Segments: []byte{byte(len(packet))}, Data: packet}
+		if i == len(audio)-1 {
+			page.HeaderType = 0x04
+		}
+		pages = append(pages, page)
+	}
+	for _, page := range pages {
+		page.Serial = 0x1234
+		if err := writeOggPage(&buf, page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestWriteOgg(t *testing.T) {
+	audio := [][]byte{bytes.Repeat([]byte{1}, 100), bytes.Repeat([]byte{2}, 120)}
+	path := writeTestFile(t, "song.opus", oggFile(t, audio))
+
+	// A cover big enough to spread the comment packet over several pages
+	meta := testMeta
+	meta.Cover = bytes.Repeat([]byte{0xAB}, 100000)
+	if err := Write(path, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages []*oggPage
+	r := bytes.NewReader(data)
+	for {
+		page, err := readOggPage(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+	}
+
+	// Serializing the pages again gives the same bytes only if every checksum is right
+	var again bytes.Buffer
+	for i, page := range pages {
+		if page.Sequence != uint32(i) {
+			t.Errorf("page %d has sequence number %d", i, page.Sequence)
+		}
+		writeOggPage(&again, page)
+	}
+	if !bytes.Equal(again.Bytes(), data) {
+		t.Error("pages have wrong checksums")
+	}
+
+	// The comment packet runs from page 1 up to the first page ending a packet
+	var packet []byte
+	var last int
+	for last = 1; last < len(pages); last++ {
+		page := pages[last]
+		if last > 1 && page.HeaderType&oggContinued == 0 {
+			t.Fatalf("page %d does not continue the comment packet", last)
+		}
+		packet = append(packet, page.Data...)
+		if page.Segments[len(page.Segments)-1] < 255 {
+			break
+		}
+	}
+	if last < 3 {
+		t.Errorf("comment packet fits on %d pages, expected it to span several", last)
+	}
+	comment, err := parseVorbisComment(bytes.TrimPrefix(packet, []byte("OpusTags")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]string)
+	for _, c := range comment.Comments {
+		name, value, _ := strings.Cut(c, "=")
+		fields[name] = value
+	}
+	if fields["TITLE"] != "One More Time" || fields["ARTIST"] != "Daft Punk" || fields["ENCODER"] != "Lavf" {
+		t.Errorf("comments = %v", fields)
+	}
+	picture, err := base64.StdEncoding.DecodeString(fields["METADATA_BLOCK_PICTURE"])
+	if err != nil || !bytes.HasSuffix(picture, meta.Cover) {
+		t.Errorf("METADATA_BLOCK_PICTURE does not hold the cover (%v)", err)
+	}
+
+	// Audio pages keep their data and granule positions
+	tail := pages[last+1:]
+	if len(tail) != len(audio) {
+		t.Fatalf("%d audio pages, want %d", len(tail), len(audio))
+	}
+	for i, page := range tail {
+		if !bytes.Equal(page.Data, audio[i]) || page.Granule != uint64(960*(i+1)) {
+			t.Errorf("audio page %d changed", i)
+		}
+	}
+}
+
+func TestPaginateOgg(t *testing.T) {
+	tests := []struct {
+		size, pages int
+	}{
+		{0, 1},
+		{254, 1},
+		{255, 1}, // a full segment needs a terminating zero lacing value
+		{255 * 255, 2},
+		{255*255 - 1, 1},
+		{100000, 2},
+	}
+	for _, tt := range tests {
+		pages := paginateOgg(make([]byte, tt.size), 1, 5)
+		if len(pages) != tt.pages {
+			t.Errorf("paginateOgg(%d bytes) = %d pages, want %d", tt.size, len(pages), tt.pages)
+			continue
+		}
+		total := 0
+		for i, page := range pages {
+			total += len(page.Data)
+			if page.Sequence != uint32(5+i) {
+				t.Errorf("paginateOgg(%d bytes): page %d has sequence %d", tt.size, i, page.Sequence)
+			}
+		}
+		if total != tt.size {
+			t.Errorf("paginateOgg(%d bytes) holds %d bytes", tt.size, total)
+		}
+		if lastPage := pages[len(pages)-1]; lastPage.Segments[len(lastPage.Segments)-1] == 255 {
+			t.Errorf("paginateOgg(%d bytes) does not end the packet", tt.size)
+		}
+	}
+}
+
+// mp4Box builds an atom from its type and payload parts
+func mp4Box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(out, uint32(8+len(body)))
+	copy(out[4:], typ)
+	return append(out, body...)
+}
+
+func be32(values ...uint32) []byte {
+	out := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(out[4*i:], v)
+	}
+	return out
+}
+
+func be64(values ...uint64) []byte {
+	out := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint64(out[8*i:], v)
+	}
+	return out
+}
+
+// mp4File builds an M4A whose chunk offsets point at the start and middle of its mdat atom.
+// The moov atom comes before mdat when faststart is set, like ffmpeg's -movflags +faststart writes it.
+func mp4File(faststart bool) []byte {
+	ftyp := mp4Box("ftyp", []byte("M4A \x00\x00\x02\x00isomiso2"))
+	mdat := mp4Box("mdat", bytes.Repeat([]byte{0xAA}, 64))
+	moov := func(mdatOffset uint32) []byte {
+		stbl := mp4Box("stbl",
+			mp4Box("stco", be32(0, 2, mdatOffset+8, mdatOffset+40)),
+			mp4Box("co64", be32(0, 1), be64(uint64(mdatOffset)+8)),
+		)
+		trak := mp4Box("trak", mp4Box("mdia", mp4Box("minf", stbl)))
+		return mp4Box("moov", mp4Box("mvhd", make([]byte, 100)), trak)
+	}
+
+	if faststart {
+		size := uint32(len(moov(0)))
+		return bytes.Join([][]byte{ftyp, moov(uint32(len(ftyp)) + size), mdat}, nil)
+	}
+	return bytes.Join([][]byte{ftyp, mdat, moov(uint32(len(ftyp)))}, nil)
+}
+
+// mp4Offsets returns the mdat offset of an M4A file and its chunk offsets, as the stco and co64 atoms hold them
+func mp4Offsets(t *testing.T, data []byte) (int64, []int64, *mp4Atom) {
+	t.Helper()
+	atoms, err := scanMP4(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mdat int64 = -1
+	var moov *mp4Atom
+	for _, a := range atoms {
+		switch a.Type {
+		case "mdat":
+			mdat = a.Offset
+		case "moov":
+			if moov, err = parseMP4Atom(data[a.Offset : a.Offset+a.Size]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if moov == nil || mdat < 0 {
+		t.Fatalf("missing moov or mdat in %v", atoms)
+	}
+
+	stbl := moov.child("trak").child("mdia").child("minf").child("stbl")
+	var offsets []int64
+	for _, c := range stbl.Children {
+		switch c.Type {
+		case "stco":
+			for i := 0; i < int(binary.BigEndian.Uint32(c.Data[4:8])); i++ {
+				offsets = append(offsets, int64(binary.BigEndian.Uint32(c.Data[8+4*i:])))
+			}
+		case "co64":
+			offsets = append(offsets, int64(binary.BigEndian.Uint64(c.Data[8:])))
+		}
+	}
+	return mdat, offsets, moov
+}
+
+func TestWriteMP4(t *testing.T) {
+	for _, faststart := range []bool{true, false} {
+		original := mp4File(faststart)
+		oldMdat, oldOffsets, _ := mp4Offsets(t, original)
+		path := writeTestFile(t, "song.m4a", original)
+
+		meta := testMeta
+		meta.Cover = testCover(t, 8)
+		if err := Write(path, meta); err != nil {
+			t.Fatal(err)
+		}
+		if err := Write(path, Metadata{Title: "One More Time (Live)"}); err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mdat, offsets, moov := mp4Offsets(t, data)
+		if faststart && mdat == oldMdat {
+			t.Errorf("faststart: mdat did not move, the test does not exercise offset shifting")
+		}
+		// Chunk offsets keep pointing at the same audio, wherever mdat ended up
+		for i := range offsets {
+			if offsets[i]-mdat != oldOffsets[i]-oldMdat {
+				t.Errorf("faststart=%v: chunk %d is at %d into mdat, want %d", faststart, i, offsets[i]-mdat, oldOffsets[i]-oldMdat)
+			}
+		}
+		if !bytes.Equal(data[mdat:mdat+72], original[oldMdat:oldMdat+72]) {
+			t.Errorf("faststart=%v: mdat changed", faststart)
+		}
+
+		ilst := moov.child("udta").child("meta").child("ilst")
+		if !hasChild(moov.child("udta").child("meta"), "hdlr") {
+			t.Errorf("faststart=%v: meta atom has no hdlr", faststart)
+		}
+		items := make(map[string][]byte)
+		for _, item := range ilst.Children {
+			// Items read back are leaves holding their data atom
+			data, err := parseMP4Atom(item.Data)
+			if err != nil || data.Type != "data" || len(data.Data) < 8 || 8+len(data.Data) != len(item.Data) {
+				t.Fatalf("faststart=%v: %q item is not a single data atom", faststart, item.Type)
+			}
+			if _, dup := items[item.Type]; dup {
+				t.Errorf("faststart=%v: %q item written twice", faststart, item.Type)
+			}
+			items[item.Type] = data.Data[8:]
+		}
+		for typ, value := range map[string]string{"\xa9nam": "One More Time (Live)", "\xa9ART": "Daft Punk", "\xa9day": "2001"} {
+			if string(items[typ]) != value {
+				t.Errorf("faststart=%v: %q = %q, want %q", faststart, typ, items[typ], value)
+			}
+		}
+		if track := items["trkn"]; len(track) != 8 || binary.BigEndian.Uint16(track[2:4]) != 1 {
+			t.Errorf("faststart=%v: trkn = %v", faststart, track)
+		}
+		if !bytes.Equal(items["covr"], meta.Cover) {
+			t.Errorf("faststart=%v: covr does not hold the cover", faststart)
+		}
+	}
+}
+
+func TestWriteMP4Freeform(t *testing.T) {
+	path := writeTestFile(t, "song.m4a", mp4File(true))
+	if err := WriteMP4Freeform(path, map[string]string{"REPLAYGAIN_TRACK_GAIN": "-3.00 dB", "REPLAYGAIN_TRACK_PEAK": "0.500000"}); err != nil {
+		t.Fatal(err)
+	}
+	// Measuring again replaces the values, and tagging afterwards keeps them
+	if err := WriteMP4Freeform(path, map[string]string{"replaygain_track_gain": "-4.50 dB"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(path, testMeta); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, moov := mp4Offsets(t, data)
+	values := make(map[string]string)
+	for _, item := range moov.child("udta").child("meta").child("ilst").Children {
+		if item.Type != "----" {
+			continue
+		}
+		name := mp4FreeformName(item)
+		if _, dup := values[name]; dup || name == "" {
+			t.Errorf("freeform item %q written twice or outside the iTunes namespace", name)
+		}
+		atoms := mp4ItemAtoms(item)
+		if len(atoms) != 3 || atoms[2].Type != "data" || len(atoms[2].Data) < 8 {
+			t.Fatalf("freeform item %q is not mean, name and data atoms", name)
+		}
+		values[name] = string(atoms[2].Data[8:])
+	}
+	want := map[string]string{"replaygain_track_gain": "-4.50 dB", "REPLAYGAIN_TRACK_PEAK": "0.500000"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("freeform items = %q, want %q", values, want)
+	}
+}
+
+// mp4LargeBox builds an atom with a 64-bit size, as muxers write for atoms that may grow past 4 GiB
+func mp4LargeBox(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := append(be32(1), typ...)
+	return append(append(out, be64(uint64(16+len(body)))...), body...)
+}
+
+func TestParseMP4AtomExtendedSize(t *testing.T) {
+	stco := mp4Box("stco", be32(0, 1, 100))
+	raw := mp4Box("moov", mp4Box("mvhd", make([]byte, 100)), mp4LargeBox("trak", mp4LargeBox("free", []byte("x"))), stco)
+	moov, err := parseMP4Atom(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, c := range moov.Children {
+		types = append(types, c.Type)
+	}
+	if strings.Join(types, ",") != "mvhd,trak,stco" {
+		t.Fatalf("children = %v, want mvhd, trak and stco", types)
+	}
+	if free := moov.Children[1].Children; len(free) != 1 || string(free[0].Data) != "x" {
+		t.Errorf("trak children = %+v, want the free atom", free)
+	}
+	// Written back with 32-bit sizes
+	want := mp4Box("moov", mp4Box("mvhd", make([]byte, 100)), mp4Box("trak", mp4Box("free", []byte("x"))), stco)
+	if got := moov.encode(); !bytes.Equal(got, want) {
+		t.Errorf("encode = %x, want %x", got, want)
+	}
+
+	for _, bad := range [][]byte{
+		mp4Box("moov", be32(1), []byte("trak"), be64(8)),   // extended size smaller than its header
+		mp4Box("moov", be32(1), []byte("trak"), be64(400)), // past the end of the parent
+		mp4Box("moov", be32(1), []byte("trak"), be32(0)),   // truncated extended size
+	} {
+		if _, err := parseMP4Atom(bad); err == nil {
+			t.Errorf("parseMP4Atom(%x) succeeded, want an error", bad)
+		}
+	}
+}
+
+func TestShiftChunkOffsets(t *testing.T) {
+	stco := &mp4Atom{Type: "stco", Data: be32(0, 2, 100, 200)}
+	co64 := &mp4Atom{Type: "co64", Data: append(be32(0, 1), be64(1<<33)...)}
+	truncated := &mp4Atom{Type: "stco", Data: be32(0, 5, 100)} // claims more entries than it has
+	root := &mp4Atom{Type: "moov", Children: []*mp4Atom{{Type: "trak", Children: []*mp4Atom{stco, co64, truncated}}}}
+
+	shiftChunkOffsets(root, -50)
+	if got := be32(0, 2, 50, 150); !bytes.Equal(stco.Data, got) {
+		t.Errorf("stco = %v, want %v", stco.Data, got)
+	}
+	if got := append(be32(0, 1), be64(1<<33-50)...); !bytes.Equal(co64.Data, got) {
+		t.Errorf("co64 = %v, want %v", co64.Data, got)
+	}
+	if got := be32(0, 5, 50); !bytes.Equal(truncated.Data, got) {
+		t.Errorf("truncated stco = %v, want %v", truncated.Data, got)
+	}
+}
@@ -0,0 +1,226 @@
+package tagger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// FLAC metadata block types
+const (
+	flacStreamInfo    = 0
+	flacPadding       = 1
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+// flacPaddingSize leaves room for later tag edits without rewriting the file
+const flacPaddingSize = 1024
+
+// vorbisComment is a Vorbis comment block as used by FLAC, Ogg Vorbis and Opus
+type vorbisComment struct {
+	Vendor   string
+	Comments []string
+}
+
+// flacBlock is a raw FLAC metadata block
+type flacBlock struct {
+	Type byte
+	Data []byte
+}
+
+// parseVorbisComment decodes a Vorbis comment block
+func parseVorbisComment(data []byte) (*vorbisComment, error) {
+	r := bytes.NewReader(data)
+	readString := func() (string, error) {
+		var length uint32
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return "", err
+		}
+		if int64(length) > int64(r.Len()) {
+			return "", fmt.Errorf("comment length %d exceeds block size", length)
+		}
+		buf := make([]byte, length)
+		_, err := io.ReadFull(r, buf)
+		return string(buf), err
+	}
+
+	vendor, err := readString()
+	if err != nil {
+		return nil, fmt.Errorf("error reading vorbis comment vendor: %w", err)
+	}
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("error reading vorbis comment count: %w", err)
+	}
+
+	vc := &vorbisComment{Vendor: vendor}
+	for i := uint32(0); i < count; i++ {
+		comment, err := readString()
+		if err != nil {
+			return nil, fmt.Errorf("error reading vorbis comment: %w", err)
+		}
+		vc.Comments = append(vc.Comments, comment)
+	}
+	return vc, nil
+}
+
+// encode serializes the comment block without a framing bit
+func (vc *vorbisComment) encode() []byte {
+	var buf bytes.Buffer
+	writeString := func(s string) {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+	writeString(vc.Vendor)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(vc.Comments)))
+	for _, comment := range vc.Comments {
+		writeString(comment)
+	}
+	return buf.Bytes()
+}
+
+// set replaces every comment with the given field name by a single value
+func (vc *vorbisComment) set(field, value string) {
+	if value == "" {
+		return
+	}
+	vc.remove(field)
+	vc.Comments = append(vc.Comments, field+"="+value)
+}
+
+// remove deletes every comment with the given field name, compared case-insensitively
+func (vc *vorbisComment) remove(field string) {
+	kept := vc.Comments[:0]
+	for _, comment := range vc.Comments {
+		name, _, _ := strings.Cut(comment, "=")
+		if !strings.EqualFold(name, field) {
+			kept = append(kept, comment)
+		}
+	}
+	vc.Comments = kept
+}
+
+// apply stores the metadata using the standard Vorbis comment field names
+func (vc *vorbisComment) apply(meta Metadata) {
+	vc.set("ARTIST", meta.Artist)
+	vc.set("TITLE", meta.Title)
+	vc.set("ALBUM", meta.Album)
+	vc.set("TRACKNUMBER", meta.trackNumber())
+	vc.set("DATE", meta.Year)
+	vc.set("GENRE", meta.Genre)
+	vc.set("COMMENT", meta.Comment)
+}
+
+// writeFLAC replaces the Vorbis comment block of a FLAC file
+func writeFLAC(path string, meta Metadata) error {
+	return rewriteFile(path, func(src *os.File, dst io.Writer) error {
+		blocks, err := readFLACBlocks(src)
+		if err != nil {
+			return err
+		}
+
+		var comment *vorbisComment
+		var kept []flacBlock
+		for _, block := range blocks {
+			switch block.Type {
+			case flacVorbisComment:
+				if comment, err = parseVorbisComment(block.Data); err != nil {
+					return err
+				}
+			case flacPadding:
+				// Padding is rebuilt at the end
+			case flacPicture:
+				if meta.Cover == nil {
+					kept = append(kept, block)
+				}
+			default:
+				kept = append(kept, block)
+			}
+		}
+		if comment == nil {
+			comment = &vorbisComment{Vendor: "ytaudio"}
+		}
+		comment.apply(meta)
+
+		// The comment block goes right after STREAMINFO, padding always last
+		blocks = append([]flacBlock{kept[0], {Type: flacVorbisComment, Data: comment.encode()}}, kept[1:]...)
+		if meta.Cover != nil {
+			blocks = append(blocks, flacBlock{Type: flacPicture, Data: pictureBlock(meta.Cover)})
+		}
+		blocks = append(blocks, flacBlock{Type: flacPadding, Data: make([]byte, flacPaddingSize)})
+
+		if err := writeFLACBlocks(dst, blocks); err != nil {
+			return err
+		}
+		if _, err := io.Copy(dst, src); err != nil {
+			return fmt.Errorf("error copying audio frames: %w", err)
+		}
+		return nil
+	})
+}
+
+// readFLACBlocks reads all metadata blocks, leaving r at the first audio frame
+func readFLACBlocks(r io.ReadSeeker) ([]flacBlock, error) {
+	// Some tools put an ID3v2 tag in front of FLAC files, which is dropped
+	if _, audioStart, err := readID3Frames(r); err != nil {
+		return nil, err
+	} else if _, err := r.Seek(audioStart, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "fLaC" {
+		return nil, fmt.Errorf("not a FLAC file")
+	}
+
+	var blocks []flacBlock
+	for {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, fmt.Errorf("error reading FLAC metadata: %w", err)
+		}
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("error reading FLAC metadata: %w", err)
+		}
+		blocks = append(blocks, flacBlock{Type: header[0] & 0x7F, Data: data})
+		if header[0]&0x80 != 0 {
+			break
+		}
+	}
+
+	if len(blocks) == 0 || blocks[0].Type != flacStreamInfo {
+		return nil, fmt.Errorf("FLAC file does not start with STREAMINFO")
+	}
+	return blocks, nil
+}
+
+// writeFLACBlocks writes the FLAC signature and metadata blocks, flagging the last one
+func writeFLACBlocks(w io.Writer, blocks []flacBlock) error {
+	if _, err := w.Write([]byte("fLaC")); err != nil {
+		return err
+	}
+	for i, block := range blocks {
+		if len(block.Data) >= 1<<24 {
+			return fmt.Errorf("FLAC metadata block too large")
+		}
+		typ := block.Type
+		if i == len(blocks)-1 {
+			typ |= 0x80
+		}
+		length := len(block.Data)
+		header := []byte{typ, byte(length >> 16), byte(length >> 8), byte(length)}
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+		if _, err := w.Write(block.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
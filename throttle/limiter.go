@@ -0,0 +1,160 @@
+package throttle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// copyBufferSize keeps each read small enough for the bucket to interleave many connections fairly
+const copyBufferSize = 16 << 10
+
+// followInterval is how often Follow checks the rate schedule
+var followInterval = time.Minute
+
+// Limiter is a token bucket shared by every download of the process, so concurrent
+// downloads split the budget between them as they start and finish
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second, zero is unlimited
+	tokens float64
+	last   time.Time
+	active int
+}
+
+// NewLimiter creates a limiter allowing rate bytes per second, zero meaning unlimited
+func NewLimiter(rate int64) *Limiter {
+	return &Limiter{rate: float64(rate), last: time.Now()}
+}
+
+// Rate returns the current limit in bytes per second
+func (l *Limiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// SetRate changes the limit, taking effect for the bytes transferred from now on
+func (l *Limiter) SetRate(rate int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if float64(rate) == l.rate {
+		return
+	}
+	l.refill(time.Now())
+	l.rate = float64(rate)
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+}
+
+// Follow applies rateAt every minute until ctx is done, for rate schedules
+func (l *Limiter) Follow(ctx context.Context, rateAt func(time.Time) int64) {
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for {
+		if rate := rateAt(time.Now()); rate != l.Rate() {
+			log.Printf("Total bandwidth limit is now %s", formatRate(rate))
+			l.SetRate(rate)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Wait blocks until n more bytes may be transferred
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	l.refill(now)
+	// Tokens may go negative, which reserves the bytes and makes later callers wait their turn
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refill adds the tokens earned since the last call, allowing bursts of up to one second
+func (l *Limiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+}
+
+// Copy copies src to dst at the pace of the limiter
+func (l *Limiter) Copy(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	buf := make([]byte, copyBufferSize)
+	var written int64
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if waitErr := l.Wait(ctx, n); waitErr != nil {
+				return written, waitErr
+			}
+			m, writeErr := dst.Write(buf[:n])
+			written += int64(m)
+			if writeErr != nil {
+				return written, writeErr
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// Acquire registers a download that cannot be routed through the proxy and returns its even
+// share of the current rate, zero meaning unlimited; Release must be called when it finishes.
+// The share is not updated later, neither for rate changes nor for downloads joining or leaving.
+func (l *Limiter) Acquire() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active++
+	return int64(l.rate) / int64(l.active)
+}
+
+// Release unregisters a download registered with Acquire
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+}
+
+func formatRate(rate int64) string {
+	switch {
+	case rate <= 0:
+		return "unlimited"
+	case rate >= 1<<20:
+		return fmt.Sprintf("%.1f MiB/s", float64(rate)/(1<<20))
+	case rate >= 1<<10:
+		return fmt.Sprintf("%.1f KiB/s", float64(rate)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B/s", rate)
+	}
+}
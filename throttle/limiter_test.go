@@ -0,0 +1,155 @@
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+func TestAcquire(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  int64
+		steps []string // "+" acquires, "-" releases
+		want  []int64  // share returned by each acquire
+	}{
+		{"even shares", 900, []string{"+", "+", "+"}, []int64{900, 450, 300}},
+		{"released shares", 900, []string{"+", "+", "-", "+", "-", "-", "+"}, []int64{900, 450, 450, 900}},
+		{"unlimited", 0, []string{"+", "+"}, []int64{0, 0}},
+		{"rounded down", 1000, []string{"+", "+", "+"}, []int64{1000, 500, 333}},
+	}
+	for _, tt := range tests {
+		l := NewLimiter(tt.rate)
+		var got []int64
+		for _, step := range tt.steps {
+			if step == "+" {
+				got = append(got, l.Acquire())
+			} else {
+				l.Release()
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%s: %d acquires, want %d", tt.name, len(got), len(tt.want))
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: acquire %d = %d, want %d", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		rate     int64
+		sizes    []int
+		min, max time.Duration
+	}{
+		{"unlimited", 0, []int{1 << 30}, 0, 20 * time.Millisecond},
+		{"paced", 100_000, []int{10_000, 10_000}, 160 * time.Millisecond, 600 * time.Millisecond},
+		{"reserved ahead", 50_000, []int{10_000}, 160 * time.Millisecond, 600 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		l := NewLimiter(tt.rate)
+		start := time.Now()
+		for _, n := range tt.sizes {
+			if err := l.Wait(context.Background(), n); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed < tt.min || elapsed > tt.max {
+			t.Errorf("%s: waited %v, want between %v and %v", tt.name, elapsed, tt.min, tt.max)
+		}
+	}
+
+	// A cancelled wait returns at once
+	l := NewLimiter(1000)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := l.Wait(ctx, 100_000); !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > time.Second {
+		t.Errorf("Wait = %v after %v, want the deadline", err, time.Since(start))
+	}
+}
+
+func TestSetRate(t *testing.T) {
+	l := NewLimiter(1 << 20)
+	l.tokens = 1 << 20
+	// A lower rate also lowers the burst the bucket holds
+	l.SetRate(1000)
+	if l.Rate() != 1000 || l.tokens > 1000 {
+		t.Errorf("rate %d with %g tokens, want 1000 with at most 1000", l.Rate(), l.tokens)
+	}
+	l.SetRate(0)
+	if err := l.Wait(context.Background(), 1<<30); err != nil || l.Rate() != 0 {
+		t.Errorf("Wait after lifting the limit = %v, rate %d", err, l.Rate())
+	}
+}
+
+func TestCopy(t *testing.T) {
+	data := bytes.Repeat([]byte("audio"), 10_000)
+	var dst bytes.Buffer
+	start := time.Now()
+	n, err := NewLimiter(200_000).Copy(context.Background(), &dst, bytes.NewReader(data))
+	if err != nil || n != int64(len(data)) || !bytes.Equal(dst.Bytes(), data) {
+		t.Fatalf("Copy = %d, %v, want all %d bytes", n, err, len(data))
+	}
+	// 50 KB at 200 KB/s
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Copy took %v, want at least 200ms", elapsed)
+	}
+}
+
+func TestFollowSchedule(t *testing.T) {
+	windows, err := config.ParseRateSchedule("09:00-18:00=2M,18:00-09:00=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(interval time.Duration) { followInterval = interval }(followInterval)
+	followInterval = 5 * time.Millisecond
+
+	// Each check sees a clock that moved on by the next time in the list, and records the rate
+	// the limiter was left with by the check before
+	clocks := []string{"08:59", "09:00", "12:00", "18:00", "23:30"}
+	want := []int64{0, 2 << 20, 2 << 20, 0, 0}
+	var l *Limiter
+	var calls atomic.Int32
+	var applied [5]atomic.Int64
+	rateAt := func(time.Time) int64 {
+		i := int(calls.Add(1)) - 1
+		if i > 0 && i <= len(clocks) {
+			applied[i-1].Store(l.Rate())
+		}
+		if i >= len(clocks) {
+			i = len(clocks) - 1
+		}
+		at, _ := time.Parse("15:04", clocks[i])
+		return int64(config.RateAt(windows, at, 4<<20))
+	}
+
+	l = NewLimiter(4 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Follow(ctx, rateAt)
+		close(done)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for int(calls.Load()) <= len(clocks) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	for i := range clocks {
+		if got := applied[i].Load(); got != want[i] {
+			t.Errorf("rate at %s = %d, want %d", clocks[i], got, want[i])
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package throttle
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// dialTimeout bounds connecting to the target or upstream proxy
+const dialTimeout = 30 * time.Second
+
+// proxyUser is the user name of the per-run credentials clients must send
+const proxyUser = "ytaudio"
+
+// Proxy is a loopback HTTP proxy that paces every response through a shared Limiter, so all
+// yt-dlp processes routed through it share one bandwidth budget. Clients authenticate with a
+// random token, so other local users cannot relay through it.
+type Proxy struct {
+	limiter  *Limiter
+	upstream *url.URL
+	listener net.Listener
+	token    string
+	dialer   net.Dialer
+}
+
+// NewProxy listens on a random loopback port; upstream is an optional http or https proxy to chain to,
+// and sourceAddress an optional local IP address the outgoing connections are made from
+func NewProxy(limiter *Limiter, upstream, sourceAddress string) (*Proxy, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("error creating proxy token: %w", err)
+	}
+	p := &Proxy{limiter: limiter, token: hex.EncodeToString(token), dialer: net.Dialer{Timeout: dialTimeout}}
+	if sourceAddress != "" {
+		ip := net.ParseIP(sourceAddress)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid source address %q", sourceAddress)
+		}
+		p.dialer.LocalAddr = &net.TCPAddr{IP: ip}
+	}
+	if upstream != "" {
+		u, err := url.Parse(upstream)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream proxy: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("cannot chain to %s proxies", u.Scheme)
+		}
+		p.upstream = u
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("error starting bandwidth limiting proxy: %w", err)
+	}
+	p.listener = listener
+	return p, nil
+}
+
+// URL returns the proxy URL to hand to yt-dlp, including the token
+func (p *Proxy) URL() string {
+	u := url.URL{Scheme: "http", User: url.UserPassword(proxyUser, p.token), Host: p.Addr()}
+	return u.String()
+}
+
+// Addr returns the address the proxy listens on, for logging without the token
+func (p *Proxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// Serve accepts connections until ctx is done
+func (p *Proxy) Serve(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		p.listener.Close()
+	}()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Bandwidth proxy stopped: %v", err)
+			}
+			return
+		}
+		go p.handle(ctx, conn)
+	}
+}
+
+func (p *Proxy) handle(ctx context.Context, client net.Conn) {
+	defer client.Close()
+	reader := bufio.NewReader(client)
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return
+	}
+	if !p.authorized(req.Header) {
+		io.WriteString(client, "HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: Basic realm=\"ytaudio\"\r\nContent-Length: 0\r\n\r\n")
+		return
+	}
+	req.Header.Del("Proxy-Authorization")
+
+	if req.Method == http.MethodConnect {
+		p.tunnel(ctx, client, reader, req)
+		return
+	}
+	p.forward(ctx, client, req)
+}
+
+// tunnel relays an HTTPS connection, pacing the bytes sent back to the client
+func (p *Proxy) tunnel(ctx context.Context, client net.Conn, reader *bufio.Reader, req *http.Request) {
+	server, err := p.dial(ctx, req.Host)
+	if err != nil {
+		log.Printf("Bandwidth proxy: %v", err)
+		fmt.Fprintf(client, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer server.Close()
+
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		// Uploads are tiny requests and are not paced; bytes the reader already buffered go first
+		io.Copy(server, reader)
+		closeWrite(server)
+		close(done)
+	}()
+	p.limiter.Copy(ctx, client, server)
+	closeWrite(client)
+	<-done
+}
+
+// forward relays a single plain HTTP request, closing the connection afterwards
+func (p *Proxy) forward(ctx context.Context, client net.Conn, req *http.Request) {
+	host := req.URL.Host
+	if !strings.Contains(host, ":") {
+		host += ":80"
+	}
+
+	var server net.Conn
+	var err error
+	if p.upstream != nil {
+		server, err = p.dialUpstream(ctx)
+	} else {
+		server, err = p.dialContext(ctx, host)
+	}
+	if err != nil {
+		log.Printf("Bandwidth proxy: %v", err)
+		fmt.Fprintf(client, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return
+	}
+	defer server.Close()
+
+	req.Close = true
+	req.Header.Del("Proxy-Connection")
+	if p.upstream != nil {
+		p.setUpstreamAuth(req.Header)
+		err = req.WriteProxy(server)
+	} else {
+		err = req.Write(server)
+	}
+	if err != nil {
+		return
+	}
+	p.limiter.Copy(ctx, client, server)
+}
+
+// dial connects to a host:port target, through the upstream proxy when there is one
+func (p *Proxy) dial(ctx context.Context, target string) (net.Conn, error) {
+	if p.upstream == nil {
+		return p.dialContext(ctx, target)
+	}
+
+	conn, err := p.dialUpstream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	p.setUpstreamAuth(header)
+	connect := &http.Request{Method: http.MethodConnect, URL: &url.URL{Opaque: target}, Host: target, Header: header}
+	if err := connect.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error sending CONNECT to upstream proxy: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, connect)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error reading upstream proxy response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("upstream proxy refused CONNECT to %s: %s", target, resp.Status)
+	}
+	// The server may already have spoken, and those bytes are in the reader
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn reads through the reader that consumed the CONNECT response, so bytes it buffered are not lost
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *bufferedConn) CloseWrite() error {
+	closeWrite(c.Conn)
+	return nil
+}
+
+func (p *Proxy) dialUpstream(ctx context.Context) (net.Conn, error) {
+	host := p.upstream.Host
+	if p.upstream.Port() == "" {
+		if p.upstream.Scheme == "https" {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+	conn, err := p.dialContext(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if p.upstream.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: p.upstream.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error connecting to upstream proxy: %w", err)
+		}
+		return tlsConn, nil
+	}
+	return conn, nil
+}
+
+// authorized reports whether a request carries the token of this run
+func (p *Proxy) authorized(header http.Header) bool {
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte(proxyUser+":"+p.token))
+	return subtle.ConstantTimeCompare([]byte(header.Get("Proxy-Authorization")), []byte(want)) == 1
+}
+
+func (p *Proxy) setUpstreamAuth(header http.Header) {
+	if p.upstream.User == nil {
+		return
+	}
+	password, _ := p.upstream.User.Password()
+	credentials := p.upstream.User.Username() + ":" + password
+	header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+}
+
+// dialContext connects to a host:port address from the source address
+func (p *Proxy) dialContext(ctx context.Context, address string) (net.Conn, error) {
+	conn, err := p.dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to %s: %w", address, err)
+	}
+	return conn, nil
+}
+
+// closeWrite half-closes TCP and TLS connections so the other side sees the end of the stream
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+		return
+	}
+	conn.Close()
+}
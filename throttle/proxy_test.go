@@ -0,0 +1,178 @@
+package throttle
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// startProxy serves a proxy without a rate limit until the test ends
+func startProxy(t *testing.T, upstream, sourceAddress string) *Proxy {
+	t.Helper()
+	proxy, err := NewProxy(NewLimiter(0), upstream, sourceAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go proxy.Serve(ctx)
+	return proxy
+}
+
+// get fetches target through the proxy at proxyURL
+func get(t *testing.T, proxyURL, target string, client *http.Client) (*http.Response, string) {
+	t.Helper()
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &http.Transport{Proxy: http.ProxyURL(u)}
+	if client != nil {
+		transport.TLSClientConfig = client.Transport.(*http.Transport).TLSClientConfig
+	}
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport}).Get(target)
+	if err != nil {
+		return nil, err.Error()
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestProxyToken(t *testing.T) {
+	var leaked bool
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = leaked || r.Header.Get("Proxy-Authorization") != ""
+		io.WriteString(w, "audio")
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	tlsServer := httptest.NewTLSServer(handler)
+	defer tlsServer.Close()
+
+	proxy := startProxy(t, "", "")
+	if !strings.Contains(proxy.URL(), "@"+proxy.Addr()) || strings.Contains(proxy.Addr(), proxy.token) {
+		t.Fatalf("URL() = %q, Addr() = %q, want the token only in the URL", proxy.URL(), proxy.Addr())
+	}
+	wrongToken := "http://" + proxyUser + ":guess@" + proxy.Addr()
+
+	tests := []struct {
+		name, proxyURL string
+		tls            bool
+		wantStatus     int
+	}{
+		{"token", proxy.URL(), false, http.StatusOK},
+		{"token over CONNECT", proxy.URL(), true, http.StatusOK},
+		{"no credentials", "http://" + proxy.Addr(), false, http.StatusProxyAuthRequired},
+		{"wrong token", wrongToken, false, http.StatusProxyAuthRequired},
+		{"no credentials over CONNECT", "http://" + proxy.Addr(), true, 0},
+	}
+	for _, tt := range tests {
+		target, client := server.URL, (*http.Client)(nil)
+		if tt.tls {
+			target, client = tlsServer.URL, tlsServer.Client()
+		}
+		resp, body := get(t, tt.proxyURL, target, client)
+		if tt.wantStatus == 0 {
+			// The refused CONNECT surfaces as a transport error
+			if resp != nil {
+				t.Errorf("%s: got %s, want the tunnel refused", tt.name, resp.Status)
+			}
+			continue
+		}
+		if resp == nil || resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: got %v %s, want status %d", tt.name, resp, body, tt.wantStatus)
+			continue
+		}
+		if tt.wantStatus == http.StatusOK && body != "audio" {
+			t.Errorf("%s: body = %q", tt.name, body)
+		}
+	}
+	if leaked {
+		t.Error("the proxy token was forwarded to the server")
+	}
+}
+
+func TestProxySourceAddress(t *testing.T) {
+	if _, err := NewProxy(NewLimiter(0), "", "not an ip"); err == nil {
+		t.Error("NewProxy accepted an invalid source address")
+	}
+
+	// Linux routes all of 127.0.0.0/8 over loopback, other systems only 127.0.0.1
+	probe, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("no second loopback address: %v", err)
+	}
+	probe.Close()
+
+	remote := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		remote <- host
+	}))
+	defer server.Close()
+
+	proxy := startProxy(t, "", "127.0.0.2")
+	if resp, body := get(t, proxy.URL(), server.URL, nil); resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("request through the proxy failed: %s", body)
+	}
+	if host := <-remote; host != "127.0.0.2" {
+		t.Errorf("server saw a connection from %s, want the source address 127.0.0.2", host)
+	}
+}
+
+func TestProxyChainedConnect(t *testing.T) {
+	// An upstream proxy whose target speaks first, in the same packet as the CONNECT response
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upstream.Close()
+	auth := make(chan string, 1)
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return
+		}
+		auth <- req.Header.Get("Proxy-Authorization")
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\nSSH-2.0-OpenSSH_9.6\r\n")
+	}()
+
+	proxy := startProxy(t, "http://alice:s3cret@"+upstream.Addr().String(), "")
+	client, err := net.Dial("tcp", proxy.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	u, _ := url.Parse(proxy.URL())
+	password, _ := u.User.Password()
+	credentials := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+	fmt.Fprintf(client, "CONNECT example.com:22 HTTP/1.1\r\nHost: example.com:22\r\nProxy-Authorization: Basic %s\r\n\r\n", credentials)
+
+	reader := bufio.NewReader(client)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT through the proxy = %v, %v", resp, err)
+	}
+	banner, err := reader.ReadString('\n')
+	if banner != "SSH-2.0-OpenSSH_9.6\r\n" {
+		t.Errorf("read %q (%v), want the bytes sent with the upstream CONNECT response", banner, err)
+	}
+	if got, want := <-auth, "Basic "+base64.StdEncoding.EncodeToString([]byte("alice:s3cret")); got != want {
+		t.Errorf("upstream got Proxy-Authorization %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,95 @@
+package youtube
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+// Candidate is a search result with the score the ranking gave it, higher is better
+type Candidate struct {
+	Video
+	Score float64 `json:"score"`
+}
+
+// unwantedWords mark versions of a song that are rarely what a query asks for, unless the query says so
+var unwantedWords = []string{"live", "cover", "karaoke", "instrumental", "remix", "reaction", "sped", "slowed", "nightcore", "8d", "tutorial"}
+
+// Songs rarely run shorter or longer than this. Results outside are mostly previews and shorts, or full albums,
+// mixes and hour-long loops, which only score as well as songs when the query names one of longWords.
+const (
+	minSongLength = time.Minute
+	maxSongLength = 15 * time.Minute
+)
+
+var longWords = []string{"album", "mix", "compilation", "hour", "hours"}
+
+// Rank orders search results by the given strategy, best first
+func Rank(query string, videos []Video, strategy string) []Candidate {
+	candidates := make([]Candidate, len(videos))
+	for i, video := range videos {
+		// Earlier results win ties, which keeps YouTube's order for the first strategy
+		candidates[i] = Candidate{Video: video, Score: 1 - float64(i)*0.01}
+		if strategy == config.RankTitle {
+			candidates[i].Score = titleScore(query, video) - float64(i)*0.01
+		}
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].Score > candidates[b].Score
+	})
+	return candidates
+}
+
+// titleScore rates how well a video matches a query: the share of query words found in the title or channel,
+// less a penalty for unwanted versions and unusual lengths, plus a little for official uploads and
+// auto-generated topic channels
+func titleScore(query string, video Video) float64 {
+	queryWords := words(query)
+	found := words(video.Title + " " + video.Channel)
+
+	var score float64
+	if len(queryWords) > 0 {
+		var matched int
+		for word := range queryWords {
+			if found[word] {
+				matched++
+			}
+		}
+		score = float64(matched) / float64(len(queryWords))
+	}
+
+	title := words(video.Title)
+	for _, word := range unwantedWords {
+		if title[word] && !queryWords[word] {
+			score -= 0.3
+		}
+	}
+	if video.Duration > 0 && video.Duration < minSongLength {
+		score -= 0.2
+	}
+	if video.Duration > maxSongLength && !slices.ContainsFunc(longWords, func(word string) bool { return queryWords[word] }) {
+		score -= 0.2
+	}
+	if title["official"] {
+		score += 0.1
+	}
+	if strings.HasSuffix(video.Channel, " - Topic") {
+		score += 0.15
+	}
+	return score
+}
+
+// words returns the lower-cased words of s
+func words(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		set[word] = true
+	}
+	return set
+}
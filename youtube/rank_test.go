@@ -0,0 +1,65 @@
+package youtube
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ktappdev/ytaudio/config"
+)
+
+func TestTitleScore(t *testing.T) {
+	tests := []struct {
+		query string
+		video Video
+		want  float64
+	}{
+		{"Daft Punk - One More Time", Video{Title: "Daft Punk - One More Time"}, 1},
+		{"Daft Punk - One More Time", Video{Title: "One More Time", Channel: "Daft Punk"}, 1},
+		{"Daft Punk - One More Time", Video{Title: "One More Time"}, 0.6},
+		{"Daft Punk - One More Time", Video{Title: "Daft Punk - One More Time (Official Video)"}, 1.1},
+		{"Daft Punk - One More Time", Video{Title: "One More Time", Channel: "Daft Punk - Topic"}, 1.15},
+		{"Daft Punk - One More Time", Video{Title: "Daft Punk - One More Time (Live)"}, 0.7},
+		{"Daft Punk - One More Time live", Video{Title: "Daft Punk - One More Time (Live)"}, 1},
+		{"Daft Punk - One More Time", Video{Title: "Daft Punk - One More Time (Karaoke Cover)"}, 0.4},
+		{"Daft Punk - One More Time", Video{Title: "Daft Punk - One More Time", Duration: 5 * time.Minute}, 1},
+		{"Daft Punk - One More Time", Video{Title: "Daft Punk - One More Time", Duration: 30 * time.Second}, 0.8},
+		{"Daft Punk - One More Time", Video{Title: "Daft Punk - One More Time 10 hours", Duration: 10 * time.Hour}, 0.8},
+		{"Daft Punk - Discovery full album", Video{Title: "Daft Punk - Discovery (Full Album)", Duration: time.Hour}, 1},
+		{"", Video{Title: "Daft Punk - One More Time"}, 0},
+	}
+	for _, tt := range tests {
+		if got := titleScore(tt.query, tt.video); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("titleScore(%q, %+v) = %v, want %v", tt.query, tt.video, got, tt.want)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	videos := []Video{
+		{ID: "live", Title: "Daft Punk - One More Time (Live)", Channel: "Concerts", Duration: 6 * time.Minute},
+		{ID: "loop", Title: "Daft Punk - One More Time 1 hour", Channel: "Loops", Duration: time.Hour},
+		{ID: "short", Title: "Daft Punk - One More Time", Channel: "Shorts", Duration: 20 * time.Second},
+		{ID: "video", Title: "Daft Punk - One More Time", Channel: "Daft Punk", Duration: 5 * time.Minute},
+		{ID: "topic", Title: "One More Time", Channel: "Daft Punk - Topic", Duration: 5 * time.Minute},
+	}
+	tests := []struct {
+		query, strategy string
+		want            []string
+	}{
+		{"Daft Punk - One More Time", config.RankFirst, []string{"live", "loop", "short", "video", "topic"}},
+		{"Daft Punk - One More Time", config.RankTitle, []string{"topic", "video", "loop", "short", "live"}},
+		{"Daft Punk - One More Time live", config.RankTitle, []string{"live", "topic", "video", "loop", "short"}},
+		{"Daft Punk - One More Time 1 hour", config.RankTitle, []string{"loop", "topic", "video", "short", "live"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, c := range Rank(tt.query, videos, tt.strategy) {
+			got = append(got, c.ID)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Rank(%q, %s) = %v, want %v", tt.query, tt.strategy, got, tt.want)
+		}
+	}
+}
@@ -3,11 +3,14 @@ package youtube
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ktappdev/ytaudio/config"
@@ -19,8 +22,40 @@ const (
 
 // Video represents a YouTube video with its ID and Title
 type Video struct {
-	ID    string
-	Title string
+	ID       string        `json:"id"`
+	Title    string        `json:"title"`
+	Channel  string        `json:"channel,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"` // only known to some search backends
+}
+
+// APIError is an error response of the YouTube Data API
+type APIError struct {
+	StatusCode int
+	Reason     string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("YouTube API error %d (%s): %s", e.StatusCode, e.Reason, e.Message)
+}
+
+// QuotaExceeded reports whether the request was refused because the API key ran out of quota
+func (e *APIError) QuotaExceeded() bool {
+	switch e.Reason {
+	case "quotaExceeded", "dailyLimitExceeded", "rateLimitExceeded", "userRateLimitExceeded":
+		return true
+	}
+	return false
+}
+
+// AuthFailed reports whether the request was refused because of the API key: invalid, not allowed or out of quota
+func (e *APIError) AuthFailed() bool {
+	switch {
+	case e.QuotaExceeded(), e.StatusCode == http.StatusUnauthorized, e.StatusCode == http.StatusForbidden, e.Reason == "keyInvalid":
+		return true
+	}
+	// An invalid key is a plain bad request whose message names the key
+	return e.StatusCode == http.StatusBadRequest && strings.Contains(e.Message, "API key")
 }
 
 // ListVideos searches for videos and displays the results
@@ -66,13 +101,25 @@ func SearchAndDownloadSong(cfg *config.Config) (string, error) {
 
 // SearchVideos performs a YouTube search using the YouTube Data API
 func SearchVideos(query string, apiKey string) ([]Video, error) {
+	return SearchVideosContext(context.Background(), query, apiKey, 5)
+}
+
+// SearchVideosContext searches like SearchVideos for up to maxResults videos and stops when ctx is cancelled
+func SearchVideosContext(ctx context.Context, query string, apiKey string, maxResults int) ([]Video, error) {
 	log.Printf("Searching YouTube for: %s", query)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	searchURL := fmt.Sprintf("%s?part=snippet&q=%s&key=%s&type=video&maxResults=5",
-		youtubeAPIURL, url.QueryEscape(query), apiKey)
-	log.Printf("Search URL: %s", searchURL)
+	params := url.Values{
+		"part":       {"snippet"},
+		"q":          {query},
+		"type":       {"video"},
+		"maxResults": {strconv.Itoa(maxResults)},
+	}
+	// The URL is logged before the key is added, so logs never contain it
+	log.Printf("Search URL: %s?%s", youtubeAPIURL, params.Encode())
+	params.Set("key", apiKey)
+	searchURL := youtubeAPIURL + "?" + params.Encode()
 
 	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
 	if err != nil {
@@ -83,6 +130,11 @@ func SearchVideos(query string, apiKey string) ([]Video, error) {
 	log.Println("Sending HTTP request to YouTube API")
 	resp, err := client.Do(req)
 	if err != nil {
+		// Client errors quote the request URL, key included
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
 		return nil, fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
@@ -92,6 +144,9 @@ func SearchVideos(query string, apiKey string) ([]Video, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error reading response: %w", err)
 	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseAPIError(resp.StatusCode, body)
+	}
 
 	var searchResponse struct {
 		Items []struct {
@@ -99,7 +154,8 @@ func SearchVideos(query string, apiKey string) ([]Video, error) {
 				VideoID string `json:"videoId"`
 			} `json:"id"`
 			Snippet struct {
-				Title string `json:"title"`
+				Title        string `json:"title"`
+				ChannelTitle string `json:"channelTitle"`
 			} `json:"snippet"`
 		} `json:"items"`
 	}
@@ -113,8 +169,9 @@ func SearchVideos(query string, apiKey string) ([]Video, error) {
 	var videos []Video
 	for _, item := range searchResponse.Items {
 		video := Video{
-			ID:    item.ID.VideoID,
-			Title: item.Snippet.Title,
+			ID:      item.ID.VideoID,
+			Title:   item.Snippet.Title,
+			Channel: item.Snippet.ChannelTitle,
 		}
 		videos = append(videos, video)
 		log.Printf("Found video: %s (ID: %s)", video.Title, video.ID)
@@ -122,4 +179,26 @@ func SearchVideos(query string, apiKey string) ([]Video, error) {
 
 	log.Printf("Found %d videos in total", len(videos))
 	return videos, nil
-}
\ No newline at end of file
+}
+
+// parseAPIError turns an error response of the API into an APIError, keeping the reason of the first error
+func parseAPIError(statusCode int, body []byte) error {
+	var response struct {
+		Error struct {
+			Message string `json:"message"`
+			Errors  []struct {
+				Reason string `json:"reason"`
+			} `json:"errors"`
+		} `json:"error"`
+	}
+	apiErr := &APIError{StatusCode: statusCode, Message: http.StatusText(statusCode)}
+	if json.Unmarshal(body, &response) == nil {
+		if response.Error.Message != "" {
+			apiErr.Message = response.Error.Message
+		}
+		if len(response.Error.Errors) > 0 {
+			apiErr.Reason = response.Error.Errors[0].Reason
+		}
+	}
+	return apiErr
+}